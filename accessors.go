@@ -0,0 +1,55 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import "strings"
+
+// accessorsType is a struct generated with accessors for its optional fields.
+type accessorsType struct {
+	Name      string
+	Accessors []accessor
+}
+
+// accessor is an optional field of a struct, a pointer to a Go type that the
+// field of a required element holds as a value.
+type accessor struct {
+	Field string
+	Type  string
+}
+
+// accessors returns the optional fields of the struct generated for ct, whose
+// element types are mapped to Go by goType, or nil if there are none.
+func accessors(ct *XSDComplexType, goType func(xsdType string) string) []accessor {
+	var fields []accessor
+	addElements := func(elements []*XSDElement) {
+		for _, el := range elements {
+			var name, typ string
+			switch {
+			case el.Ref != "" || isNillable(el):
+				continue
+			case el.Type != "":
+				name, typ = makePublic(replaceAttrReservedWords(el.Name)), goType(el.Type)
+			case el.SimpleType != nil && el.SimpleType.List.ItemType == "":
+				name, typ = makePublic(normalize(el.Name)), goType(el.SimpleType.Restriction.Base)
+			default:
+				continue
+			}
+			if !strings.HasPrefix(typ, "*") && strings.HasPrefix(elementType(typ, el), "*") {
+				fields = append(fields, accessor{Field: name, Type: typ})
+			}
+		}
+	}
+
+	switch {
+	case ct.ComplexContent.Extension.Base != "":
+		addElements(elementPointers(ct.ComplexContent.Extension.Sequence))
+	case ct.SimpleContent.Extension.Base != "":
+	default:
+		addElements(ct.Sequence)
+		addElements(ct.Choice)
+		addElements(ct.All)
+	}
+	return fields
+}
@@ -0,0 +1,302 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// soapCloned holds the types of the soap package that have Clone and Equal
+// methods.
+var soapCloned = map[string]bool{"Binary": true, "AnyXML": true, "EncodedArray": true, "EncodedStruct": true}
+
+var packageClause = regexp.MustCompile(`(?m)^package `)
+
+// cloner generates the Clone and Equal methods of the struct types of the
+// generated code, from their Go declarations, so that fields of every form
+// are copied and compared alike.
+type cloner struct {
+	// types maps the packages of the generated files, the main package
+	// being "", to the underlying types of the named types they declare.
+	types map[string]map[string]ast.Expr
+	// pkg is the package of the file the methods are generated for.
+	pkg string
+}
+
+// genCloneMethods appends the Clone and Equal methods of the struct types
+// declared by the generated files of gocode to them.
+func genCloneMethods(gocode map[string][]byte) error {
+	c := &cloner{types: make(map[string]map[string]ast.Expr)}
+	files := make(map[string]*ast.File)
+	for name, src := range gocode {
+		if name == "server" || len(bytes.TrimSpace(src)) == 0 {
+			continue
+		}
+		if !packageClause.Match(src) {
+			src = append([]byte("package main\n"), src...)
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), name, src, 0)
+		if err != nil {
+			return fmt.Errorf("generated code is not valid Go: %v", err)
+		}
+		files[name] = file
+
+		pkg := filePackage(name)
+		if c.types[pkg] == nil {
+			c.types[pkg] = make(map[string]ast.Expr)
+		}
+		for _, spec := range typeSpecs(file) {
+			c.types[pkg][spec.Name.Name] = spec.Type
+		}
+	}
+
+	for name, file := range files {
+		c.pkg = filePackage(name)
+		methods := new(bytes.Buffer)
+		for _, spec := range typeSpecs(file) {
+			if st, ok := spec.Type.(*ast.StructType); ok && !holdsClient(st) {
+				c.genMethods(methods, spec.Name.Name, st)
+			}
+		}
+		gocode[name] = append(gocode[name], methods.Bytes()...)
+	}
+	return nil
+}
+
+// filePackage returns the package of the generated file called name, which is
+// the directory of the files of namespace packages.
+func filePackage(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// typeSpecs returns the type declarations of file, leaving out aliases.
+func typeSpecs(file *ast.File) []*ast.TypeSpec {
+	var specs []*ast.TypeSpec
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			if ts := spec.(*ast.TypeSpec); !ts.Assign.IsValid() {
+				specs = append(specs, ts)
+			}
+		}
+	}
+	return specs
+}
+
+// holdsClient reports whether st is the struct of a port type, holding the
+// soap.Client of its calls, rather than a value.
+func holdsClient(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if star, ok := field.Type.(*ast.StarExpr); ok && typeString(star.X) == "soap.Client" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cloner) genMethods(w *bytes.Buffer, name string, st *ast.StructType) {
+	fmt.Fprintf(w, "\n// Clone returns a deep copy of t, or nil if t is nil.\n")
+	fmt.Fprintf(w, "func (t *%s) Clone() *%s {\nif t == nil {\nreturn nil\n}\nc := *t\n", name, name)
+	for _, line := range c.cloneFields("c", "t", st, 0) {
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "return &c\n}\n")
+
+	fmt.Fprintf(w, "\n// Equal reports whether t and other hold the same values, whatever their\n// XMLName.\n")
+	fmt.Fprintf(w, "func (t *%s) Equal(other *%s) bool {\nif t == nil || other == nil {\nreturn t == other\n}\n", name, name)
+	for _, line := range c.equalFields("t", "other", st, 0) {
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "return true\n}\n")
+}
+
+// cloneFields returns the statements making dst, a shallow copy of the struct
+// src of type st, a deep copy.
+func (c *cloner) cloneFields(dst, src string, st *ast.StructType, depth int) []string {
+	var lines []string
+	for _, field := range st.Fields.List {
+		for _, name := range fieldNames(field) {
+			lines = append(lines, c.clone(dst+"."+name, src+"."+name, field.Type, depth)...)
+		}
+	}
+	return lines
+}
+
+// clone returns the statements making dst, a shallow copy of src, whose type
+// is typ, a deep copy.
+func (c *cloner) clone(dst, src string, typ ast.Expr, depth int) []string {
+	if !c.deep(typ) {
+		return nil
+	}
+
+	switch t := typ.(type) {
+	case *ast.StarExpr:
+		if c.cloned(t.X) {
+			return []string{dst + " = " + src + ".Clone()"}
+		}
+		v := fmt.Sprintf("v%d", depth)
+		lines := []string{"if " + src + " != nil {", v + " := *" + src}
+		lines = append(lines, c.clone(v, "(*"+src+")", t.X, depth+1)...)
+		return append(lines, dst+" = &"+v, "}")
+	case *ast.ArrayType:
+		lines := []string{dst + " = append(" + src + "[:0:0], " + src + "...)"}
+		if !c.deep(t.Elt) {
+			return lines
+		}
+		i := fmt.Sprintf("i%d", depth)
+		lines = append(lines, "for "+i+" := range "+src+" {")
+		lines = append(lines, c.clone(dst+"["+i+"]", src+"["+i+"]", t.Elt, depth+1)...)
+		return append(lines, "}")
+	case *ast.StructType:
+		return c.cloneFields(dst, src, t, depth)
+	}
+
+	if c.cloned(typ) {
+		return []string{dst + " = *" + src + ".Clone()"}
+	}
+	return c.clone(dst, src, c.underlying(typ), depth)
+}
+
+// equalFields returns the statements returning false unless the structs a and
+// b of type st hold the same values, leaving their XMLName out.
+func (c *cloner) equalFields(a, b string, st *ast.StructType, depth int) []string {
+	var lines []string
+	for _, field := range st.Fields.List {
+		for _, name := range fieldNames(field) {
+			if name == "XMLName" {
+				continue
+			}
+			lines = append(lines, c.equal(a+"."+name, b+"."+name, field.Type, depth)...)
+		}
+	}
+	return lines
+}
+
+// equal returns the statements returning false unless a and b, whose type is
+// typ, hold the same values. Empty and nil slices are equal.
+func (c *cloner) equal(a, b string, typ ast.Expr, depth int) []string {
+	switch t := typ.(type) {
+	case *ast.StarExpr:
+		if c.cloned(t.X) {
+			return []string{"if !" + a + ".Equal(" + b + ") {", "return false", "}"}
+		}
+		lines := []string{"if (" + a + " == nil) != (" + b + " == nil) {", "return false", "}", "if " + a + " != nil {"}
+		lines = append(lines, c.equal("(*"+a+")", "(*"+b+")", t.X, depth+1)...)
+		return append(lines, "}")
+	case *ast.ArrayType:
+		i := fmt.Sprintf("i%d", depth)
+		lines := []string{"if len(" + a + ") != len(" + b + ") {", "return false", "}", "for " + i + " := range " + a + " {"}
+		lines = append(lines, c.equal(a+"["+i+"]", b+"["+i+"]", t.Elt, depth+1)...)
+		return append(lines, "}")
+	case *ast.StructType:
+		return c.equalFields(a, b, t, depth)
+	}
+
+	switch {
+	case c.cloned(typ):
+		return []string{"if !" + a + ".Equal(&" + b + ") {", "return false", "}"}
+	case typeString(typ) == "time.Time":
+		return []string{"if !" + a + ".Equal(" + b + ") {", "return false", "}"}
+	}
+	if underlying := c.underlying(typ); underlying != typ {
+		return c.equal(a, b, underlying, depth)
+	}
+	return []string{"if " + a + " != " + b + " {", "return false", "}"}
+}
+
+// deep reports whether values of typ hold references, which a deep copy does
+// not share. Interface values are copied as they are.
+func (c *cloner) deep(typ ast.Expr) bool {
+	switch t := typ.(type) {
+	case *ast.StarExpr, *ast.ArrayType:
+		return true
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if c.deep(field.Type) {
+				return true
+			}
+		}
+		return false
+	}
+	if c.cloned(typ) {
+		return true
+	}
+	if underlying := c.underlying(typ); underlying != typ {
+		return c.deep(underlying)
+	}
+	return false
+}
+
+// cloned reports whether typ is a struct type with Clone and Equal methods.
+func (c *cloner) cloned(typ ast.Expr) bool {
+	if sel, ok := typ.(*ast.SelectorExpr); ok && typeString(sel.X) == "soap" {
+		return soapCloned[sel.Sel.Name]
+	}
+	st, ok := c.lookup(typ).(*ast.StructType)
+	return ok && !holdsClient(st)
+}
+
+// underlying returns the underlying type of typ if it is a named type of the
+// generated code, and typ otherwise.
+func (c *cloner) underlying(typ ast.Expr) ast.Expr {
+	if declared := c.lookup(typ); declared != nil {
+		return declared
+	}
+	return typ
+}
+
+// lookup returns the declaration of typ if it is a named type of the generated
+// code, or nil.
+func (c *cloner) lookup(typ ast.Expr) ast.Expr {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return c.types[c.pkg][t.Name]
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			return c.types[pkg.Name][t.Sel.Name]
+		}
+	}
+	return nil
+}
+
+// fieldNames returns the names of field, or the name of the type of an
+// embedded field.
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) > 0 {
+		var names []string
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		return names
+	}
+	name := typeString(field.Type)
+	return []string{name[strings.LastIndexAny(name, "*.")+1:]}
+}
+
+// typeString returns typ as written, for named and pointer types.
+func typeString(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return typeString(t.X) + "." + t.Sel.Name
+	case *ast.StarExpr:
+		return "*" + typeString(t.X)
+	}
+	return ""
+}
@@ -50,10 +50,11 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-	"go/format"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	gen "github.com/eloyucu/gowsdl"
 )
@@ -70,6 +71,19 @@ var outFile = flag.String("o", "myservice.go", "File where the generated code wi
 var dir = flag.String("d", "./", "Directory under which package directory will be created")
 var insecure = flag.Bool("i", false, "Skips TLS Verification")
 var makePublic = flag.Bool("make-public", true, "Make the generated types public/exported")
+var jsonTags = flag.Bool("json-tags", false, "Add json tags, named after the XML nodes, to the generated fields")
+var validate = flag.Bool("validate", false, "Generate Validate methods checking the XSD facets of restricted types")
+var enumKind = flag.String("enum-kind", gen.EnumKindString, "Generate enumerations as string constants or as int constants marshaled to their XSD value: string or int")
+var binaryBytes = flag.Bool("binary-bytes", false, "Generate base64Binary elements as []byte rather than as soap.Binary, which MTOM sends as attachments")
+var server = flag.Bool("server", false, "Generate a server interface and an http.Handler serving it for every port type")
+var multiPackage = flag.Bool("multi-package", false, "Generate the types of every XML namespace into their own subpackage")
+var splitFiles = flag.Bool("split-files", false, "Generate the types of every XML namespace into a file of their own, next to the operations file")
+var constructors = flag.Bool("constructors", false, "Generate NewX constructors presetting the XMLName of the request types of operations")
+var accessors = flag.Bool("accessors", false, "Generate GetX and SetX methods for the optional fields of the generated structs that point to a value")
+var cloneMethods = flag.Bool("clone", false, "Generate Clone and Equal methods deep copying and comparing the generated structs")
+var unqualifiedTags = flag.Bool("unqualified-tags", false, "Generate the xml tags of local elements and attributes without namespace, whatever the elementFormDefault and attributeFormDefault of their schema")
+var requiredElements = flag.String("required-elements", "", "Comma separated local names of elements always encoded, even when empty, as the elements whose minOccurs is one or more")
+var importPath = flag.String("import-path", "", "Import path of the generated package, required by -multi-package")
 
 func init() {
 	log.SetFlags(0)
@@ -102,8 +116,23 @@ func main() {
 		log.Fatalln("Output file cannot be the same WSDL file")
 	}
 
+	if *enumKind != gen.EnumKindString && *enumKind != gen.EnumKindInt {
+		log.Fatalf("-enum-kind must be %s or %s, got %s", gen.EnumKindString, gen.EnumKindInt, *enumKind)
+	}
+
+	opts := []gen.Option{gen.WithJSONTags(*jsonTags), gen.WithValidation(*validate), gen.WithEnumKind(*enumKind), gen.WithBinaryBytes(*binaryBytes), gen.WithServer(*server), gen.WithSplitFiles(*splitFiles), gen.WithConstructors(*constructors), gen.WithAccessors(*accessors), gen.WithCloneMethods(*cloneMethods), gen.WithUnqualifiedTags(*unqualifiedTags)}
+	if *requiredElements != "" {
+		opts = append(opts, gen.WithRequiredElements(strings.Split(*requiredElements, ",")...))
+	}
+	if *multiPackage {
+		if *importPath == "" {
+			log.Fatalln("-multi-package requires the -import-path of the generated package")
+		}
+		opts = append(opts, gen.WithMultiPackage(*importPath))
+	}
+
 	// load wsdl
-	gowsdl, err := gen.NewGoWSDL(wsdlPath, *pkg, *insecure, *makePublic)
+	gowsdl, err := gen.NewGoWSDL(wsdlPath, *pkg, *insecure, *makePublic, opts...)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -127,10 +156,11 @@ func main() {
 	data.Write(gocode["header"])
 	data.Write(gocode["types"])
 	data.Write(gocode["operations"])
+	data.Write(gocode["server"])
 	data.Write(gocode["soap"])
 
-	// go fmt the generated code
-	source, err := format.Source(data.Bytes())
+	// go fmt the generated code and prune its unused imports
+	source, err := gen.FormatSource(data.Bytes())
 	if err != nil {
 		file.Write(data.Bytes())
 		log.Fatalln(err)
@@ -138,5 +168,27 @@ func main() {
 
 	file.Write(source)
 
+	// write the namespace packages, if any
+	for name, code := range gocode {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+
+		path := filepath.Join(pkg, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0744); err != nil {
+			log.Fatalln(err)
+		}
+
+		source, err := gen.FormatSource(code)
+		if err != nil {
+			ioutil.WriteFile(path, code, 0644)
+			log.Fatalln(err)
+		}
+
+		if err := ioutil.WriteFile(path, source, 0644); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	log.Println("Done 👍")
 }
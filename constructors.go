@@ -0,0 +1,95 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// requestNames holds the types generated for the requests of document style
+// operations, which WithConstructors generates a constructor for.
+type requestNames struct {
+	// types maps the named complex types of requests to the element they
+	// are sent as. Types sent as several elements are mapped to nil.
+	types map[xml.Name]*xml.Name
+	// elements holds the elements of requests declaring their type inline.
+	elements map[xml.Name]bool
+}
+
+// requestNames returns the types of the requests of the operations of the
+// port types, leaving out rpc style messages, whose structs are generated
+// with the operations.
+func (g *GoWSDL) requestNames() *requestNames {
+	r := &requestNames{types: make(map[xml.Name]*xml.Name), elements: make(map[xml.Name]bool)}
+	for _, portType := range g.wsdl.PortTypes {
+		for _, op := range portType.Operations {
+			if g.findRPCMessage(op.Input.Message) != nil {
+				continue
+			}
+			msg := g.findMessage(op.Input.Message)
+			if msg == nil || len(msg.Parts) == 0 || msg.Parts[0].Element == "" {
+				continue
+			}
+
+			schema, el := g.findGlobalElement(stripns(msg.Parts[0].Element))
+			if el == nil {
+				continue
+			}
+			name := xml.Name{Space: schema.TargetNamespace, Local: el.Name}
+			if el.Type == "" {
+				r.elements[name] = true
+				continue
+			}
+			typ := xml.Name{Space: resolveNamespace(schema, el.Type), Local: stripns(el.Type)}
+			if sent, ok := r.types[typ]; ok && (sent == nil || *sent != name) {
+				r.types[typ] = nil
+				continue
+			}
+			r.types[typ] = &name
+		}
+	}
+	return r
+}
+
+// findGlobalElement returns the global element named name, and its schema.
+func (g *GoWSDL) findGlobalElement(name string) (*XSDSchema, *XSDElement) {
+	for _, schema := range g.wsdl.Types.Schemas {
+		for _, el := range schema.Elements {
+			if strings.EqualFold(name, el.Name) {
+				return schema, el
+			}
+		}
+	}
+	return nil, nil
+}
+
+// requestElement returns the name of the element of schema called name if it
+// is the request of an operation, to be preset by the constructor of its
+// struct, or nil.
+func (g *GoWSDL) requestElement(schema *XSDSchema, name string) *xml.Name {
+	if g.requests == nil || !g.requests.elements[xml.Name{Space: schema.TargetNamespace, Local: name}] {
+		return nil
+	}
+	return &xml.Name{Space: schema.TargetNamespace, Local: name}
+}
+
+// requestType returns the name of the element the complex type of schema
+// called name is sent as, if it is the request of operations, or nil. Types
+// whose XMLName field is tagged with another element name are left out, as
+// the tag would override the name preset by the constructor.
+func (g *GoWSDL) requestType(schema *XSDSchema, name string) *xml.Name {
+	if g.requests == nil {
+		return nil
+	}
+	sent := g.requests.types[xml.Name{Space: schema.TargetNamespace, Local: name}]
+	if sent == nil {
+		return nil
+	}
+	if tagged := g.findNameByType(name); g.makePublicFn(replaceReservedWords(name)) != tagged && *sent != (xml.Name{Space: schema.TargetNamespace, Local: tagged}) {
+		return nil
+	}
+	return sent
+}
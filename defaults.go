@@ -0,0 +1,111 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"encoding/xml"
+	"log"
+	"strconv"
+)
+
+// fixedAttribute is an attribute with a fixed value, generated as a type of
+// its own that always marshals that value.
+type fixedAttribute struct {
+	TypeName string
+	Name     string
+	Value    string
+	attr     *XSDAttribute
+}
+
+// attributeDefault is a field set to the default value of its attribute by
+// the constructor of its struct.
+type attributeDefault struct {
+	Field   string
+	Literal string
+}
+
+// attributeExtras are the declarations generated after the struct Name for
+// its fixed and default attributes, and for its constructor.
+type attributeExtras struct {
+	Name     string
+	Fixed    []fixedAttribute
+	Defaults []attributeDefault
+	// XMLName is the name of the request element preset by the
+	// constructor, set for the requests of operations by WithConstructors.
+	XMLName *xml.Name
+}
+
+// typeAttributes returns the attributes of the struct generated for ct.
+func typeAttributes(ct *XSDComplexType) []*XSDAttribute {
+	var attrs []*XSDAttribute
+	attrs = append(attrs, ct.Attributes...)
+	attrs = append(attrs, ct.ComplexContent.Extension.Attributes...)
+	attrs = append(attrs, ct.SimpleContent.Extension.Attributes...)
+	return attrs
+}
+
+// fixedAttributes returns the fixed attributes of ct, whose struct is named
+// owner. Their types are named after the owner and the field.
+func fixedAttributes(owner string, ct *XSDComplexType) []fixedAttribute {
+	var fixed []fixedAttribute
+	for _, attr := range typeAttributes(ct) {
+		if attr.Fixed != "" {
+			fixed = append(fixed, fixedAttribute{
+				TypeName: owner + makePublic(normalize(attr.Name)),
+				Name:     attr.Name,
+				Value:    attr.Fixed,
+				attr:     attr,
+			})
+		}
+	}
+	return fixed
+}
+
+// attributeDefaults returns the fields of ct set to a default value, where
+// goType maps the XSD type of an attribute to the type of its field. Defaults
+// of types without a Go literal, such as dates, are left out.
+func attributeDefaults(ct *XSDComplexType, goType func(string) string) []attributeDefault {
+	var defaults []attributeDefault
+	for _, attr := range typeAttributes(ct) {
+		if attr.Default == "" || attr.Fixed != "" {
+			continue
+		}
+
+		typ := "string"
+		if attr.Type != "" {
+			typ = goType(attr.Type)
+		}
+		literal := defaultLiteral(attr.Default, typ)
+		if literal == "" {
+			log.Printf("[WARN] default %q of attribute %s has no %s literal and won't be set", attr.Default, attr.Name, typ)
+			continue
+		}
+		defaults = append(defaults, attributeDefault{
+			Field:   makePublic(normalize(attr.Name)),
+			Literal: literal,
+		})
+	}
+	return defaults
+}
+
+// defaultLiteral returns the Go literal of the lexical value of a goType, or
+// an empty string if there is none.
+func defaultLiteral(value, goType string) string {
+	switch {
+	case goType == "string":
+		return strconv.Quote(value)
+	case goType == "bool":
+		switch value {
+		case "true", "1":
+			return "true"
+		case "false", "0":
+			return "false"
+		}
+		return ""
+	case integerGoTypes[goType], goType == "float32", goType == "float64":
+		return numericLiteral(value, goType)
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// snippetContext is the number of lines shown around a syntax error.
+const snippetContext = 3
+
+// FormatSource formats generated Go source, as gofmt does, and removes the
+// imports it does not use. Generated code that does not parse is a generator
+// bug, so the error shows the offending lines.
+func FormatSource(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("generated code is not valid Go: %v\n%s", err, errorSnippet(src, err))
+	}
+
+	pruneImports(file)
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// errorSnippet returns the lines of src around the first error in err, if it
+// has a position.
+func errorSnippet(src []byte, err error) string {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return ""
+	}
+	line := list[0].Pos.Line
+
+	lines := strings.Split(string(src), "\n")
+	first, last := line-snippetContext, line+snippetContext
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	var snippet strings.Builder
+	for i := first; i <= last; i++ {
+		marker := "  "
+		if i == line {
+			marker = "> "
+		}
+		fmt.Fprintf(&snippet, "%s%5d | %s\n", marker, i, lines[i-1])
+	}
+	return snippet.String()
+}
+
+// pruneImports removes the imports of file that are not referenced. Imports
+// named _ or . are kept.
+func pruneImports(file *ast.File) {
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	decls := file.Decls[:0]
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			decls = append(decls, decl)
+			continue
+		}
+
+		specs := gen.Specs[:0]
+		for _, spec := range gen.Specs {
+			if name := importName(spec.(*ast.ImportSpec)); name == "_" || name == "." || used[name] {
+				specs = append(specs, spec)
+			}
+		}
+		gen.Specs = specs
+
+		if len(specs) > 0 {
+			decls = append(decls, gen)
+		}
+	}
+	file.Decls = decls
+
+	imports := file.Imports[:0]
+	for _, spec := range file.Imports {
+		if name := importName(spec); name == "_" || name == "." || used[name] {
+			imports = append(imports, spec)
+		}
+	}
+	file.Imports = imports
+}
+
+// importName returns the name an import is referenced by, assuming the
+// package name matches the last element of its path.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	importPath, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return path.Base(importPath)
+}
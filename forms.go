@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+// qualifyLocalDeclarations records the target namespace of s as the namespace
+// of its local elements and attributes that are qualified, by their form
+// attribute or else by the elementFormDefault and attributeFormDefault of s.
+// Local declarations are unqualified by default, and global ones, which other
+// declarations refer to, are always qualified.
+func (s *XSDSchema) qualifyLocalDeclarations() {
+	for _, ct := range s.ComplexTypes {
+		s.qualifyComplexType(ct)
+	}
+	for _, el := range s.Elements {
+		if el.ComplexType != nil {
+			s.qualifyComplexType(el.ComplexType)
+		}
+	}
+	for _, group := range s.Groups {
+		s.qualifyElements(group.Sequence)
+		s.qualifyElements(group.Choice)
+		s.qualifyElements(group.All)
+	}
+	for _, group := range s.AttributeGroups {
+		s.qualifyAttributes(group.Attributes)
+	}
+}
+
+func (s *XSDSchema) qualifyComplexType(ct *XSDComplexType) {
+	s.qualifyElements(ct.Sequence)
+	s.qualifyElements(ct.Choice)
+	s.qualifyElements(ct.All)
+	s.qualifyElements(elementPointers(ct.ComplexContent.Extension.Sequence))
+	s.qualifyElements(elementPointers(ct.ComplexContent.Restriction.Sequence))
+
+	s.qualifyAttributes(ct.Attributes)
+	s.qualifyAttributes(ct.ComplexContent.Extension.Attributes)
+	s.qualifyAttributes(ct.ComplexContent.Restriction.Attributes)
+	s.qualifyAttributes(ct.SimpleContent.Extension.Attributes)
+}
+
+func (s *XSDSchema) qualifyElements(elements []*XSDElement) {
+	for _, el := range elements {
+		if el.Ref != "" || el.groupRef != nil {
+			continue
+		}
+		if qualified(el.Form, s.ElementFormDefault) {
+			el.namespace = s.TargetNamespace
+		}
+		if el.ComplexType != nil {
+			s.qualifyComplexType(el.ComplexType)
+		}
+	}
+}
+
+func (s *XSDSchema) qualifyAttributes(attributes []*XSDAttribute) {
+	for _, attr := range attributes {
+		if attr.Ref == "" && qualified(attr.Form, s.AttributeFormDefault) {
+			attr.namespace = s.TargetNamespace
+		}
+	}
+}
+
+// qualified reports whether a local declaration of the given form, in a
+// schema with the given form default, is qualified.
+func qualified(form, formDefault string) bool {
+	if form != "" {
+		return form == "qualified"
+	}
+	return formDefault == "qualified"
+}
+
+// namespacePrefix returns the namespace of a qualified element or attribute
+// as the leading part of the name of an xml tag, or an empty string for an
+// unqualified one or when WithUnqualifiedTags is set.
+func (g *GoWSDL) namespacePrefix(namespace string) string {
+	if namespace == "" || g.unqualifiedTags {
+		return ""
+	}
+	return namespace + " "
+}
@@ -34,7 +34,170 @@ type GoWSDL struct {
 	makePublicFn          func(string) string
 	wsdl                  *WSDL
 	resolvedXSDExternals  map[string]bool
+	resolvedWSDLImports   map[string]bool
 	currentRecursionLevel uint8
+	jsonTags              bool
+	importPath            string
+	packages              map[string]string
+	opsImports            map[string]bool
+	renames               map[string]map[string]string
+	portTypes             map[string]string
+	rpcMessages           []*rpcMessage
+	validation            bool
+	enumKind              string
+	binaryBytes           bool
+	server                bool
+	splitFiles            bool
+	constructors          bool
+	requests              *requestNames
+	requiredElements      map[string]bool
+	accessors             bool
+	cloneMethods          bool
+	unqualifiedTags       bool
+	validated             map[string]map[string]bool
+	derived               map[xml.Name][]xml.Name
+	registered            map[xml.Name]bool
+	nillables             map[string]map[string]string
+}
+
+// An Option customizes the code produced by the generator.
+type Option func(*GoWSDL)
+
+// WithJSONTags is an Option to set whether generated fields carry a json tag,
+// keyed by the XML local name, next to their xml tag. It is disabled by default.
+func WithJSONTags(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.jsonTags = enabled
+	}
+}
+
+// WithValidation is an Option to set whether types restricted by XSD facets,
+// and the complex types holding them, are generated with a Validate method
+// checking the length, pattern and range facets. It is disabled by default.
+func WithValidation(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.validation = enabled
+	}
+}
+
+// Enum kinds accepted by WithEnumKind.
+const (
+	EnumKindString = "string"
+	EnumKindInt    = "int"
+)
+
+// WithEnumKind is an Option to set how string types restricted to an
+// enumeration are generated. EnumKindString, the default, keeps them as
+// strings with a constant per value. EnumKindInt generates int types with iota
+// constants, starting at one so the zero value stays unset, that marshal to
+// and from their XSD value.
+func WithEnumKind(kind string) Option {
+	return func(g *GoWSDL) {
+		g.enumKind = kind
+	}
+}
+
+// WithBinaryBytes is an Option to set whether xsd:base64Binary elements are
+// generated as []byte fields, as gowsdl used to, rather than as *soap.Binary
+// fields. Binary fields are sent as XOP attachments when the client is created
+// with soap.WithMTOM, and inline in base64 otherwise. It is disabled by
+// default.
+func WithBinaryBytes(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.binaryBytes = enabled
+	}
+}
+
+// WithServer is an Option to set whether a server interface and the
+// http.Handler serving it are generated for every port type, next to the
+// client. It is disabled by default.
+func WithServer(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.server = enabled
+	}
+}
+
+// WithMultiPackage is an Option to generate the types of every XML namespace
+// into a package of their own, placed in a subdirectory of the generated
+// package. importPath is the import path of the generated package, which keeps
+// the operations and imports the namespace packages from there.
+func WithMultiPackage(importPath string) Option {
+	return func(g *GoWSDL) {
+		g.importPath = strings.TrimSuffix(importPath, "/")
+	}
+}
+
+// WithSplitFiles is an Option to set whether the types of every XML namespace
+// are generated into a file of their own, named after the namespace, rather
+// than along with the operations. The helper types shared by all of them are
+// generated into common.go, and all the files belong to the same package. It
+// is disabled by default, and cannot be combined with WithMultiPackage.
+func WithSplitFiles(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.splitFiles = enabled
+	}
+}
+
+// WithConstructors is an Option to set whether a NewX constructor is generated
+// for every struct X of the request of a document style operation, presetting
+// its XMLName to the qualified name of the request element. Request types
+// whose XMLName the element does not name are given an untagged XMLName field.
+// It is disabled by default.
+func WithConstructors(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.constructors = enabled
+	}
+}
+
+// WithAccessors is an Option to set whether GetX and SetX methods are
+// generated for every optional field X of a struct holding a pointer to a
+// value, such as a *string. GetX returns the value, or the zero value if the
+// field or the struct is nil, and SetX points the field to a copy of its
+// argument. It is disabled by default.
+func WithAccessors(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.accessors = enabled
+	}
+}
+
+// WithCloneMethods is an Option to set whether Clone and Equal methods are
+// generated for every struct T. Clone returns a deep copy, sharing no pointer
+// or slice with t, and Equal compares the values of t and other field by field,
+// leaving their XMLName out, and taking nil and empty slices as equal. Fields
+// of interface types, holding the types derived by xsi:type, are copied and
+// compared as is. It is disabled by default.
+func WithCloneMethods(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.cloneMethods = enabled
+	}
+}
+
+// WithUnqualifiedTags is an Option to set whether the xml tags of the fields
+// of local elements and attributes are left without a namespace, as gowsdl
+// used to, rather than qualified as the elementFormDefault and
+// attributeFormDefault of their schema and their form say. Unqualified tags
+// match elements whatever their namespace when decoding, and are encoded in
+// the namespace of their parent. It is disabled by default.
+func WithUnqualifiedTags(enabled bool) Option {
+	return func(g *GoWSDL) {
+		g.unqualifiedTags = enabled
+	}
+}
+
+// WithRequiredElements is an Option to generate the fields of the elements
+// called names, by local name, without omitempty, so that they are encoded
+// even when empty, as for the elements whose minOccurs, one by default, is one
+// or more. It is meant for the alternatives of a choice, which are otherwise
+// left out when empty.
+func WithRequiredElements(names ...string) Option {
+	return func(g *GoWSDL) {
+		if g.requiredElements == nil {
+			g.requiredElements = make(map[string]bool)
+		}
+		for _, name := range names {
+			g.requiredElements[name] = true
+		}
+	}
 }
 
 var cacheDir = filepath.Join(os.TempDir(), "gowsdl-cache")
@@ -81,7 +244,7 @@ func downloadFile(url string, ignoreTLS bool) ([]byte, error) {
 }
 
 // NewGoWSDL initializes WSDL generator.
-func NewGoWSDL(file, pkg string, ignoreTLS bool, exportAllTypes bool) (*GoWSDL, error) {
+func NewGoWSDL(file, pkg string, ignoreTLS bool, exportAllTypes bool, opts ...Option) (*GoWSDL, error) {
 	file = strings.TrimSpace(file)
 	if file == "" {
 		return nil, errors.New("WSDL file is required to generate Go proxy")
@@ -101,19 +264,37 @@ func NewGoWSDL(file, pkg string, ignoreTLS bool, exportAllTypes bool) (*GoWSDL,
 		return nil, err
 	}
 
-	return &GoWSDL{
+	g := &GoWSDL{
 		loc:          r,
 		pkg:          pkg,
 		ignoreTLS:    ignoreTLS,
 		makePublicFn: makePublicFn,
-	}, nil
+		enumKind:     EnumKindString,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g, nil
 }
 
 // Start initiaties the code generation process by starting two goroutines: one
 // to generate types and another one to generate operations.
+//
+// In multi-package mode, the generated namespace packages are returned as
+// additional entries keyed by their file path, relative to the directory of
+// the generated package. Likewise, the files of WithSplitFiles are returned
+// keyed by their file name, and the types entry is then empty.
 func (g *GoWSDL) Start() (map[string][]byte, error) {
 	gocode := make(map[string][]byte)
 
+	if g.enumKind != EnumKindString && g.enumKind != EnumKindInt {
+		return nil, fmt.Errorf("unknown enum kind %q, expected %q or %q", g.enumKind, EnumKindString, EnumKindInt)
+	}
+	if g.splitFiles && g.importPath != "" {
+		return nil, errors.New("split files cannot be generated in multi-package mode")
+	}
+
 	err := g.unmarshal()
 	if err != nil {
 		return nil, err
@@ -124,13 +305,42 @@ func (g *GoWSDL) Start() (map[string][]byte, error) {
 		newTraverser(schema, g.wsdl.Types.Schemas).traverse()
 	}
 
+	if g.importPath != "" {
+		g.packages = namespacePackages(g.wsdl.Types.Schemas)
+		g.makePublicFn = makePublic
+	} else {
+		g.renames = typeRenames(g.wsdl.Types.Schemas)
+	}
+	g.portTypes = g.portTypeNames()
+	g.derived = derivedTypes(g.wsdl.Types.Schemas)
+	g.registered = registeredTypes(g.derived)
+	g.opsImports = make(map[string]bool)
+	g.rpcMessages = g.rpcMessageTypes()
+	if g.constructors {
+		g.requests = g.requestNames()
+	}
+	if g.validation {
+		g.validated = g.validatedTypes(g.wsdl.Types.Schemas)
+	}
+
 	var wg sync.WaitGroup
+	var files map[string][]byte
+	var filesErr error
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		var err error
 
+		if g.packages != nil {
+			files, filesErr = g.genPackages()
+			return
+		}
+		if g.splitFiles {
+			files, filesErr = g.genTypeFiles()
+			return
+		}
+
 		gocode["types"], err = g.genTypes()
 		if err != nil {
 			log.Println("genTypes", "error", err)
@@ -146,15 +356,35 @@ func (g *GoWSDL) Start() (map[string][]byte, error) {
 		if err != nil {
 			log.Println(err)
 		}
+
+		if g.server {
+			gocode["server"], err = g.genServer()
+			if err != nil {
+				log.Println(err)
+			}
+		}
 	}()
 
 	wg.Wait()
 
+	if filesErr != nil {
+		return nil, filesErr
+	}
+	for file, code := range files {
+		gocode[file] = code
+	}
+
 	gocode["header"], err = g.genHeader()
 	if err != nil {
 		log.Println(err)
 	}
 
+	if g.cloneMethods {
+		if err := genCloneMethods(gocode); err != nil {
+			return nil, err
+		}
+	}
+
 	return gocode, nil
 }
 
@@ -188,7 +418,7 @@ func (g *GoWSDL) unmarshal() error {
 		}
 	}
 
-	return nil
+	return g.resolveWSDLImports(g.wsdl, g.loc)
 }
 
 func (g *GoWSDL) resolveXSDExternals(schema *XSDSchema, loc *Location) error {
@@ -207,7 +437,7 @@ func (g *GoWSDL) resolveXSDExternals(schema *XSDSchema, loc *Location) error {
 		g.resolvedXSDExternals[schemaKey] = true
 
 		var data []byte
-		if data, err = g.fetchFile(location); err != nil {
+		if data, err = g.fetchReference(base, location); err != nil {
 			return err
 		}
 
@@ -215,7 +445,7 @@ func (g *GoWSDL) resolveXSDExternals(schema *XSDSchema, loc *Location) error {
 
 		err = xml.Unmarshal(data, newschema)
 		if err != nil {
-			return err
+			return fmt.Errorf("%s: %w", location, err)
 		}
 
 		if (len(newschema.Includes) > 0 || len(newschema.Imports) > 0) &&
@@ -234,6 +464,11 @@ func (g *GoWSDL) resolveXSDExternals(schema *XSDSchema, loc *Location) error {
 	}
 
 	for _, impts := range schema.Imports {
+		// The SOAP encoding types are built in.
+		if impts.Namespace == soapEncNamespace {
+			continue
+		}
+
 		// Download the file only if we have a hint in the form of schemaLocation.
 		if impts.SchemaLocation == "" {
 			log.Printf("[WARN] Don't know where to find XSD for %s", impts.Namespace)
@@ -255,8 +490,127 @@ func (g *GoWSDL) resolveXSDExternals(schema *XSDSchema, loc *Location) error {
 }
 
 func (g *GoWSDL) genTypes() ([]byte, error) {
+	return g.genSchemaTypes(g.wsdl.Types.Schemas, "", nil)
+}
+
+// genSchemaTypes generates the types declared by schemas, which belong to
+// package pkg. Types from namespaces generated into other packages are
+// qualified with their package name, which is then recorded in imports.
+func (g *GoWSDL) genSchemaTypes(schemas []*XSDSchema, pkg string, imports map[string]bool) ([]byte, error) {
+	data := new(bytes.Buffer)
+	for _, schema := range schemas {
+		if err := g.genSchema(data, schema, pkg, imports); err != nil {
+			return nil, err
+		}
+	}
+
+	return data.Bytes(), nil
+}
+
+func (g *GoWSDL) genSchema(data *bytes.Buffer, schema *XSDSchema, pkg string, imports map[string]bool) error {
+	goType := func(xsdType string) string {
+		namespace := resolveNamespace(schema, xsdType)
+		if namespace == soapEncNamespace {
+			return soapEncToGoType(xsdType)
+		}
+		if renamed, ok := g.renames[namespace][stripns(xsdType)]; ok {
+			return "*" + renamed
+		}
+		return g.qualifyGoType(toGoType(xsdType), namespace, pkg, imports)
+	}
+	typeName := func(name string) string {
+		if renamed, ok := g.renames[schema.TargetNamespace][name]; ok {
+			return renamed
+		}
+		return g.makePublicFn(replaceReservedWords(name))
+	}
+	// Fields of an abstract type with derivations hold the wrapper decoding
+	// the derived type their xsi:type names, and base64Binary fields the
+	// soap.Binary taking part in MTOM.
+	fieldType := func(xsdType string) string {
+		name := xml.Name{Space: resolveNamespace(schema, xsdType), Local: stripns(xsdType)}
+		if strings.EqualFold(name.Local, "base64Binary") && goType(xsdType) == "[]byte" && !g.binaryBytes {
+			return "*soap.Binary"
+		}
+		if len(g.derived[name]) > 0 {
+			return goType(xsdType) + "Value"
+		}
+		return goType(xsdType)
+	}
+	derivations := func(name string) []string {
+		var names []string
+		for _, derived := range g.derived[xml.Name{Space: schema.TargetNamespace, Local: name}] {
+			names = append(names, derived.Local)
+		}
+		return names
+	}
+	xsiType := func(name string) bool {
+		return g.registered[xml.Name{Space: schema.TargetNamespace, Local: name}]
+	}
+	// Fixed attributes of named structs are generated as types of their own.
+	fixedTypes := make(map[*XSDAttribute]string)
+	extras := func(name string, ct *XSDComplexType, xmlName *xml.Name) *attributeExtras {
+		fixed := fixedAttributes(name, ct)
+		defaults := attributeDefaults(ct, goType)
+		if len(fixed) == 0 && len(defaults) == 0 && xmlName == nil {
+			return nil
+		}
+		return &attributeExtras{Name: name, Fixed: fixed, Defaults: defaults, XMLName: xmlName}
+	}
+	markFixed := func(name string, ct *XSDComplexType) {
+		for _, fixed := range fixedAttributes(name, ct) {
+			fixedTypes[fixed.attr] = fixed.TypeName
+		}
+	}
+	for _, ct := range schema.ComplexTypes {
+		markFixed(typeName(ct.Name), ct)
+	}
+	for _, el := range schema.Elements {
+		if el.Type == "" && el.ComplexType != nil {
+			markFixed(typeName(el.Name), el.ComplexType)
+		}
+	}
+
+	typeFacets := func(restriction XSDRestriction) *facets {
+		if !g.validation || g.intEnum(restriction) {
+			return nil
+		}
+		return restrictionFacets(restriction)
+	}
+	validation := func(name string, ct *XSDComplexType) *validatedType {
+		if !g.validation {
+			return nil
+		}
+		fields := g.validatedFields(schema, ct, g.validated)
+		if len(fields) == 0 {
+			return nil
+		}
+		return &validatedType{Name: name, Fields: fields}
+	}
+
+	// Nillable elements that are always present hold the nillable type of
+	// their Go type.
+	fieldElementType := func(goType string, el *XSDElement) string {
+		if isNillable(el) {
+			return g.nillableType(pkg, goType)
+		}
+		return elementType(goType, el)
+	}
+
+	optionalFields := func(name string, ct *XSDComplexType) *accessorsType {
+		if !g.accessors {
+			return nil
+		}
+		fields := accessors(ct, fieldType)
+		if len(fields) == 0 {
+			return nil
+		}
+		return &accessorsType{Name: name, Accessors: fields}
+	}
+
 	funcMap := template.FuncMap{
-		"toGoType":                 toGoType,
+		"toGoType":                 goType,
+		"typeName":                 typeName,
 		"stripns":                  stripns,
 		"replaceReservedWords":     replaceReservedWords,
 		"replaceAttrReservedWords": replaceAttrReservedWords,
@@ -268,16 +622,28 @@ func (g *GoWSDL) genTypes() ([]byte, error) {
 		"goString":                 goString,
 		"findNameByType":           g.findNameByType,
 		"removePointerFromType":    removePointerFromType,
+		"elementType":              fieldElementType,
+		"isRepeated":               isRepeated,
+		"jsonTag":                  g.jsonTag,
+		"facets":                   typeFacets,
+		"validation":               validation,
+		"accessors":                optionalFields,
+		"makePrivate":              makePrivate,
+		"intEnum":                  g.intEnum,
+		"fieldType":                fieldType,
+		"derivedTypes":             derivations,
+		"xsiType":                  xsiType,
+		"fixedType":                func(attr *XSDAttribute) string { return fixedTypes[attr] },
+		"omitEmpty":                g.omitEmpty,
+		"elementNS":                func(el *XSDElement) string { return g.namespacePrefix(el.namespace) },
+		"attributeNS":              func(attr *XSDAttribute) string { return g.namespacePrefix(attr.namespace) },
+		"attributeExtras":          extras,
+		"requestElement":           func(name string) *xml.Name { return g.requestElement(schema, name) },
+		"requestType":              func(name string) *xml.Name { return g.requestType(schema, name) },
 	}
 
-	data := new(bytes.Buffer)
 	tmpl := template.Must(template.New("types").Funcs(funcMap).Parse(typesTmpl))
-	err := tmpl.Execute(data, g.wsdl.Types)
-	if err != nil {
-		return nil, err
-	}
-
-	return data.Bytes(), nil
+	return tmpl.Execute(data, &WSDLType{Schemas: []*XSDSchema{schema}})
 }
 
 func (g *GoWSDL) genOperations() ([]byte, error) {
@@ -290,11 +656,23 @@ func (g *GoWSDL) genOperations() ([]byte, error) {
 		"makePrivate":          makePrivate,
 		"findType":             g.findType,
 		"findSOAPAction":       g.findSOAPAction,
+		"findRPCWrapper":       g.findRPCWrapper,
+		"findPartElement":      g.findPartElement,
 		"findServiceAddress":   g.findServiceAddress,
+		"packageQualify":       g.packageQualify,
+		"findSOAPHeaders":      g.findSOAPHeaders,
+		"operationParams":      operationParams,
+		"portTypeName":         g.portTypeName,
+		"jsonTag":              g.jsonTag,
 	}
 
 	data := new(bytes.Buffer)
-	tmpl := template.Must(template.New("operations").Funcs(funcMap).Parse(opsTmpl))
+	tmpl := template.Must(template.New("rpc").Funcs(funcMap).Parse(rpcTmpl))
+	if err := tmpl.Execute(data, g.rpcMessages); err != nil {
+		return nil, err
+	}
+
+	tmpl = template.Must(template.New("operations").Funcs(funcMap).Parse(opsTmpl))
 	err := tmpl.Execute(data, g.wsdl.PortTypes)
 	if err != nil {
 		return nil, err
@@ -303,7 +681,39 @@ func (g *GoWSDL) genOperations() ([]byte, error) {
 	return data.Bytes(), nil
 }
 
+// genServer generates the server interfaces and handlers of the port types.
+func (g *GoWSDL) genServer() ([]byte, error) {
+	funcMap := template.FuncMap{
+		"replaceReservedWords": replaceReservedWords,
+		"makePublic":           g.makePublicFn,
+		"findType":             g.findType,
+		"findSOAPAction":       g.findSOAPAction,
+		"findInputElement":     g.findInputElement,
+		"packageQualify":       g.packageQualify,
+		"portTypeName":         g.portTypeName,
+	}
+
+	data := new(bytes.Buffer)
+	tmpl := template.Must(template.New("server").Funcs(funcMap).Parse(serverTmpl))
+	if err := tmpl.Execute(data, g.wsdl.PortTypes); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
 func (g *GoWSDL) genHeader() ([]byte, error) {
+	return g.genPackageHeader(g.pkg, g.opsImports, true, !g.splitFiles)
+}
+
+// genPackageHeader generates the package clause and imports of a file of
+// package pkg, which imports the given namespace packages, followed by the
+// helper types of the package if helpers is set.
+func (g *GoWSDL) genPackageHeader(pkg string, imports map[string]bool, operations, helpers bool) ([]byte, error) {
+	var importPaths []string
+	for _, name := range sortedKeys(imports) {
+		importPaths = append(importPaths, g.importPath+"/"+name)
+	}
+
 	funcMap := template.FuncMap{
 		"toGoType":             toGoType,
 		"stripns":              stripns,
@@ -314,9 +724,24 @@ func (g *GoWSDL) genHeader() ([]byte, error) {
 		"comment":              comment,
 	}
 
+	// The types of the main package are generated without a package name.
+	typesPkg := pkg
+	if g.packages == nil {
+		typesPkg = ""
+	}
+
 	data := new(bytes.Buffer)
 	tmpl := template.Must(template.New("header").Funcs(funcMap).Parse(headerTmpl))
-	err := tmpl.Execute(data, g.pkg)
+	err := tmpl.Execute(data, struct {
+		Pkg        string
+		Imports    []string
+		Operations bool
+		Validation bool
+		IntEnums   bool
+		Server     bool
+		Helpers    bool
+		Nillables  []nillableType
+	}{pkg, importPaths, operations, g.validation, g.enumKind == EnumKindInt, operations && g.server, helpers, g.nillableTypes(typesPkg)})
 	if err != nil {
 		return nil, err
 	}
@@ -439,9 +864,37 @@ var xsd2GoTypes = map[string]string{
 	"unsignedshort": "uint16",
 	"unsignedbyte":  "byte",
 	"unsignedlong":  "uint64",
-	"anytype":       "AnyType",
+	"anytype":       "soap.AnyXML",
 	"ncname":        "NCName",
-	"anyuri":        "AnyURI",
+	"anyuri":        "soap.AnyURI",
+	"gyear":         "soap.GYear",
+	"gyearmonth":    "soap.GYearMonth",
+	"gmonth":        "soap.GMonth",
+	"gday":          "soap.GDay",
+	"gmonthday":     "soap.GMonthDay",
+}
+
+const soapEncNamespace = "http://schemas.xmlsoap.org/soap/encoding/"
+
+// soapEnc2GoTypes maps the types of the SOAP encoding namespace, which is never
+// fetched as an external schema, that have no XML Schema counterpart.
+var soapEnc2GoTypes = map[string]string{
+	"array":  "*soap.EncodedArray",
+	"struct": "*soap.EncodedStruct",
+	"base64": "[]byte",
+}
+
+// soapEncToGoType maps a type of the SOAP encoding namespace to a Go type. Most
+// of them mirror the XML Schema built-in types.
+func soapEncToGoType(xsdType string) string {
+	t := strings.ToLower(removeNS(xsdType))
+	if value, ok := soapEnc2GoTypes[t]; ok {
+		return value
+	}
+	if value, ok := xsd2GoTypes[t]; ok {
+		return value
+	}
+	return "string"
 }
 
 func removeNS(xsdType string) string {
@@ -455,6 +908,10 @@ func removeNS(xsdType string) string {
 	return r[0]
 }
 
+// toGoType maps an XSD type to a Go type. Types declared by the schemas are
+// always referenced through a pointer. The generator does not look for cycles
+// in the type graph, so a field holding a named type by value could make a
+// self referencing type invalid.
 func toGoType(xsdType string) string {
 	// Handles name space, ie. xsd:string, xs:string
 	r := strings.Split(xsdType, ":")
@@ -474,6 +931,52 @@ func toGoType(xsdType string) string {
 	return "*" + replaceReservedWords(makePublic(t))
 }
 
+// elementType returns the Go type of the field generated for an element whose
+// schema type maps to goType. Repeated elements become slices, while optional
+// and nillable ones become pointers so that an absent or nil element can be
+// told apart from one holding the zero value. The fields of nillable elements
+// that are always present hold a nillable type instead, see isNillable.
+func elementType(goType string, el *XSDElement) string {
+	if isRepeated(el.MaxOccurs) {
+		return "[]" + goType
+	}
+	if el.MinOccurs != "0" && !el.Nillable {
+		return goType
+	}
+	if strings.HasPrefix(goType, "*") || strings.HasPrefix(goType, "[]") {
+		return goType
+	}
+	return "*" + goType
+}
+
+// omitEmpty returns the omitempty option of the xml tag of the field generated
+// for el, which is left out for required elements, so that their empty values
+// are still encoded as empty elements, and for nillable ones, which are always
+// encoded. Repeated elements keep it, as an empty slice encodes no element
+// either way.
+func (g *GoWSDL) omitEmpty(el *XSDElement) string {
+	name := el.Name
+	if el.Ref != "" {
+		name = stripns(el.Ref)
+	}
+	if !isRepeated(el.MaxOccurs) && (isRequired(el) || isNillable(el) || g.requiredElements[name]) {
+		return ""
+	}
+	return ",omitempty"
+}
+
+// jsonTag returns the json struct tag, including its leading space, for a field
+// holding the XML node called name. The names "-" and "-," are emitted verbatim.
+func (g *GoWSDL) jsonTag(name string) string {
+	if !g.jsonTags {
+		return ""
+	}
+	if name == "-" || name == "-," {
+		return fmt.Sprintf(` json:"%s"`, name)
+	}
+	return fmt.Sprintf(` json:"%s,omitempty"`, name)
+}
+
 func removePointerFromType(goType string) string {
 	return regexp.MustCompile("^\\s*\\*").ReplaceAllLiteralString(goType, "")
 }
@@ -484,6 +987,33 @@ func removePointerFromType(goType string) string {
 // it works for now and performance doesn't
 // seem critical at this point
 func (g *GoWSDL) findType(message string) string {
+	if m := g.findRPCMessage(message); m != nil {
+		return m.Name
+	}
+	namespace, name := g.findMessageType(message)
+	if renamed, ok := g.renames[namespace][name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// packageQualify prefixes goType, the type found for message, with the package
+// it is generated into in multi-package mode.
+func (g *GoWSDL) packageQualify(message, goType string) string {
+	if g.packages == nil || goType == "" || g.findRPCMessage(message) != nil {
+		return goType
+	}
+	namespace, _ := g.findMessageType(message)
+	if namespace == xmlschema11 {
+		// The part is an element of a built-in type, whose Go type is
+		// declared by the schema of the element.
+		namespace = g.messageElementNamespace(message)
+	}
+	return strings.TrimPrefix(g.qualifyGoType("*"+goType, namespace, g.pkg, g.opsImports), "*")
+}
+
+// findMessageType returns the namespace and name of the type of a message.
+func (g *GoWSDL) findMessageType(message string) (string, string) {
 	message = stripns(message)
 
 	for _, msg := range g.wsdl.Messages {
@@ -500,20 +1030,26 @@ func (g *GoWSDL) findType(message string) string {
 			continue
 		}
 
-		part := msg.Parts[0]
-		if part.Type != "" {
-			return stripns(part.Type)
+		if namespace, name := g.partType(msg.Parts[0]); name != "" {
+			return namespace, name
 		}
+	}
+	return "", ""
+}
 
-		elRef := stripns(part.Element)
-
+// messageElementNamespace returns the target namespace of the schema declaring
+// the element of the first part of message.
+func (g *GoWSDL) messageElementNamespace(message string) string {
+	message = stripns(message)
+	for _, msg := range g.wsdl.Messages {
+		if msg.Name != message || len(msg.Parts) == 0 || msg.Parts[0].Element == "" {
+			continue
+		}
+		elRef := stripns(msg.Parts[0].Element)
 		for _, schema := range g.wsdl.Types.Schemas {
 			for _, el := range schema.Elements {
 				if strings.EqualFold(elRef, el.Name) {
-					if el.Type != "" {
-						return stripns(el.Type)
-					}
-					return el.Name
+					return schema.TargetNamespace
 				}
 			}
 		}
@@ -521,6 +1057,111 @@ func (g *GoWSDL) findType(message string) string {
 	return ""
 }
 
+// partType returns the namespace and name of the type of a message part.
+func (g *GoWSDL) partType(part *WSDLPart) (string, string) {
+	if part.Type != "" {
+		return g.wsdl.Xmlns[strings.SplitN(part.Type, ":", 2)[0]], stripns(part.Type)
+	}
+
+	elRef := stripns(part.Element)
+
+	for _, schema := range g.wsdl.Types.Schemas {
+		for _, el := range schema.Elements {
+			if strings.EqualFold(elRef, el.Name) {
+				if el.Type != "" {
+					return resolveNamespace(schema, el.Type), stripns(el.Type)
+				}
+				return schema.TargetNamespace, el.Name
+			}
+		}
+	}
+	return "", ""
+}
+
+// soapHeader is a header part that the binding of an operation declares for
+// its input, passed to the generated method as a parameter.
+type soapHeader struct {
+	Name string
+	Type string
+}
+
+// findSOAPHeaders returns the headers of the input of operation, as declared
+// by the binding of portType.
+func (g *GoWSDL) findSOAPHeaders(operation, portType string) []soapHeader {
+	var headers []soapHeader
+	for _, binding := range g.wsdl.Binding {
+		if strings.ToUpper(stripns(binding.Type)) != strings.ToUpper(portType) {
+			continue
+		}
+
+		for _, soapOp := range binding.Operations {
+			if soapOp.Name != operation {
+				continue
+			}
+
+			for _, header := range soapOp.Input.SOAPHeader {
+				part := g.findMessagePart(header.Message, header.Part)
+				if part == nil {
+					log.Printf("[WARN] header part %s of message %s not found, ignoring header...", header.Part, header.Message)
+					continue
+				}
+
+				namespace, name := g.partType(part)
+				goType := replaceReservedWords(makePublic(name))
+				if renamed, ok := g.renames[namespace][name]; ok {
+					goType = renamed
+				}
+				if g.packages != nil {
+					goType = strings.TrimPrefix(g.qualifyGoType("*"+goType, namespace, g.pkg, g.opsImports), "*")
+				}
+
+				headers = append(headers, soapHeader{Name: headerParamName(part.Name), Type: goType})
+			}
+			return headers
+		}
+	}
+	return headers
+}
+
+// operationParams returns the parameters of a generated operation method, the
+// request, if any, followed by the headers.
+func operationParams(requestType string, headers []soapHeader) string {
+	var params []string
+	if requestType != "" {
+		params = append(params, "request *"+requestType)
+	}
+	for _, header := range headers {
+		params = append(params, header.Name+" *"+header.Type)
+	}
+	return strings.Join(params, ", ")
+}
+
+// headerParamName returns the parameter name of a header part, which must not
+// shadow the other identifiers of the generated method.
+func headerParamName(part string) string {
+	name := replaceReservedWords(makePrivate(normalize(part)))
+	switch name {
+	case "ctx", "request", "response", "err", "service", "context", "soap":
+		name += "Header"
+	}
+	return name
+}
+
+func (g *GoWSDL) findMessagePart(message, part string) *WSDLPart {
+	message = stripns(message)
+	for _, msg := range g.wsdl.Messages {
+		if msg.Name != message {
+			continue
+		}
+		for _, p := range msg.Parts {
+			if p.Name == part {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
 // Given a type, check if there's SimpleType with that type, and return its name.
 func (g *GoWSDL) findNameByType(name string) string {
 	name = stripns(name)
@@ -551,6 +1192,112 @@ func (g *GoWSDL) findSOAPAction(operation, portType string) string {
 	return ""
 }
 
+// findRPCWrapper returns the xml tag of the operation element sent as the body
+// of operation when its binding for portType is rpc style and message, its
+// input, has no parts. It returns an empty string otherwise, including for
+// document style bindings, whose body is the part element.
+func (g *GoWSDL) findRPCWrapper(operation, portType, message string) string {
+	for _, msg := range g.wsdl.Messages {
+		if msg.Name == stripns(message) && len(msg.Parts) > 0 {
+			return ""
+		}
+	}
+	return g.rpcOperationElement(operation, portType)
+}
+
+// findPartElement returns the xml tag of the body element of message, sent
+// for operation by document style bindings of portType, when the type of its
+// part does not marshal as that element, or an empty string. A part naming a
+// type is sent as an unqualified element named after the part, and a part
+// naming a global element whose type another element claims is sent as the
+// global element.
+func (g *GoWSDL) findPartElement(operation, portType, message string) string {
+	if g.rpcOperationElement(operation, portType) != "" {
+		return ""
+	}
+
+	for _, msg := range g.wsdl.Messages {
+		if msg.Name != stripns(message) || len(msg.Parts) == 0 {
+			continue
+		}
+		// Built-in types are not generated, so they marshal as any element.
+		part := msg.Parts[0]
+		namespace, name := g.partType(part)
+		if name == "" || namespace == xmlschema11 {
+			return ""
+		}
+		if part.Type != "" {
+			return part.Name
+		}
+
+		element := stripns(part.Element)
+		if name != element && g.findNameByType(name) != element {
+			return g.wsdl.Xmlns[strings.SplitN(part.Element, ":", 2)[0]] + " " + element
+		}
+	}
+	return ""
+}
+
+// rpcOperationElement returns the xml tag of the operation element of rpc
+// style bindings of portType, or an empty string for document style ones.
+func (g *GoWSDL) rpcOperationElement(operation, portType string) string {
+	for _, binding := range g.wsdl.Binding {
+		if strings.ToUpper(stripns(binding.Type)) != strings.ToUpper(portType) {
+			continue
+		}
+
+		for _, soapOp := range binding.Operations {
+			if soapOp.Name != operation {
+				continue
+			}
+
+			style := soapOp.SOAPOperation.Style
+			if style == "" {
+				style = binding.SOAPBinding.Style
+			}
+			if style != "rpc" {
+				return ""
+			}
+
+			namespace := soapOp.Input.SOAPBody.Namespace
+			if namespace == "" {
+				namespace = g.wsdl.TargetNamespace
+			}
+			return strings.TrimSpace(namespace + " " + operation)
+		}
+	}
+	return ""
+}
+
+// findInputElement returns the name of the body element of the requests of
+// operation, whose input is message, as bound for portType: the operation
+// element of rpc style bindings, and the element of the part otherwise.
+func (g *GoWSDL) findInputElement(operation, portType, message string) xml.Name {
+	if tag := g.rpcOperationElement(operation, portType); tag != "" {
+		return rpcElementName(tag)
+	}
+
+	for _, msg := range g.wsdl.Messages {
+		if msg.Name != stripns(message) || len(msg.Parts) == 0 {
+			continue
+		}
+		part := msg.Parts[0]
+		if part.Element != "" {
+			return xml.Name{Space: g.wsdl.Xmlns[strings.SplitN(part.Element, ":", 2)[0]], Local: stripns(part.Element)}
+		}
+	}
+	return xml.Name{}
+}
+
+// rpcElementName returns the name of the operation element whose xml tag,
+// as returned by rpcOperationElement, is tag.
+func rpcElementName(tag string) xml.Name {
+	if i := strings.LastIndex(tag, " "); i >= 0 {
+		return xml.Name{Space: tag[:i], Local: tag[i+1:]}
+	}
+	return xml.Name{Local: tag}
+}
+
 func (g *GoWSDL) findServiceAddress(name string) string {
 	for _, service := range g.wsdl.Service {
 		for _, port := range service.Ports {
@@ -8,13 +8,17 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"go/ast"
 	"go/format"
+	"go/importer"
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -59,13 +63,743 @@ func TestComplexTypeWithInlineSimpleType(t *testing.T) {
 	expected := `type GetInfo struct {
 	XMLName	xml.Name	` + "`" + `xml:"http://www.mnb.hu/webservices/ GetInfo"` + "`" + `
 
-	Id	string	` + "`" + `xml:"Id,omitempty" json:"Id,omitempty"` + "`" + `
+	Id	string	` + "`" + `xml:"http://www.mnb.hu/webservices/ Id"` + "`" + `
 }`
 	if actual != expected {
 		t.Error("got " + actual + " want " + expected)
 	}
 }
 
+func TestOptionalAndNillableElementsArePointers(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/optional.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := getTypeDeclaration(resp, "StockLevel")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `type StockLevel struct {
+	XMLName	xml.Name	` + "`" + `xml:"http://example.com/inventory.xsd StockLevel"` + "`" + `
+
+	Sku	string	` + "`" + `xml:"sku"` + "`" + `
+
+	Quantity	int32	` + "`" + `xml:"quantity"` + "`" + `
+
+	Reserved	*int32	` + "`" + `xml:"reserved,omitempty"` + "`" + `
+
+	Discontinued	NillableBool	` + "`" + `xml:"discontinued"` + "`" + `
+
+	Warehouses	[]string	` + "`" + `xml:"warehouses,omitempty"` + "`" + `
+}`
+	if actual != expected {
+		t.Error("got \n" + actual + " want \n" + expected)
+	}
+}
+
+func TestJSONTags(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/test.wsdl", "myservice", false, true, WithJSONTags(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := getTypeDeclaration(resp, "GetInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `type GetInfo struct {
+	XMLName	xml.Name	` + "`" + `xml:"http://www.mnb.hu/webservices/ GetInfo" json:"-"` + "`" + `
+
+	Id	string	` + "`" + `xml:"http://www.mnb.hu/webservices/ Id" json:"Id,omitempty"` + "`" + `
+}`
+	if actual != expected {
+		t.Error("got " + actual + " want " + expected)
+	}
+}
+
+func TestCrossNamespaceTypeNameCollision(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/collision.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"Billing *Address `",
+		"Shipping *ShippingAddress `",
+		"type ShippingAddress struct",
+		"type ShippingConfirmation struct",
+		`XMLName xml.Name ` + "`" + `xml:"http://example.com/shipping.xsd Confirmation"` + "`",
+	} {
+		if !strings.Contains(string(resp["types"]), expected) {
+			t.Errorf("expected %s in generated types", expected)
+		}
+	}
+
+	actual, err := getTypeDeclaration(resp, "Address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(actual, "Iban string") {
+		t.Errorf("the type declared first should keep its name, got %s", actual)
+	}
+
+	// Renaming is stable across runs.
+	for i := 0; i < 5; i++ {
+		g, err := NewGoWSDL("fixtures/collision.wsdl", "myservice", false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := g.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again["types"], resp["types"]) {
+			t.Fatal("generated types differ across runs")
+		}
+	}
+}
+
+func TestUnqualifiedTypeInDefaultNamespace(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/defaultnamespace.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := getTypeDeclaration(resp, "PlaceOrder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The unqualified Item is the imported one, in the default namespace,
+	// not the Item of the target namespace.
+	for _, expected := range []string{"Product\t*Item\t", "Line\t*OrdersItem\t"} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q in %s", expected, actual)
+		}
+	}
+}
+
+func TestSchemaNamespaceEqualsWSDLNamespace(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/samenamespace.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := getTypeDeclaration(resp, "Weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(actual, "Temperature") {
+		t.Errorf("the schema type should keep its name, got %s", actual)
+	}
+
+	for _, expected := range []string{
+		"type WeatherPortType interface",
+		"func NewWeatherPortType(client *soap.Client) WeatherPortType",
+		`service.client.CallContext(ctx, "http://example.com/weather/GetWeather", request, response)`,
+	} {
+		if !strings.Contains(string(resp["operations"]), expected) {
+			t.Errorf("expected %s in generated operations", expected)
+		}
+	}
+}
+
+func TestFacetValidation(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/validation.wsdl", "myservice", false, true, WithValidation(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	types := string(resp["types"])
+	for _, expected := range []string{
+		"func (v Code) Validate() error",
+		"var codePattern = regexp.MustCompile(\"^(?:[A-Z]+)$\")",
+		"n != 3",
+		"violating maxLength 10",
+		"if v > 100 {",
+		"func (t *Item) Validate() error",
+		"return fmt.Errorf(\"tags[%d]: %v\", i, err)",
+		"return fmt.Errorf(\"currency: %v\", err)",
+		"if err := t.Item.Validate(); err != nil {",
+		"func (t *PlaceOrder) Validate() error",
+	} {
+		if !strings.Contains(types, expected) {
+			t.Errorf("expected %s in generated types", expected)
+		}
+	}
+	if strings.Contains(types, "func (t *PlaceOrderResponse) Validate() error") {
+		t.Error("types without validated fields should not get a Validate method")
+	}
+
+	g, err = NewGoWSDL("fixtures/validation.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(resp["types"]), "Validate()") || strings.Contains(string(resp["header"]), "regexp") {
+		t.Error("validation should be disabled by default")
+	}
+}
+
+func TestAnyURIValidation(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/validation.wsdl", "main", false, true, WithValidation(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := getTypeDeclaration(resp, "Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual = strings.Replace(actual, "\t", " ", -1)
+	for _, field := range []string{"Link soap.AnyURI", "Image soap.AnyURI"} {
+		if !strings.Contains(actual, field) {
+			t.Errorf("expected field %s in\n%s", field, actual)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import "fmt"
+
+func main() {
+	for _, item := range []*Item{
+		{Link: "http://example.com/items/1?size=large#top"},
+		{Link: "../items/1", Image: "urn:isbn:0451450523"},
+		{Link: "http://[::1"},
+		{Link: "http://example.com/", Image: "%zz"},
+	} {
+		fmt.Println(item.Validate())
+	}
+}
+`
+
+	expected := `<nil>
+<nil>
+link: invalid anyURI: parse "http://[::1": missing ']' in host
+image: invalid anyURI: parse "%zz": invalid URL escape "%zz"
+`
+	if output := runGenerated(t, resp, program); output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
+	}
+}
+
+func TestGregorianTypes(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/gregorian.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := getTypeDeclaration(resp, "PlaceOrder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual = strings.Replace(actual, "\t", " ", -1)
+	for _, field := range []string{
+		"FiscalYear soap.GYear",
+		"Period soap.GYearMonth",
+		"Month *soap.GMonth",
+		"Day soap.GDay",
+		"Anniversary soap.GMonthDay",
+		"Since soap.GYearMonth",
+	} {
+		if !strings.Contains(actual, field) {
+			t.Errorf("expected field %s in\n%s", field, actual)
+		}
+	}
+}
+
+func TestBindingSOAPHeaders(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/headers.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	operations := string(resp["operations"])
+	for _, expected := range []string{
+		"GetBalance (request *GetBalance, auth *AuthHeader, trace *TraceHeader) (*GetBalanceResponse, error)",
+		"GetBalanceContext (ctx context.Context, request *GetBalance, auth *AuthHeader, trace *TraceHeader) (*GetBalanceResponse, error)",
+		"ctx = soap.ContextWithHeaders(ctx, auth, trace)",
+		"Logout (auth *AuthHeader) (error)",
+		"ctx = soap.ContextWithHeaders(ctx, auth)",
+	} {
+		if !strings.Contains(operations, expected) {
+			t.Errorf("expected %s in generated operations", expected)
+		}
+	}
+}
+
+func TestMultiPackageGeneration(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/multipackage.wsdl", "crm", false, true, WithMultiPackage("example.com/crm"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp["types"]) != 0 {
+		t.Errorf("types should be generated into namespace packages, got\n%s", resp["types"])
+	}
+
+	for _, file := range []string{"address/address.go", "customer/customer.go"} {
+		if _, ok := resp[file]; !ok {
+			t.Fatalf("package file %s was not generated", file)
+		}
+	}
+
+	if !strings.Contains(string(resp["header"]), `"example.com/crm/customer"`) {
+		t.Errorf("main package should import the customer package, got\n%s", resp["header"])
+	}
+	if strings.Contains(string(resp["header"]), `"example.com/crm/address"`) {
+		t.Errorf("main package should not import the unused address package, got\n%s", resp["header"])
+	}
+	if !strings.Contains(string(resp["operations"]), "request *customer.GetCustomer) (*customer.Customer, error)") {
+		t.Errorf("operations should use the customer package types, got\n%s", resp["operations"])
+	}
+
+	// Type check both packages, with customer importing address.
+	fset := token.NewFileSet()
+	checked := make(map[string]*types.Package)
+	imp := importerFunc(func(path string) (*types.Package, error) {
+		if pkg, ok := checked[path]; ok {
+			return pkg, nil
+		}
+		return sourceImporter.Import(path)
+	})
+	for _, name := range []string{"address", "customer"} {
+		f, err := parser.ParseFile(fset, name+".go", resp[name+"/"+name+".go"], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := types.Config{Importer: imp}
+		pkg, err := conf.Check("example.com/crm/"+name, fset, []*ast.File{f}, nil)
+		if err != nil {
+			t.Fatalf("package %s doesn't compile: %v", name, err)
+		}
+		checked[pkg.Path()] = pkg
+	}
+
+	billing := checked["example.com/crm/customer"].Scope().Lookup("Customer").Type().Underlying().(*types.Struct).Field(2)
+	if got := billing.Type().String(); got != "*example.com/crm/address.PostalAddress" {
+		t.Errorf("got billing type %s wanted *example.com/crm/address.PostalAddress", got)
+	}
+}
+
+func TestMultiPackageFixturesCompile(t *testing.T) {
+	files, err := filepath.Glob("fixtures/*.wsdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		g, err := NewGoWSDL(file, "myservice", false, true, WithMultiPackage("example.com/myservice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := g.Start()
+		if err != nil {
+			// Fixtures that cannot be generated in a single package either,
+			// such as those referencing missing schemas, are skipped.
+			if single, err := NewGoWSDL(file, "myservice", false, true); err == nil {
+				if _, err := single.Start(); err != nil {
+					continue
+				}
+			}
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+
+		if err := typeCheckPackages(resp, "example.com/myservice"); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
+
+func TestSplitFiles(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/elementrefs.wsdl", "myservice", false, true, WithSplitFiles(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp["types"]) != 0 {
+		t.Errorf("types should be generated into namespace files, got\n%s", resp["types"])
+	}
+	if strings.Contains(string(resp["header"]), "type AnyType") {
+		t.Errorf("helper types should be generated into common.go, got\n%s", resp["header"])
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "myservice.go", string(resp["header"])+string(resp["operations"]), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []*ast.File{f}
+	for name, want := range map[string]string{
+		"common.go":       "type AnyType = soap.AnyXML",
+		"types_common.go": "type Customer struct",
+		"types_orders.go": "type Order struct",
+	} {
+		code, ok := resp[name]
+		if !ok {
+			t.Fatalf("file %s was not generated", name)
+		}
+		if !strings.Contains(string(code), want) {
+			t.Errorf("file %s should declare %s, got\n%s", name, want, code)
+		}
+		f, err := parser.ParseFile(fset, name, code, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	conf := types.Config{Importer: sourceImporter}
+	if _, err := conf.Check("myservice", fset, files, nil); err != nil {
+		t.Errorf("split files don't compile: %v", err)
+	}
+}
+
+func TestMultiPackageImportCycle(t *testing.T) {
+	err := checkImportCycles(map[string]map[string]bool{
+		"order":    {"customer": true},
+		"customer": {"address": true},
+		"address":  {"order": true},
+	})
+	if err == nil {
+		t.Fatal("expected an import cycle error")
+	}
+	if !strings.Contains(err.Error(), "address -> order -> customer -> address") {
+		t.Errorf("cycle should be reported, got: %v", err)
+	}
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// TestNamedTypesReferencedByPointer is a regression check for the pointers
+// toGoType puts in front of named types, using self and mutually referencing
+// types. It does not cover cycle detection, which the generator lacks.
+func TestNamedTypesReferencedByPointer(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/recursive.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := getTypeDeclaration(resp, "Category")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"Parent\t*Category", "Children\t[]*Category", "Category *Category"} {
+		if !strings.Contains(actual, field) {
+			t.Errorf("recursive field %q should be a pointer or a slice, got\n%s", field, actual)
+		}
+	}
+}
+
+func TestSOAPPackageImportPath(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/recursive.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The generated code must import the soap package of this module, rather
+	// than the one of the upstream repository it was forked from.
+	mod, err := ioutil.ReadFile("go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := strings.TrimPrefix(strings.SplitN(string(mod), "\n", 2)[0], "module ")
+	if expected := `"` + module + `/soap"`; !strings.Contains(string(resp["header"]), expected) {
+		t.Errorf("header should import %s, got\n%s", expected, resp["header"])
+	}
+}
+
+func TestSOAPEncodingImport(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/soapenc.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The SOAP encoding namespace must be resolved from the built-in types,
+	// instead of being downloaded from its schemaLocation.
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := getTypeDeclaration(resp, "Document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"Title\tstring", "Pages\tint32", "Content\t[]byte", "Tags\t*ArrayOfString", "Properties\t*soap.EncodedStruct"} {
+		if !strings.Contains(actual, field) {
+			t.Errorf("field %q is missing, got\n%s", field, actual)
+		}
+	}
+
+	actual, err = getTypeDeclaration(resp, "ArrayOfString")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(actual, "*soap.EncodedArray") {
+		t.Errorf("ArrayOfString should embed soap.EncodedArray, got\n%s", actual)
+	}
+}
+
+func TestListAndUnionSimpleTypes(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/lists.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"ListOfInt":  "type ListOfInt []int32",
+		"Sizes":      "type Sizes []float64",
+		"Colors":     "type Colors []Color",
+		"Timestamps": "type Timestamps []time.Time",
+		"Limit":      "type Limit string",
+	} {
+		actual, err := getTypeDeclaration(resp, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("got %s want %s", actual, expected)
+		}
+	}
+
+	for _, method := range []string{
+		"func (l ListOfInt) MarshalXML(",
+		"func (l *ListOfInt) UnmarshalXML(",
+		"func (l Colors) MarshalXMLAttr(",
+		"func (l *Colors) UnmarshalXMLAttr(",
+	} {
+		if !strings.Contains(string(resp["types"]), method) {
+			t.Errorf("method %s is missing", method)
+		}
+	}
+}
+
+func TestIntEnumKind(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/lists.wsdl", "main", false, true, WithEnumKind(EnumKindInt))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"Color":     "type Color int",
+		"Unbounded": "type Unbounded int",
+		"Colors":    "type Colors []Color",
+	} {
+		actual, err := getTypeDeclaration(resp, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("got %s want %s", actual, expected)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the round trip of the generated code in short mode")
+	}
+
+	// Run the generated code to round trip enum values, as elements, attributes
+	// and list items, and dateTime list items through their XSD values.
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+type Palette struct {
+	XMLName xml.Name   ` + "`" + `xml:"Palette"` + "`" + `
+	Primary Color      ` + "`" + `xml:"primary,attr"` + "`" + `
+	Accent  *Color     ` + "`" + `xml:"accent"` + "`" + `
+	Colors  Colors     ` + "`" + `xml:"colors"` + "`" + `
+	Changes Timestamps ` + "`" + `xml:"changes,attr"` + "`" + `
+}
+
+func main() {
+	var p Palette
+	if err := xml.Unmarshal([]byte(` + "`" + `<Palette primary="green" changes="2021-03-04T05:06:07+01:00 2021-03-05T00:00:00"><accent>red</accent><colors>green red</colors></Palette>` + "`" + `), &p); err != nil {
+		panic(err)
+	}
+	fmt.Println(p.Primary == ColorGreen, *p.Accent == ColorRed, p.Colors[0], int(p.Colors[1]), len(p.Changes))
+
+	output, err := xml.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(output))
+
+	if err := xml.Unmarshal([]byte(` + "`" + `<Palette primary="blue"></Palette>` + "`" + `), &p); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := xml.Marshal(Palette{Primary: Color(7)}); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := xml.Marshal(Palette{Primary: ColorRed, Colors: Colors{ColorRed, Color(8)}}); err != nil {
+		fmt.Println(err)
+	}
+}
+`
+
+	output := runGenerated(t, resp, program)
+	expected := `true true green 1 2
+<Palette primary="green" changes="2021-03-04T05:06:07+01:00 2021-03-05T00:00:00Z"><accent>red</accent><colors>green red</colors></Palette>
+invalid Color "blue"
+invalid Color 7
+invalid Color 8
+`
+	if output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
+	}
+}
+
+func TestIntEnumKindDocumentedValues(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/chromedata.wsdl", "main", false, true, WithEnumKind(EnumKindInt))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestAttributeRef(t *testing.T) {
 	g, err := NewGoWSDL("fixtures/test.wsdl", "myservice", false, true)
 	if err != nil {
@@ -76,91 +810,1244 @@ func TestAttributeRef(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	actual, err := getTypeDeclaration(resp, "ResponseStatus")
-	if err != nil {
-		fmt.Println(string(resp["types"]))
+	actual, err := getTypeDeclaration(resp, "ResponseStatus")
+	if err != nil {
+		fmt.Println(string(resp["types"]))
+		t.Fatal(err)
+	}
+
+	expected := `type ResponseStatus struct {
+	Status	[]struct {
+		Value	string  ` + "`" + `xml:",chardata"` + "`" + `
+
+		Code	string	` + "`" + `xml:"code,attr,omitempty"` + "`" + `
+	}	` + "`" + `xml:"http://www.mnb.hu/webservices/ status,omitempty"` + "`" + `
+
+	ResponseCode	string	` + "`" + `xml:"http://www.mnb.hu/webservices/ responseCode,attr,omitempty"` + "`" + `
+}`
+	actual = string(bytes.ReplaceAll([]byte(actual), []byte("\t"), []byte("  ")))
+	expected = string(bytes.ReplaceAll([]byte(expected), []byte("\t"), []byte("  ")))
+	if actual != expected {
+		t.Error("got \n" + actual + " want \n" + expected)
+	}
+}
+
+func TestAttributeGroupRef(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/attributegroups.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, fields := range map[string][]string{
+		// Nested groups are expanded, including those of another schema.
+		"Document": {
+			"Id string `xml:\"id,attr,omitempty\"",
+			"CreatedBy string `xml:\"createdBy,attr,omitempty\"",
+			"CreatedAt time.Time `xml:\"createdAt,attr,omitempty\"",
+			"Revision *Revision `xml:\"revision,attr,omitempty\"",
+		},
+		"Report": {
+			"ReviewedBy string `xml:\"reviewedBy,attr,omitempty\"",
+		},
+		"Note": {
+			"Value string `xml:\",chardata\"",
+			"CreatedBy string `xml:\"createdBy,attr,omitempty\"",
+			"Revision *Revision `xml:\"revision,attr,omitempty\"",
+		},
+	} {
+		actual, err := getTypeDeclaration(resp, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual = strings.Join(strings.Fields(actual), " ")
+		for _, field := range fields {
+			if !strings.Contains(actual, field) {
+				t.Errorf("expected %s in %s", field, actual)
+			}
+		}
+	}
+}
+
+func TestXSITypePolymorphism(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/polymorphism.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"Animal []*AnimalValue `",
+		"type AnimalValue struct",
+		`soap.RegisterType("http://example.com/zoo.xsd", "Dog", func() interface{} { return new(Dog) })`,
+		`soap.RegisterType("http://example.com/zoo.xsd", "Cat", func() interface{} { return new(Cat) })`,
+	} {
+		if !strings.Contains(string(resp["types"]), expected) {
+			t.Errorf("expected %s in generated types", expected)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	var r ListAnimalsResponse
+	if err := xml.Unmarshal([]byte(` + "`" + `<ListAnimalsResponse xmlns="http://example.com/zoo.xsd" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+		<animal xmlns:z="http://example.com/zoo.xsd" xsi:type="z:Dog"><name>Rex</name><breed>collie</breed></animal>
+		<animal xsi:type="Cat"><name>Tom</name><lives>9</lives></animal>
+	</ListAnimalsResponse>` + "`" + `), &r); err != nil {
+		panic(err)
+	}
+
+	for _, a := range r.Animal {
+		switch v := a.Value.(type) {
+		case *Dog:
+			fmt.Println("dog", v.Name, v.Breed)
+		case *Cat:
+			fmt.Println("cat", v.Name, v.Lives)
+		default:
+			fmt.Printf("%T\n", v)
+		}
+	}
+}
+`
+
+	expected := "dog Rex collie\ncat Tom 9\n"
+	if output := runGenerated(t, resp, program); output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
+	}
+}
+
+func TestVboxGeneratesWithoutSyntaxErrors(t *testing.T) {
+	files, err := filepath.Glob("fixtures/*.wsdl")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, file := range files {
+		g, err := NewGoWSDL(file, "myservice", false, true)
+		if err != nil {
+			t.Error(err)
+		}
+
+		resp, err := g.Start()
+		if err != nil {
+			continue
+			//t.Error(err)
+		}
+
+		data := new(bytes.Buffer)
+		data.Write(resp["header"])
+		data.Write(resp["types"])
+		data.Write(resp["operations"])
+		data.Write(resp["soap"])
+
+		_, err = format.Source(data.Bytes())
+		if err != nil {
+			fmt.Println(string(data.Bytes()))
+			t.Error(err)
+		}
+	}
+}
+
+func TestEnumerationsGeneratedCorrectly(t *testing.T) {
+	enumStringTest := func(t *testing.T, fixtureWsdl string, varName string, typeName string, enumString string) {
+		g, err := NewGoWSDL("fixtures/"+fixtureWsdl, "myservice", false, true)
+		if err != nil {
+			t.Error(err)
+		}
+
+		resp, err := g.Start()
+		if err != nil {
+			t.Error(err)
+		}
+
+		re := regexp.MustCompile(varName + " " + typeName + " = \"([^\"]+)\"")
+		matches := re.FindStringSubmatch(string(resp["types"]))
+
+		if len(matches) != 2 {
+			t.Errorf("No match or too many matches found for %s", varName)
+		} else if matches[1] != enumString {
+			t.Errorf("%s got '%s' but expected '%s'", varName, matches[1], enumString)
+		}
+	}
+	enumStringTest(t, "chromedata.wsdl", "DriveTrainFrontWheelDrive", "DriveTrain", "Front Wheel Drive")
+	enumStringTest(t, "vboxweb.wsdl", "SettingsVersionV1_14", "SettingsVersion", "v1_14")
+
+}
+
+func TestEPCISWSDL(t *testing.T) {
+	log.SetFlags(0)
+	log.SetOutput(os.Stdout)
+
+	g, err := NewGoWSDL("./fixtures/epcis/EPCglobal-epcis-query-1_2.wsdl", "myservice", true, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := new(bytes.Buffer)
+	data.Write(resp["header"])
+	data.Write(resp["types"])
+	data.Write(resp["operations"])
+	data.Write(resp["soap"])
+
+	// go fmt the generated code
+	source, err := FormatSource(data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedBytes, err := ioutil.ReadFile("./fixtures/epcis/epcisquery.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := string(source)
+	expected := string(expectedBytes)
+	if !compareResults(actual, expected) {
+		_ = ioutil.WriteFile("./fixtures/epcis/epcisquery_gen.src", source, 0664)
+		t.Error("got source ./fixtures/epcis/epcisquery_gen.src but expected ./fixtures/epcis/epcisquery.src")
+	}
+}
+
+func TestFormatSource(t *testing.T) {
+	source, err := FormatSource([]byte(`package myservice
+import (
+	"context"
+	"encoding/xml"
+	"github.com/eloyucu/gowsdl/soap"
+	_ "embed"
+)
+type Ping struct {
+XMLName xml.Name
+}
+func NewClient(url string) *soap.Client { return soap.NewClient(url) }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `package myservice
+
+import (
+	_ "embed"
+	"encoding/xml"
+	"github.com/eloyucu/gowsdl/soap"
+)
+
+type Ping struct {
+	XMLName xml.Name
+}
+
+func NewClient(url string) *soap.Client { return soap.NewClient(url) }
+`
+	if string(source) != expected {
+		t.Errorf("got source\n%s\nwanted\n%s", source, expected)
+	}
+
+	_, err = FormatSource([]byte("package myservice\n\ntype Ping struct {\n\tMessage string\n\tReply *\n}\n"))
+	if err == nil {
+		t.Fatal("expected an error for invalid source")
+	}
+	if !strings.Contains(err.Error(), ">     6 | }") || !strings.Contains(err.Error(), "      5 | \tReply *") {
+		t.Errorf("error should show the offending lines, got %v", err)
+	}
+}
+
+func TestElementRefs(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/elementrefs.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/elementrefs.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/elementrefs_gen.src", source, 0664)
+		t.Error("got source ./fixtures/elementrefs_gen.src but expected ./fixtures/elementrefs.src")
+	}
+}
+
+func TestFixedAndDefaultAttributes(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/attributedefaults.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/attributedefaults.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/attributedefaults_gen.src", source, 0664)
+		t.Error("got source ./fixtures/attributedefaults_gen.src but expected ./fixtures/attributedefaults.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	output, err := xml.Marshal(struct {
+		XMLName xml.Name ` + "`" + `xml:"catalog"` + "`" + `
+		Catalog
+	}{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(output))
+
+	var c Catalog
+	fmt.Println(xml.Unmarshal([]byte(` + "`" + `<catalog version="2.0"/>` + "`" + `), &c))
+
+	item := NewItem()
+	if err := xml.Unmarshal([]byte(` + "`" + `<item quantity="3">pen</item>` + "`" + `), item); err != nil {
+		panic(err)
+	}
+	fmt.Println(item.Value, item.Quantity, item.Available, item.Currency)
+}
+`
+
+	want := `<catalog version="1.0"></catalog>
+attribute version of Catalog is fixed to "1.0", got "2.0"
+pen 3 true EUR
+`
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got\n%s\nwanted\n%s", output, want)
+	}
+}
+
+func TestRepeatedElementsAreSlices(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/repeated.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/repeated.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/repeated_gen.src", source, 0664)
+		t.Error("got source ./fixtures/repeated_gen.src but expected ./fixtures/repeated.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	var res GetStockResponse
+	err := xml.Unmarshal([]byte(` + "`" + `<GetStockResponse xmlns="http://example.com/inventory.xsd">
+		<stock>
+			<warehouse>north</warehouse>
+			<sku>a1</sku><sku>b2</sku><sku>c3</sku>
+			<tag>new</tag><tag>sale</tag>
+			<bin><code>x</code></bin><bin><code>y</code></bin>
+		</stock>
+		<properties><key>color</key><value>red</value><key>size</key><value>L</value></properties>
+		<movements><in>5</in><out>2</out><in>1</in></movements>
+	</GetStockResponse>` + "`" + `), &res)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res.Stock.Sku, res.Stock.Tag, len(res.Stock.Bin), res.Stock.Bin[1].Code)
+	fmt.Println(res.Properties.Key, res.Properties.Value)
+	fmt.Println(res.Movements.In, res.Movements.Out)
+}
+`
+
+	want := `[a1 b2 c3] [new sale] 2 y
+[color size] [red L]
+[5 1] [2]
+`
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got\n%s\nwanted\n%s", output, want)
+	}
+}
+
+func TestFieldsFollowSchemaOrder(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/order.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/order.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/order_gen.src", source, 0664)
+		t.Error("got source ./fixtures/order_gen.src but expected ./fixtures/order.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	shipment := Shipment{Id: "1", Address: "Main St", Carrier: "ups", Weight: 2, Height: 3, Reference: "r"}
+	out, err := xml.Marshal(&CreateShipment{
+		Shipment: &shipment,
+		Express:  &ExpressShipment{Shipment: &shipment, Priority: 1, Signature: "me", Deadline: "today"},
+		Notes:    "fragile",
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(out))
+}
+`
+
+	shipment := "<id>1</id><address>Main St</address><carrier>ups</carrier><weight>2</weight><height>3</height><reference>r</reference>"
+	want := `<CreateShipment xmlns="http://example.com/shipping.xsd"><shipment>` + shipment + `</shipment>` +
+		`<express>` + shipment + `<priority>1</priority><signature>me</signature><deadline>today</deadline></express>` +
+		`<notes>fragile</notes></CreateShipment>
+`
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got\n%s\nwanted\n%s", output, want)
+	}
+}
+
+func TestRequiredElementsKeepEmptyValues(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/required.wsdl", "main", false, true, WithRequiredElements("group"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/required.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/required_gen.src", source, 0664)
+		t.Error("got source ./fixtures/required_gen.src but expected ./fixtures/required.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	out, err := xml.Marshal(&UpdateNote{Id: "1"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(out))
+}
+`
+
+	want := `<UpdateNote xmlns="http://example.com/notes.xsd"><id>1</id><comment></comment><title></title><author></author><group></group></UpdateNote>
+`
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got\n%s\nwanted\n%s", output, want)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/accessors.wsdl", "main", false, true, WithAccessors(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/accessors.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/accessors_gen.src", source, 0664)
+		t.Error("got source ./fixtures/accessors_gen.src but expected ./fixtures/accessors.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import "fmt"
+
+func main() {
+	var unset *UpdateProfile
+	req := &UpdateProfile{Id: "1"}
+	req.SetNickname("jo")
+	fmt.Println(unset.GetNickname() == "", req.GetAge(), req.GetNickname(), *req.Nickname, req.Verified == nil)
+}
+`
+
+	if output := runGenerated(t, resp, program); output != "true 0 jo jo true\n" {
+		t.Errorf("got %q, wanted the values of the fields or their zero value", output)
+	}
+}
+
+func TestNillableElements(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/nillable.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/nillable.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/nillable_gen.src", source, 0664)
+		t.Error("got source ./fixtures/nillable_gen.src but expected ./fixtures/nillable.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	weight := int32(12)
+	code := Int32("x1")
+	out, err := xml.Marshal(&UpdateShipment{Id: "1", Weight: NillableInt32{&weight}, Code: NillableInt322{&code}})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(out))
+
+	req := &UpdateShipment{Carrier: NillableCarrier{&Carrier{Name: "acme"}}}
+	if err := xml.Unmarshal(out, req); err != nil {
+		panic(err)
+	}
+	fmt.Println(*req.Weight.Value, req.Carrier.Value == nil, req.Note == nil, *req.Code.Value)
+}
+`
+
+	// The nillable types of the int built-in and of the Int32 schema type
+	// are told apart.
+	want := `<UpdateShipment xmlns="http://example.com/shipments.xsd"><id>1</id><weight>12</weight>` +
+		`<carrier xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"></carrier><code>x1</code></UpdateShipment>
+12 true true x1
+`
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got\n%s\nwanted\n%s", output, want)
+	}
+}
+
+func TestCloneMethods(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/clone.wsdl", "main", false, true, WithCloneMethods(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/clone.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/clone_gen.src", source, 0664)
+		t.Error("got source ./fixtures/clone_gen.src but expected ./fixtures/clone.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	sku, discount := Sku("A-1"), 0.5
+	req := &PlaceOrder{
+		Customer: &Customer{Name: "jo", Emails: []string{"jo@example.com"}},
+		Line:     []*Line{{Sku: &sku, Quantity: 2, Discount: &discount}},
+	}
+	req.Delivery.Notes = []string{"ring twice"}
+
+	clone := req.Clone()
+	clone.XMLName = xml.Name{Space: "http://example.com/orders.xsd", Local: "PlaceOrder"}
+	fmt.Println(clone.Equal(req), clone.Customer != req.Customer, clone.Line[0] != req.Line[0])
+
+	clone.Customer.Emails[0] = "jo@example.org"
+	*clone.Line[0].Discount = 0.25
+	clone.Delivery.Notes[0] = "leave at the door"
+	fmt.Println(req.Customer.Emails[0], *req.Line[0].Discount, req.Delivery.Notes[0], clone.Equal(req))
+
+	var unset *PlaceOrder
+	fmt.Println(unset.Clone() == nil, unset.Equal(nil), unset.Equal(req))
+}
+`
+
+	want := "true true true\njo@example.com 0.5 ring twice false\ntrue true false\n"
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got %q, wanted %q", output, want)
+	}
+}
+
+func TestElementForms(t *testing.T) {
+	for _, form := range []string{"qualified", "unqualified"} {
+		g, err := NewGoWSDL("fixtures/"+form+".wsdl", "main", false, true)
+		if err != nil {
+			t.Error(err)
+		}
+
+		resp, err := g.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := typeCheck(resp); err != nil {
+			t.Fatal(err)
+		}
+
+		source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := ioutil.ReadFile("./fixtures/" + form + ".src")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(source) != string(expected) {
+			_ = ioutil.WriteFile("./fixtures/"+form+"_gen.src", source, 0664)
+			t.Errorf("got source ./fixtures/%s_gen.src but expected ./fixtures/%s.src", form, form)
+		}
+	}
+
+	g, err := NewGoWSDL("fixtures/qualified.wsdl", "main", false, true, WithUnqualifiedTags(true))
+	if err != nil {
+		t.Error(err)
+	}
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Email string `xml:\"email\""; !strings.Contains(string(resp["types"]), expected) {
+		t.Errorf("expected %s in generated types with unqualified tags", expected)
+	}
+}
+
+func TestImportedDocuments(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/imports/service.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/imports/imports.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/imports/imports_gen.src", source, 0664)
+		t.Error("got source ./fixtures/imports/imports_gen.src but expected ./fixtures/imports/imports.src")
+	}
+
+	g, err = NewGoWSDL("fixtures/imports/missing.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+	missing, err := filepath.Abs("fixtures/imports/schemas/missing.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Start(); err == nil || !strings.Contains(err.Error(), "cannot find "+missing+", referenced by ") {
+		t.Errorf("got error %v, wanted the missing file %s", err, missing)
+	}
+}
+
+func TestSubstitutionGroups(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/substitution.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/substitution.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/substitution_gen.src", source, 0664)
+		t.Error("got source ./fixtures/substitution_gen.src but expected ./fixtures/substitution.src")
+	}
+
+	// The type of the scooter, inherited from the bike, is only given to the
+	// fields generated for it, the parsed schema is left untouched.
+	for _, elm := range g.wsdl.Types.Schemas[0].Elements {
+		if elm.Name == "scooter" && elm.Type != "" {
+			t.Errorf("the type of the parsed scooter element was rewritten to %q", elm.Type)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	in := ` + "`" + `<ParkVehicles xmlns="http://example.com/garage.xsd"><vehicle><wheels>3</wheels></vehicle><car><wheels>4</wheels><doors>5</doors></car><bike><wheels>2</wheels><gears>21</gears></bike></ParkVehicles>` + "`" + `
+	var req ParkVehicles
+	if err := xml.Unmarshal([]byte(in), &req); err != nil {
+		panic(err)
+	}
+	fmt.Println(len(req.Vehicle), req.Vehicle[0].Wheels, req.Car[0].Doors, req.Bike[0].Gears)
+}
+`
+
+	if output := runGenerated(t, resp, program); output != "1 3 5 21\n" {
+		t.Errorf("got %q, wanted the head and both substitutes decoded", output)
+	}
+}
+
+func TestAnyXML(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/any.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/any.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/any_gen.src", source, 0664)
+		t.Error("got source ./fixtures/any_gen.src but expected ./fixtures/any.src")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	var req Publish
+	err := xml.Unmarshal([]byte(` + "`" + `<Publish xmlns="http://example.com/events.xsd">
+		<document>
+			<id>7</id><x:trace xmlns:x="urn:trace" x:level="2"><x:span>a</x:span></x:trace><y:tag xmlns:y="urn:tag">b</y:tag>
+			<version>3</version>
+		</document>
+		<payload><order number="1"><line>pen</line></order></payload>
+		<summary lang="en"><b>bold</b> text</summary>
+		<envelope><first/><second>2</second></envelope>
+	</Publish>` + "`" + `), &req)
+	if err != nil {
+		panic(err)
+	}
+	for _, item := range req.Document.Items {
+		fmt.Println(item.XMLName.Space, item.XMLName.Local, string(item.InnerXML))
+	}
+	var order struct {
+		Number string ` + "`" + `xml:"number,attr"` + "`" + `
+		Line   string ` + "`" + `xml:"line"` + "`" + `
+	}
+	if err := xml.Unmarshal(req.Payload.InnerXML, &order); err != nil {
+		panic(err)
+	}
+	fmt.Println(order.Number, order.Line, req.Note == nil)
+	fmt.Println(req.Summary.Lang, string(req.Summary.InnerXML), len(req.Envelope.Items))
+
+	out, err := xml.Marshal(req.Document)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(out))
+}
+`
+
+	want := `urn:trace trace <x:span>a</x:span>
+urn:tag tag b
+1 pen true
+en <b>bold</b> text 2
+<Extensible><id>7</id><version>3</version><trace xmlns="urn:trace" xmlns:x="urn:trace" x:level="2"><x:span>a</x:span></trace><tag xmlns="urn:tag" xmlns:y="urn:tag">b</tag></Extensible>
+`
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got\n%s\nwanted\n%s", output, want)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/constructors.wsdl", "main", false, true, WithConstructors(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/constructors.src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/constructors_gen.src", source, 0664)
+		t.Error("got source ./fixtures/constructors_gen.src but expected ./fixtures/constructors.src")
+	}
+	if strings.Contains(string(source), "func NewReceipt") {
+		t.Error("response types should not get a constructor")
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+func main() {
+	get := NewGetOrder()
+	get.Id = "1"
+	place := NewPlaceOrder()
+	place.Item = "pen"
+	cancel := NewCancelOrder()
+	cancel.Id = "2"
+	for _, req := range []interface{}{get, place, cancel} {
+		out, err := xml.Marshal(req)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(out))
+	}
+}
+`
+
+	want := `<GetOrder xmlns="http://example.com/orders.xsd"><id>1</id></GetOrder>
+<PlaceOrder xmlns="http://example.com/orders.xsd" channel="web"><item>pen</item></PlaceOrder>
+<CancelOrderRequest xmlns="http://example.com/orders.xsd"><id>2</id></CancelOrderRequest>
+`
+	if output := runGenerated(t, resp, program); output != want {
+		t.Errorf("got\n%s\nwanted\n%s", output, want)
+	}
+}
+
+func TestGroupRefs(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/groups.wsdl", "myservice", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := typeCheck(resp); err != nil {
 		t.Fatal(err)
 	}
 
-	expected := `type ResponseStatus struct {
-	Status	[]struct {
-		Value	string  ` + "`" + `xml:",chardata" json:"-,"` + "`" + `
-
-		Code	string	` + "`" + `xml:"code,attr,omitempty" json:"code,omitempty"` + "`" + `
-	}	` + "`" + `xml:"status,omitempty" json:"status,omitempty"` + "`" + `
+	source, err := FormatSource([]byte(string(resp["header"]) + string(resp["types"]) + string(resp["operations"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("./fixtures/groups.src")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	ResponseCode	string	` + "`" + `xml:"responseCode,attr,omitempty" json:"responseCode,omitempty"` + "`" + `
-}`
-	actual = string(bytes.ReplaceAll([]byte(actual), []byte("\t"), []byte("  ")))
-	expected = string(bytes.ReplaceAll([]byte(expected), []byte("\t"), []byte("  ")))
-	if actual != expected {
-		t.Error("got \n" + actual + " want \n" + expected)
+	if string(source) != string(expected) {
+		_ = ioutil.WriteFile("./fixtures/groups_gen.src", source, 0664)
+		t.Error("got source ./fixtures/groups_gen.src but expected ./fixtures/groups.src")
 	}
 }
 
-func TestVboxGeneratesWithoutSyntaxErrors(t *testing.T) {
-	files, err := filepath.Glob("fixtures/*.wsdl")
+func TestBase64BinaryFields(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/binary.wsdl", "main", false, true)
 	if err != nil {
 		t.Error(err)
 	}
 
-	for _, file := range files {
-		g, err := NewGoWSDL(file, "myservice", false, true)
-		if err != nil {
-			t.Error(err)
-		}
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		resp, err := g.Start()
-		if err != nil {
-			continue
-			//t.Error(err)
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"Content *soap.Binary `",
+		"Thumbnail *soap.Binary `",
+	} {
+		if !strings.Contains(string(resp["types"]), expected) {
+			t.Errorf("expected %s in generated types", expected)
 		}
+	}
 
-		data := new(bytes.Buffer)
-		data.Write(resp["header"])
-		data.Write(resp["types"])
-		data.Write(resp["operations"])
-		data.Write(resp["soap"])
+	legacy, err := NewGoWSDL("fixtures/binary.wsdl", "main", false, true, WithBinaryBytes(true))
+	if err != nil {
+		t.Error(err)
+	}
+	legacyResp, err := legacy.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(legacyResp["types"]), "Content []byte `") {
+		t.Errorf("expected []byte base64Binary fields with WithBinaryBytes, got\n%s", legacyResp["types"])
+	}
 
-		_, err = format.Source(data.Bytes())
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/eloyucu/gowsdl/soap"
+)
+
+func main() {
+	var multipart bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multipart = strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/related")
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	for _, opts := range [][]soap.Option{{soap.WithMTOM()}, nil} {
+		service := NewDocumentsPortType(soap.NewClient(ts.URL, opts...))
+		reply, err := service.Echo(&Document{
+			Name:    "report.pdf",
+			Content: soap.NewBinary([]byte("%PDF-1.4")).SetContentType("application/pdf"),
+		})
 		if err != nil {
-			fmt.Println(string(data.Bytes()))
-			t.Error(err)
+			panic(err)
 		}
+		fmt.Println(multipart, reply.Name, string(reply.Content.Bytes()), reply.Content.ContentType(), reply.Thumbnail == nil)
 	}
 }
+`
 
-func TestEnumerationsGeneratedCorrectly(t *testing.T) {
-	enumStringTest := func(t *testing.T, fixtureWsdl string, varName string, typeName string, enumString string) {
-		g, err := NewGoWSDL("fixtures/"+fixtureWsdl, "myservice", false, true)
-		if err != nil {
-			t.Error(err)
-		}
+	expected := "true report.pdf %PDF-1.4 application/pdf true\n" +
+		"false report.pdf %PDF-1.4 application/octet-stream true\n"
+	if output := runGenerated(t, resp, program); output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
+	}
+}
 
-		resp, err := g.Start()
-		if err != nil {
-			t.Error(err)
-		}
+func TestRPCOperationWithoutParts(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/rpcempty.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
 
-		re := regexp.MustCompile(varName + " " + typeName + " = \"([^\"]+)\"")
-		matches := re.FindStringSubmatch(string(resp["types"]))
+	resp, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		if len(matches) != 2 {
-			t.Errorf("No match or too many matches found for %s", varName)
-		} else if matches[1] != enumString {
-			t.Errorf("%s got '%s' but expected '%s'", varName, matches[1], enumString)
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"XMLName xml.Name `xml:\"http://example.com/clock GetTime\"`",
+		// Without a soap:body namespace the operation element is in the
+		// namespace of the WSDL.
+		"XMLName xml.Name `xml:\"http://example.com/clock.wsdl Ping\"`",
+	} {
+		if !strings.Contains(string(resp["operations"]), expected) {
+			t.Errorf("expected %s in generated operations", expected)
 		}
 	}
-	enumStringTest(t, "chromedata.wsdl", "DriveTrainFrontWheelDrive", "DriveTrain", "Front Wheel Drive")
-	enumStringTest(t, "vboxweb.wsdl", "SettingsVersionV1_14", "SettingsVersion", "v1_14")
 
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+
+	"github.com/eloyucu/gowsdl/soap"
+)
+
+func main() {
+	body := regexp.MustCompile(` + "`" + `<Body[^>]*>(.*)</Body>` + "`" + `)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, _ := ioutil.ReadAll(r.Body)
+		fmt.Println(body.FindStringSubmatch(string(request))[1])
+		w.Write([]byte(` + "`" + `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetTimeResponse><result><time>12:00</time></result></GetTimeResponse></soap:Body></soap:Envelope>` + "`" + `))
+	}))
+	defer ts.Close()
+
+	service := NewClockPortType(soap.NewClient(ts.URL))
+	result, err := service.GetTime()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(result.Result.Time)
+	if err := service.Ping(); err != nil {
+		panic(err)
+	}
 }
+`
 
-func TestEPCISWSDL(t *testing.T) {
-	log.SetFlags(0)
-	log.SetOutput(os.Stdout)
+	expected := `<GetTime xmlns="http://example.com/clock"></GetTime>
+12:00
+<Ping xmlns="http://example.com/clock.wsdl"></Ping>
+`
+	if output := runGenerated(t, resp, program); output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
+	}
+}
 
-	g, err := NewGoWSDL("./fixtures/epcis/EPCglobal-epcis-query-1_2.wsdl", "myservice", true, true)
+func TestMessagePartsByElementAndType(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/parts.wsdl", "main", false, true)
 	if err != nil {
 		t.Error(err)
 	}
@@ -169,27 +2056,237 @@ func TestEPCISWSDL(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	data := new(bytes.Buffer)
-	data.Write(resp["header"])
-	data.Write(resp["types"])
-	data.Write(resp["operations"])
-	data.Write(resp["soap"])
 
-	// go fmt the generated code
-	source, err := format.Source(data.Bytes())
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"GetQuoteContext (ctx context.Context, request *QuoteRequest) (*Quote, error)",
+		"LookupContext (ctx context.Context, request *QuoteRequest) (*Quote, error)",
+		"XMLName xml.Name `xml:\"request\"`",
+		"XMLName xml.Name `xml:\"quote\"`",
+	} {
+		if !strings.Contains(string(resp["operations"]), expected) {
+			t.Errorf("expected %s in generated operations", expected)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+
+	"github.com/eloyucu/gowsdl/soap"
+)
+
+func main() {
+	body := regexp.MustCompile(` + "`" + `<Body[^>]*>(.*)</Body>` + "`" + `)
+	responses := map[string]string{
+		"http://example.com/GetQuote": ` + "`" + `<GetQuoteResponse xmlns="http://example.com/quotes.xsd"><price>1.5</price></GetQuoteResponse>` + "`" + `,
+		"http://example.com/Lookup":   ` + "`" + `<quote><price xmlns="http://example.com/quotes.xsd">2.5</price></quote>` + "`" + `,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, _ := ioutil.ReadAll(r.Body)
+		fmt.Println(body.FindStringSubmatch(string(request))[1])
+		w.Write([]byte(` + "`" + `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` + "`" + ` + responses[r.Header.Get("SOAPAction")] + ` + "`" + `</soap:Body></soap:Envelope>` + "`" + `))
+	}))
+	defer ts.Close()
+
+	service := NewQuotesPortType(soap.NewClient(ts.URL))
+	quote, err := service.GetQuote(&QuoteRequest{Symbol: "ABC"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(quote.Price)
+	quote, err = service.Lookup(&QuoteRequest{Symbol: "XYZ"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(quote.Price)
+}
+`
+
+	// The element part is sent as the global element, and the type part as
+	// an element named after the part, whose qualified children keep their
+	// namespace.
+	expected := `<GetQuote xmlns="http://example.com/quotes.xsd"><symbol xmlns="http://example.com/quotes.xsd">ABC</symbol></GetQuote>
+1.5
+<request><symbol xmlns="http://example.com/quotes.xsd">XYZ</symbol></request>
+2.5
+`
+	if output := runGenerated(t, resp, program); output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
+	}
+}
+
+func TestRPCStyle(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/rpc.wsdl", "main", false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
 	if err != nil {
 		t.Fatal(err)
 	}
-	expectedBytes, err := ioutil.ReadFile("./fixtures/epcis/epcisquery.src")
+
+	if err := typeCheck(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"AddContext (ctx context.Context, request *AddRequest) (*AddResponse, error)",
+		"ConvertContext (ctx context.Context, request *ConvertRequest) (*ConvertResponse, error)",
+		// The wrappers are decoded in any namespace, but marshaled in the
+		// namespace of the soap:body.
+		"XMLName xml.Name `xml:\"Add\"`",
+		`start.Name = xml.Name{Space: "urn:calculator", Local: "AddResponse"}`,
+	} {
+		if !strings.Contains(string(resp["operations"]), expected) {
+			t.Errorf("expected %s in generated operations", expected)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	program := `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+
+	"github.com/eloyucu/gowsdl/soap"
+)
+
+func main() {
+	body := regexp.MustCompile(` + "`" + `<Body[^>]*>(.*)</Body>` + "`" + `)
+	responses := map[string]string{
+		"urn:calculator#Add": ` + "`" + `<ns:AddResponse xmlns:ns="urn:calculator"><sum>5</sum></ns:AddResponse>` + "`" + `,
+		// An Axis style response, in a namespace of its own.
+		"urn:calculator#Convert": ` + "`" + `<ns1:ConvertResponse soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" xmlns:ns1="urn:axis" xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema"><result xsi:type="ns2:Operand" xmlns:ns2="http://example.com/calculator.xsd"><value xsi:type="xsd:int">254</value><unit xsi:type="xsd:string">cm</unit></result></ns1:ConvertResponse>` + "`" + `,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, _ := ioutil.ReadAll(r.Body)
+		fmt.Println(body.FindStringSubmatch(string(request))[1])
+		w.Write([]byte(` + "`" + `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` + "`" + ` + responses[r.Header.Get("SOAPAction")] + ` + "`" + `</soap:Body></soap:Envelope>` + "`" + `))
+	}))
+	defer ts.Close()
+
+	service := NewCalculatorPortType(soap.NewClient(ts.URL))
+	sum, err := service.Add(&AddRequest{A: 2, B: 3})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(sum.Sum)
+	converted, err := service.Convert(&ConvertRequest{Operand: &Operand{Value: 100, Unit: "in"}, Unit: "cm"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(converted.Result.Value, converted.Result.Unit)
+}
+`
+
+	// The parts are unqualified children of the operation element, and those
+	// of the encoded operation are marked with their xsi:type.
+	expected := `<rpc:Add xmlns:rpc="urn:calculator"><a>2</a><b>3</b></rpc:Add>
+5
+<rpc:Convert xmlns:rpc="urn:calculator" xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema"><operand xmlns:xsitype="http://example.com/calculator.xsd" xsi:type="xsitype:Operand"><value>100</value><unit>in</unit></operand><unit xsi:type="xsd:string">cm</unit></rpc:Convert>
+254 cm
+`
+	if output := runGenerated(t, resp, program); output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
+	}
+}
+
+func TestServerGeneration(t *testing.T) {
+	g, err := NewGoWSDL("fixtures/binary.wsdl", "main", false, true, WithServer(true))
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := g.Start()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	actual := string(source)
-	expected := string(expectedBytes)
-	if !compareResults(actual, expected) {
-		_ = ioutil.WriteFile("./fixtures/epcis/epcisquery_gen.src", source, 0664)
-		t.Error("got source ./fixtures/epcis/epcisquery_gen.src but expected ./fixtures/epcis/epcisquery.src")
+	source := string(resp["server"])
+	for _, expected := range []string{
+		"type DocumentsPortTypeServer interface",
+		"Echo (ctx context.Context, request *Document) (*Document, error)",
+		"func NewDocumentsPortTypeHandler(server DocumentsPortTypeServer) http.Handler",
+		`Element: xml.Name{Space: "http://example.com/documents.xsd", Local: "Document"},`,
+	} {
+		if !strings.Contains(source, expected) {
+			t.Errorf("expected %s in generated server", expected)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skipping the run of the generated code in short mode")
+	}
+
+	resp["operations"] = append(resp["operations"], resp["server"]...)
+	program := `package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+
+	"github.com/eloyucu/gowsdl/soap"
+)
+
+type documents struct{}
+
+func (documents) Echo(ctx context.Context, request *Document) (*Document, error) {
+	switch request.Name {
+	case "missing":
+		return nil, &soap.SOAPFault{Code: "soap:Client", String: "no such document"}
+	case "broken":
+		return nil, errors.New("disk failure")
+	case "queued":
+		return nil, nil
+	}
+	return &Document{Name: request.Name + " (copy)", Content: request.Content}, nil
+}
+
+func main() {
+	ts := httptest.NewServer(NewDocumentsPortTypeHandler(documents{}))
+	defer ts.Close()
+
+	client := NewDocumentsPortType(soap.NewClient(ts.URL))
+	for _, name := range []string{"report.pdf", "missing", "broken", "queued"} {
+		reply, err := client.Echo(&Document{Name: name, Content: soap.NewBinary([]byte("data"))})
+		if fault, ok := err.(*soap.SOAPFault); ok {
+			fmt.Println(fault.Code, fault.String)
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(reply.Name, string(reply.Content.Bytes()))
+	}
+}
+`
+
+	expected := "report.pdf (copy) data\nsoap:Client no such document\nsoap:Server disk failure\nsoap:Server no response to Document\n"
+	if output := runGenerated(t, resp, program); output != expected {
+		t.Errorf("got\n%s\nwanted\n%s", output, expected)
 	}
 }
 
@@ -217,6 +2314,91 @@ func getTypeDeclaration(resp map[string][]byte, name string) (string, error) {
 	return buf.String(), nil
 }
 
+// sourceImporter imports packages from source, which makes this module's soap
+// package available to the generated code. It is shared to avoid type checking
+// the standard library packages again for every test.
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// runGenerated runs program, the main function of a package main, together
+// with the generated code in resp and returns its output.
+func runGenerated(t *testing.T, resp map[string][]byte, program string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir(".", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source, err := FormatSource(append(append(append([]byte{}, resp["header"]...), resp["types"]...), resp["operations"]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "myservice.go"), source, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running the generated code failed: %v\n%s", err, output)
+	}
+	return string(output)
+}
+
+// typeCheck type checks the code generated for a single package.
+func typeCheck(resp map[string][]byte) error {
+	source := string(resp["header"]) + string(resp["types"]) + string(resp["operations"])
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "myservice.go", source, 0)
+	if err != nil {
+		return err
+	}
+
+	conf := types.Config{Importer: sourceImporter}
+	_, err = conf.Check("myservice", fset, []*ast.File{f}, nil)
+	return err
+}
+
+// typeCheckPackages type checks the code generated in multi-package mode, the
+// main package along with the namespace packages it imports from importPath.
+func typeCheckPackages(resp map[string][]byte, importPath string) error {
+	fset := token.NewFileSet()
+	checked := make(map[string]*types.Package)
+
+	var imp importerFunc
+	check := func(path, name string, source []byte) (*types.Package, error) {
+		f, err := parser.ParseFile(fset, name+".go", source, 0)
+		if err != nil {
+			return nil, err
+		}
+		conf := types.Config{Importer: imp}
+		pkg, err := conf.Check(path, fset, []*ast.File{f}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("package %s doesn't compile: %v", name, err)
+		}
+		checked[path] = pkg
+		return pkg, nil
+	}
+	imp = func(path string) (*types.Package, error) {
+		if pkg, ok := checked[path]; ok {
+			return pkg, nil
+		}
+		if name := strings.TrimPrefix(path, importPath+"/"); name != path {
+			return check(path, name, resp[name+"/"+name+".go"])
+		}
+		return sourceImporter.Import(path)
+	}
+
+	_, err := check(importPath, "myservice", append(append([]byte{}, resp["header"]...), resp["operations"]...))
+	return err
+}
+
 func compareResults(output, expected string) bool {
 	m := minify.New()
 
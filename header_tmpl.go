@@ -4,32 +4,83 @@
 
 package gowsdl
 
+// soapImportPath is the import path of the soap package the generated code
+// relies on, the one of this module.
+const soapImportPath = "github.com/eloyucu/gowsdl/soap"
+
 var headerTmpl = `
 // Code generated by gowsdl DO NOT EDIT.
 
-package {{.}}
+package {{.Pkg}}
 
 import (
-	"context"
+	{{if .Operations}}"context"{{end}}
+	{{- if and .Helpers .Nillables}}
+		"encoding/json"
+	{{- end}}
 	"encoding/xml"
+	{{- if or .Validation .IntEnums}}
+		"fmt"
+	{{- end}}
+	{{- if .Validation}}
+		"regexp"
+		"unicode/utf8"
+	{{- end}}
+	{{- if .Server}}
+		"net/http"
+	{{- end}}
 	"time"
-	"github.com/hooklift/gowsdl/soap"
+	"` + soapImportPath + `"
 
-	{{/*range .Imports*/}}
-		{{/*.*/}}
-	{{/*end*/}}
+	{{range .Imports}}
+		"{{.}}"
+	{{end}}
 )
 
 // against "unused imports"
 var _ time.Time
 var _ xml.Name
+{{- if or .Validation .IntEnums}}
+	var _ = fmt.Errorf
+{{- end}}
+{{- if .Validation}}
+	var _ = regexp.MustCompile
+	var _ = utf8.RuneCountInString
+{{end}}
+{{if not .Operations}}var _ soap.EncodedArray{{end}}
+{{if .Helpers}}
+// AnyType is kept for code written against earlier generated packages, whose
+// anyType fields are now soap.AnyXML.
+type AnyType = soap.AnyXML
 
-type AnyType struct {
-	InnerXML string ` + "`" + `xml:",innerxml"` + "`" + `
-}
-
-type AnyURI string
+// AnyURI is kept for code written against earlier generated packages, whose
+// anyURI fields are now soap.AnyURI.
+type AnyURI = soap.AnyURI
 
 type NCName string
 
+{{range .Nillables}}
+	// {{.Name}} holds the value of a nillable element, which is encoded with
+	// xsi:nil="true" when Value is nil, and as null in JSON.
+	type {{.Name}} struct {
+		Value {{.Value}}
+	}
+
+	func (n {{.Name}}) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+		return soap.EncodeNillable(e, start, n.Value)
+	}
+
+	func (n *{{.Name}}) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+		return soap.DecodeNillable(d, start, &n.Value)
+	}
+
+	func (n {{.Name}}) MarshalJSON() ([]byte, error) {
+		return json.Marshal(n.Value)
+	}
+
+	func (n *{{.Name}}) UnmarshalJSON(data []byte) error {
+		return json.Unmarshal(data, &n.Value)
+	}
+{{end}}
+{{end}}
 `
@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+// resolveWSDLImports merges the definitions of the WSDL documents imported by
+// def, which was read from loc, into the WSDL of g, along with the schemas
+// they import. Relative locations are resolved against the location of the
+// importing document, so that a contract split in files across directories is
+// read from the local filesystem only. A wsdl:import of a schema document adds
+// the schema.
+func (g *GoWSDL) resolveWSDLImports(def *WSDL, loc *Location) error {
+	if g.resolvedWSDLImports == nil {
+		g.resolvedWSDLImports = map[string]bool{loc.String(): true}
+	}
+
+	for _, imp := range def.Imports {
+		if imp.Location == "" {
+			continue
+		}
+		location, err := loc.Parse(imp.Location)
+		if err != nil {
+			return err
+		}
+		if g.resolvedWSDLImports[location.String()] {
+			continue
+		}
+		g.resolvedWSDLImports[location.String()] = true
+
+		data, err := g.fetchReference(loc, location)
+		if err != nil {
+			return err
+		}
+
+		if rootElement(data) == "schema" {
+			schema := new(XSDSchema)
+			if err := xml.Unmarshal(data, schema); err != nil {
+				return fmt.Errorf("%s: %w", location, err)
+			}
+			if err := g.resolveXSDExternals(schema, location); err != nil {
+				return err
+			}
+			g.wsdl.Types.Schemas = append(g.wsdl.Types.Schemas, schema)
+			continue
+		}
+
+		imported := new(WSDL)
+		if err := xml.Unmarshal(data, imported); err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+		for _, schema := range imported.Types.Schemas {
+			if err := g.resolveXSDExternals(schema, location); err != nil {
+				return err
+			}
+		}
+		g.wsdl.Types.Schemas = append(g.wsdl.Types.Schemas, imported.Types.Schemas...)
+		g.wsdl.Messages = append(g.wsdl.Messages, imported.Messages...)
+		g.wsdl.PortTypes = append(g.wsdl.PortTypes, imported.PortTypes...)
+		g.wsdl.Binding = append(g.wsdl.Binding, imported.Binding...)
+		g.wsdl.Service = append(g.wsdl.Service, imported.Service...)
+
+		if err := g.resolveWSDLImports(imported, location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchReference returns the content of the document at location, which is
+// referenced by the document at base. A missing file is reported with its
+// path, rather than leaving its definitions out of the generated code.
+func (g *GoWSDL) fetchReference(base, location *Location) ([]byte, error) {
+	data, err := g.fetchFile(location)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot find %s, referenced by %s", location, base)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s, referenced by %s: %w", location, base, err)
+	}
+	return data, nil
+}
+
+// rootElement returns the local name of the root element of the XML document
+// data, or an empty string if it has none.
+func rootElement(data []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return ""
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			return se.Name.Local
+		}
+	}
+}
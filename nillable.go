@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// nillableType is a type generated for the fields of nillable elements of a
+// Go type, which holds a pointer to their value and encodes a nil one with
+// xsi:nil="true".
+type nillableType struct {
+	Name  string
+	Value string
+}
+
+// isNillable reports whether el is a nillable element that is always present,
+// whose field is generated with a nillable type, as encoding/xml leaves out
+// the elements of nil pointers. Optional elements keep their pointer field,
+// since they can be left out rather than marked nil.
+func isNillable(el *XSDElement) bool {
+	return el.Nillable && el.MinOccurs != "0" && !isRepeated(el.MaxOccurs) && !el.choice
+}
+
+// nillableType returns the name of the nillable type of goType generated in
+// package pkg, recording it so that it is declared with the helper types of
+// the package. Nillable types are named after the Go type of their value,
+// and numbered when the names of distinct types clash, such as the string
+// built-in and a schema type named String.
+func (g *GoWSDL) nillableType(pkg, goType string) string {
+	value := goType
+	if !strings.HasPrefix(goType, "*") && !strings.HasPrefix(goType, "[]") {
+		value = "*" + goType
+	}
+
+	if g.nillables == nil {
+		g.nillables = make(map[string]map[string]string)
+	}
+	names := g.nillables[pkg]
+	if names == nil {
+		names = make(map[string]string)
+		g.nillables[pkg] = names
+	}
+	if name, ok := names[value]; ok {
+		return name
+	}
+
+	name := strings.TrimPrefix(goType, "*")
+	if strings.HasPrefix(name, "[]") {
+		name = strings.TrimPrefix(name, "[]") + "s"
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	if name != "" {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	name = "Nillable" + name
+
+	taken := make(map[string]bool, len(names))
+	for _, n := range names {
+		taken[n] = true
+	}
+	base := name
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+
+	names[value] = name
+	return name
+}
+
+// nillableTypes returns the nillable types generated in package pkg, sorted by
+// name.
+func (g *GoWSDL) nillableTypes(pkg string) []nillableType {
+	var types []nillableType
+	for value, name := range g.nillables[pkg] {
+		types = append(types, nillableType{Name: name, Value: value})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
@@ -6,15 +6,17 @@ package gowsdl
 
 var opsTmpl = `
 {{range .}}
-	{{$privateType := .Name | makePrivate}}
-	{{$exportType := .Name | makePublic}}
+	{{$portType := .Name}}
+	{{$privateType := portTypeName .Name | makePrivate}}
+	{{$exportType := portTypeName .Name | makePublic}}
 
 	type {{$exportType}} interface {
 		{{range .Operations}}
 			{{$faults := len .Faults}}
-			{{$soapAction := findSOAPAction .Name $privateType}}
-			{{$requestType := findType .Input.Message | replaceReservedWords | makePublic}}
-			{{$responseType := findType .Output.Message | replaceReservedWords | makePublic}}
+			{{$soapAction := findSOAPAction .Name $portType}}
+			{{$requestType := findType .Input.Message | replaceReservedWords | makePublic | packageQualify .Input.Message}}
+			{{$responseType := findType .Output.Message | replaceReservedWords | makePublic | packageQualify .Output.Message}}
+			{{$headers := findSOAPHeaders .Name $portType}}
 
 			{{/*if ne $soapAction ""*/}}
 			{{if gt $faults 0}}
@@ -22,9 +24,9 @@ var opsTmpl = `
 			// {{range .Faults}}
 			//   - {{.Name}} {{.Doc}}{{end}}{{end}}
 			{{if ne .Doc ""}}/* {{.Doc}} */{{end}}
-			{{makePublic .Name | replaceReservedWords}} ({{if ne $requestType ""}}request *{{$requestType}}{{end}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error)
+			{{makePublic .Name | replaceReservedWords}} ({{operationParams $requestType $headers}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error)
 			{{/*end*/}}
-			{{makePublic .Name | replaceReservedWords}}Context (ctx context.Context, {{if ne $requestType ""}}request *{{$requestType}}{{end}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error)
+			{{makePublic .Name | replaceReservedWords}}Context (ctx context.Context, {{operationParams $requestType $headers}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error)
 			{{/*end*/}}
 		{{end}}
 	}
@@ -40,12 +42,38 @@ var opsTmpl = `
 	}
 
 	{{range .Operations}}
-		{{$requestType := findType .Input.Message | replaceReservedWords | makePublic}}
-		{{$soapAction := findSOAPAction .Name $privateType}}
-		{{$responseType := findType .Output.Message | replaceReservedWords | makePublic}}
-		func (service *{{$privateType}}) {{makePublic .Name | replaceReservedWords}}Context (ctx context.Context, {{if ne $requestType ""}}request *{{$requestType}}{{end}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error) {
-			{{if ne $responseType ""}}response := new({{$responseType}}){{end}}
-			err := service.client.CallContext(ctx, "{{if ne $soapAction ""}}{{$soapAction}}{{else}}''{{end}}", {{if ne $requestType ""}}request{{else}}nil{{end}}, {{if ne $responseType ""}}response{{else}}struct{}{}{{end}})
+		{{$requestType := findType .Input.Message | replaceReservedWords | makePublic | packageQualify .Input.Message}}
+		{{$soapAction := findSOAPAction .Name $portType}}
+		{{$responseType := findType .Output.Message | replaceReservedWords | makePublic | packageQualify .Output.Message}}
+		{{$headers := findSOAPHeaders .Name $portType}}
+		{{$rpcWrapper := ""}}{{if eq $requestType ""}}{{$rpcWrapper = findRPCWrapper .Name $portType .Input.Message}}{{end}}
+		{{$requestElement := ""}}{{if ne $requestType ""}}{{$requestElement = findPartElement .Name $portType .Input.Message}}{{end}}
+		{{$responseElement := ""}}{{if ne $responseType ""}}{{$responseElement = findPartElement .Name $portType .Output.Message}}{{end}}
+		func (service *{{$privateType}}) {{makePublic .Name | replaceReservedWords}}Context (ctx context.Context, {{operationParams $requestType $headers}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error) {
+			{{if $headers}}ctx = soap.ContextWithHeaders(ctx{{range $headers}}, {{.Name}}{{end}})
+			{{end -}}
+			{{if ne $rpcWrapper ""}}// The input has no parts, but rpc style still expects the operation element.
+			request := &struct {
+				XMLName xml.Name ` + "`" + `xml:"{{$rpcWrapper}}"` + "`" + `
+			}{}
+			{{end -}}
+			{{if ne $requestElement ""}}// The input part is sent as the {{$requestElement}} element.
+			requestPart := &struct {
+				XMLName xml.Name ` + "`" + `xml:"{{$requestElement}}"` + "`" + `
+				*{{$requestType}}
+			}{xml.Name{}, request}
+			{{end -}}
+			{{if ne $responseType ""}}response := new({{$responseType}})
+			{{if ne $responseElement ""}}// The output part is received as the {{$responseElement}} element.
+			responsePart := &struct {
+				XMLName xml.Name ` + "`" + `xml:"{{$responseElement}}"` + "`" + `
+				*{{$responseType}}
+			}{xml.Name{}, response}
+			{{end -}}
+			err := service.client.CallContext(ctx, "{{if ne $soapAction ""}}{{$soapAction}}{{else}}''{{end}}", {{if ne $requestElement ""}}requestPart{{else if or (ne $requestType "") (ne $rpcWrapper "")}}request{{else}}nil{{end}}, {{if ne $responseElement ""}}responsePart{{else}}response{{end}})
+			{{else}}
+			err := service.client.CallOneWay(ctx, "{{if ne $soapAction ""}}{{$soapAction}}{{else}}''{{end}}", {{if ne $requestElement ""}}requestPart{{else if or (ne $requestType "") (ne $rpcWrapper "")}}request{{else}}nil{{end}})
+			{{end}}
 			if err != nil {
 				return {{if ne $responseType ""}}nil, {{end}}err
 			}
@@ -53,10 +81,11 @@ var opsTmpl = `
 			return {{if ne $responseType ""}}response, {{end}}nil
 		}
 
-		func (service *{{$privateType}}) {{makePublic .Name | replaceReservedWords}} ({{if ne $requestType ""}}request *{{$requestType}}{{end}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error) {
+		func (service *{{$privateType}}) {{makePublic .Name | replaceReservedWords}} ({{operationParams $requestType $headers}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error) {
 			return service.{{makePublic .Name | replaceReservedWords}}Context(
-				context.Background(),
-				{{if ne $requestType ""}}request,{{end}}
+				context.Background(),{{if ne $requestType ""}}
+				request,{{end}}{{range $headers}}
+				{{.Name}},{{end}}
 			)
 		}
 
@@ -0,0 +1,375 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Namespace tokens that carry no meaning on their own and make poor package names.
+var genericNamespaceTokens = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"urn":     true,
+	"www":     true,
+	"xsd":     true,
+	"wsdl":    true,
+	"xml":     true,
+	"schema":  true,
+	"schemas": true,
+	"ns":      true,
+}
+
+// namespaceToken derives a short, lower case Go identifier from an XML
+// namespace, such as "stockquote" for "http://example.com/stockquote.xsd".
+func namespaceToken(namespace string) string {
+	segments := strings.FieldsFunc(namespace, func(r rune) bool {
+		return r == ':' || r == '/' || r == '#' || r == '?'
+	})
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := strings.ToLower(segments[i])
+		if ext := path.Ext(segment); ext != "" && i == len(segments)-1 {
+			segment = strings.TrimSuffix(segment, ext)
+		}
+		if i == 1 && strings.Contains(segment, ".") {
+			// Host name, e.g. example.com.
+			segment = strings.TrimPrefix(segment, "www.")
+			segment = strings.Split(segment, ".")[0]
+		}
+
+		token := strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return r
+			}
+			return -1
+		}, segment)
+
+		if token == "" || genericNamespaceTokens[token] || isVersionToken(token) {
+			continue
+		}
+		if unicode.IsDigit(rune(token[0])) {
+			token = "ns" + token
+		}
+		return token
+	}
+
+	return "ns"
+}
+
+func isVersionToken(token string) bool {
+	token = strings.TrimPrefix(token, "v")
+	return strings.IndexFunc(token, func(r rune) bool { return !unicode.IsDigit(r) }) == -1
+}
+
+// namespacePackages assigns a distinct package name to every target namespace
+// declared by schemas. Clashing names are numbered in namespace order so the
+// result is stable across runs.
+func namespacePackages(schemas []*XSDSchema) map[string]string {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, schema := range schemas {
+		if !seen[schema.TargetNamespace] {
+			seen[schema.TargetNamespace] = true
+			namespaces = append(namespaces, schema.TargetNamespace)
+		}
+	}
+	sort.Strings(namespaces)
+
+	packages := make(map[string]string, len(namespaces))
+	taken := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		name := namespaceToken(ns)
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s%d", namespaceToken(ns), i)
+		}
+		taken[name] = true
+		packages[ns] = name
+	}
+
+	return packages
+}
+
+// resolveNamespace returns the namespace of a QName used within schema.
+// Unprefixed names resolve to the default namespace, if any, or to the
+// schema target namespace. Schemas commonly make the XML Schema namespace
+// their default one while still referencing their own types unprefixed, so
+// names that are not built-in types resolve to the target namespace then.
+func resolveNamespace(schema *XSDSchema, qname string) string {
+	x := strings.SplitN(qname, ":", 2)
+	if len(x) == 2 {
+		return schema.Xmlns[x[0]]
+	}
+	if ns, ok := schema.Xmlns[""]; ok {
+		if ns != xmlschema11 || xsd2GoTypes[strings.ToLower(qname)] != "" {
+			return ns
+		}
+	}
+	return schema.TargetNamespace
+}
+
+// qualifyGoType prefixes a generated type with the package its namespace is
+// generated into, unless that package is pkg itself. Packages referenced this
+// way are recorded in imports.
+func (g *GoWSDL) qualifyGoType(goType, namespace, pkg string, imports map[string]bool) string {
+	if g.packages == nil || !strings.HasPrefix(goType, "*") {
+		return goType
+	}
+
+	typePkg, ok := g.packages[namespace]
+	if !ok || typePkg == pkg {
+		return goType
+	}
+
+	imports[typePkg] = true
+	return "*" + typePkg + "." + goType[1:]
+}
+
+// genPackages generates one package per target namespace and returns their
+// source keyed by file path, relative to the directory of the main package.
+func (g *GoWSDL) genPackages() (map[string][]byte, error) {
+	byPackage := make(map[string][]*XSDSchema)
+	for _, schema := range g.wsdl.Types.Schemas {
+		pkg := g.packages[schema.TargetNamespace]
+		byPackage[pkg] = append(byPackage[pkg], schema)
+	}
+
+	deps := make(map[string]map[string]bool, len(byPackage))
+	files := make(map[string][]byte, len(byPackage))
+	for pkg, schemas := range byPackage {
+		imports := make(map[string]bool)
+		types, err := g.genSchemaTypes(schemas, pkg, imports)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err := g.genPackageHeader(pkg, imports, false, true)
+		if err != nil {
+			return nil, err
+		}
+
+		deps[pkg] = imports
+		files[path.Join(pkg, pkg+".go")] = append(header, types...)
+	}
+
+	if err := checkImportCycles(deps); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// genTypeFiles generates the types of every target namespace into a file of
+// the main package, named after the namespace, and the helper types into
+// common.go, and returns their source keyed by file name.
+func (g *GoWSDL) genTypeFiles() (map[string][]byte, error) {
+	names := namespacePackages(g.wsdl.Types.Schemas)
+	byNamespace := make(map[string][]*XSDSchema)
+	for _, schema := range g.wsdl.Types.Schemas {
+		byNamespace[schema.TargetNamespace] = append(byNamespace[schema.TargetNamespace], schema)
+	}
+
+	header, err := g.genPackageHeader(g.pkg, nil, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(byNamespace)+1)
+	for namespace, schemas := range byNamespace {
+		types, err := g.genSchemaTypes(schemas, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		files["types_"+names[namespace]+".go"] = append(append([]byte{}, header...), types...)
+	}
+
+	files["common.go"], err = g.genPackageHeader(g.pkg, nil, false, true)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// checkImportCycles returns an error if namespaces generated into different
+// packages depend on each other, since Go does not allow import cycles.
+func checkImportCycles(deps map[string]map[string]bool) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(deps))
+
+	var visit func(pkg string, trail []string) error
+	visit = func(pkg string, trail []string) error {
+		switch state[pkg] {
+		case visiting:
+			return fmt.Errorf("namespaces generated into packages %s import each other; "+
+				"they cannot be generated as separate packages", strings.Join(append(trail, pkg), " -> "))
+		case done:
+			return nil
+		}
+
+		state[pkg] = visiting
+		for _, dep := range sortedKeys(deps[pkg]) {
+			if err := visit(dep, append(trail, pkg)); err != nil {
+				return err
+			}
+		}
+		state[pkg] = done
+		return nil
+	}
+
+	var pkgs []string
+	for pkg := range deps {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		if err := visit(pkg, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeRenames finds top level types declared under the same Go name by schemas
+// of different target namespaces, which would not compile when generated into
+// a single package. The type declared first keeps its name, while the others
+// are prefixed with a token of their namespace, such as ShippingAddress for
+// Address in "http://example.com/shipping.xsd". Renamed types are keyed by
+// namespace and XSD name. Renaming follows document order, so it is stable
+// across runs.
+func typeRenames(schemas []*XSDSchema) map[string]map[string]string {
+	type declaration struct {
+		namespace, name, goName string
+	}
+
+	var decls []declaration
+	owners := make(map[string]string)
+	for _, schema := range schemas {
+		for _, name := range declaredTypeNames(schema) {
+			goName := makePublic(replaceReservedWords(name))
+			decls = append(decls, declaration{schema.TargetNamespace, name, goName})
+			if _, ok := owners[goName]; !ok {
+				owners[goName] = schema.TargetNamespace
+			}
+		}
+	}
+
+	renames := make(map[string]map[string]string)
+	for _, decl := range decls {
+		if owners[decl.goName] == decl.namespace || renames[decl.namespace][decl.name] != "" {
+			continue
+		}
+
+		prefix := makePublic(namespaceToken(decl.namespace))
+		renamed := prefix + decl.goName
+		for i := 2; owners[renamed] != ""; i++ {
+			renamed = fmt.Sprintf("%s%d%s", prefix, i, decl.goName)
+		}
+		owners[renamed] = decl.namespace
+
+		if renames[decl.namespace] == nil {
+			renames[decl.namespace] = make(map[string]string)
+		}
+		renames[decl.namespace][decl.name] = renamed
+	}
+
+	return renames
+}
+
+// declaredTypeNames returns the names of the top level Go types generated for
+// schema. Elements of a named type only declare a type of their own when
+// their name differs from it.
+func declaredTypeNames(schema *XSDSchema) []string {
+	var names []string
+	for _, st := range schema.SimpleType {
+		names = append(names, st.Name)
+	}
+	for _, el := range schema.Elements {
+		if el.Type == "" && el.ComplexType != nil {
+			names = append(names, el.Name)
+		} else if el.Type != "" && makePublic(el.Name) != makePublic(stripns(el.Type)) {
+			names = append(names, el.Name)
+		}
+	}
+	for _, ct := range schema.ComplexTypes {
+		names = append(names, ct.Name)
+	}
+	return names
+}
+
+// portTypeNames finds port types whose generated interface, implementation or
+// constructor would clash with a generated type, which happens when the schema
+// shares the namespace, and often the names, of the WSDL, or in multi-package
+// mode with the name of an imported namespace package. Those port types are
+// suffixed with PortType, keyed by their WSDL name.
+func (g *GoWSDL) portTypeNames() map[string]string {
+	taken := g.takenTypeNames()
+	clashes := func(name string) bool {
+		exported := g.makePublicFn(name)
+		return taken[exported] || taken[makePrivate(exported)] || taken["New"+exported]
+	}
+
+	names := make(map[string]string)
+	for _, portType := range g.wsdl.PortTypes {
+		if !clashes(portType.Name) {
+			continue
+		}
+
+		name := portType.Name + "PortType"
+		for i := 2; clashes(name); i++ {
+			name = fmt.Sprintf("%sPortType%d", portType.Name, i)
+		}
+		names[portType.Name] = name
+	}
+	return names
+}
+
+// takenTypeNames returns the names of the Go types generated for the schemas,
+// and of the types the generated code declares next to them. In multi-package
+// mode, those are the names of the namespace packages instead, which the
+// generated code imports.
+func (g *GoWSDL) takenTypeNames() map[string]bool {
+	taken := map[string]bool{"AnyType": true, "AnyURI": true, "NCName": true}
+	if g.packages != nil {
+		for _, pkg := range g.packages {
+			taken[pkg] = true
+		}
+		return taken
+	}
+	for _, schema := range g.wsdl.Types.Schemas {
+		for _, name := range declaredTypeNames(schema) {
+			if renamed, ok := g.renames[schema.TargetNamespace][name]; ok {
+				taken[renamed] = true
+			} else {
+				taken[g.makePublicFn(replaceReservedWords(name))] = true
+			}
+		}
+	}
+	return taken
+}
+
+// portTypeName returns the name the interface of portType is generated after.
+func (g *GoWSDL) portTypeName(portType string) string {
+	if name, ok := g.portTypes[portType]; ok {
+		return name
+	}
+	return portType
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,64 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import "encoding/xml"
+
+// derivedTypes returns the complex types derived, directly or not, from each
+// abstract complex type of schemas that has derivations, keyed by the abstract
+// type. Derived types are listed breadth first, in document order.
+func derivedTypes(schemas []*XSDSchema) map[xml.Name][]xml.Name {
+	abstract := make(map[xml.Name]bool)
+	children := make(map[xml.Name][]xml.Name)
+	var order []xml.Name
+	for _, schema := range schemas {
+		for _, ct := range schema.ComplexTypes {
+			name := xml.Name{Space: schema.TargetNamespace, Local: ct.Name}
+			order = append(order, name)
+			if ct.Abstract {
+				abstract[name] = true
+			}
+			if base := ct.ComplexContent.Extension.Base; base != "" {
+				baseName := xml.Name{Space: resolveNamespace(schema, base), Local: stripns(base)}
+				children[baseName] = append(children[baseName], name)
+			}
+		}
+	}
+
+	derived := make(map[xml.Name][]xml.Name)
+	for _, name := range order {
+		if !abstract[name] {
+			continue
+		}
+
+		seen := map[xml.Name]bool{name: true}
+		queue := children[name]
+		for len(queue) > 0 {
+			child := queue[0]
+			queue = queue[1:]
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			if !abstract[child] {
+				derived[name] = append(derived[name], child)
+			}
+			queue = append(queue, children[child]...)
+		}
+	}
+	return derived
+}
+
+// registeredTypes returns the derived types that are registered for xsi:type
+// dispatch, the non abstract types derived from abstract types.
+func registeredTypes(derived map[xml.Name][]xml.Name) map[xml.Name]bool {
+	registered := make(map[xml.Name]bool)
+	for _, names := range derived {
+		for _, name := range names {
+			registered[name] = true
+		}
+	}
+	return registered
+}
@@ -0,0 +1,181 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const soapEncodingNamespace = "http://schemas.xmlsoap.org/soap/encoding/"
+
+// rpcMessage is a message of an rpc style operation, generated as a struct
+// named after the message, marshaled as the operation element, or as its
+// response element, with the message parts as children.
+type rpcMessage struct {
+	// Message is the WSDL name of the message.
+	Message string
+	// Name is the name of the generated struct.
+	Name string
+	// Element is the name of the operation or response element.
+	Element xml.Name
+	// Encoded is set for rpc/encoded messages, whose parts are marked with
+	// their xsi:type.
+	Encoded bool
+	Parts   []rpcPart
+}
+
+// rpcPart is a part of an rpc style message, generated as a field.
+type rpcPart struct {
+	// Name and Space name the part element, which is unqualified unless the
+	// part names a global element.
+	Name  string
+	Space string
+	Field string
+	Type  string
+	// XSIType is the schema type of the part, set for type parts.
+	XSIType xml.Name
+}
+
+// rpcMessageTypes returns the messages of the operations of rpc style
+// bindings that have parts. Messages without parts are sent as an empty
+// operation element, see findRPCWrapper. A message shared by several
+// operations is generated for the first one.
+func (g *GoWSDL) rpcMessageTypes() []*rpcMessage {
+	taken := g.takenTypeNames()
+	seen := make(map[string]bool)
+	var messages []*rpcMessage
+
+	add := func(message, tag string, body WSDLSOAPBody) {
+		msg := g.findMessage(message)
+		if msg == nil || len(msg.Parts) == 0 || seen[msg.Name] {
+			return
+		}
+		seen[msg.Name] = true
+
+		name := g.makePublicFn(replaceReservedWords(normalize(msg.Name)))
+		if taken[name] {
+			name += "Message"
+		}
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%sMessage%d", g.makePublicFn(replaceReservedWords(normalize(msg.Name))), i)
+		}
+		taken[name] = true
+
+		m := &rpcMessage{Message: msg.Name, Name: name, Element: rpcElementName(tag), Encoded: body.Use == "encoded"}
+		for _, part := range bodyParts(msg, body) {
+			m.Parts = append(m.Parts, g.rpcPart(part, m.Encoded))
+		}
+		messages = append(messages, m)
+	}
+
+	for _, binding := range g.wsdl.Binding {
+		portType := g.findPortType(stripns(binding.Type))
+		if portType == nil {
+			continue
+		}
+
+		for _, soapOp := range binding.Operations {
+			tag := g.rpcOperationElement(soapOp.Name, portType.Name)
+			if tag == "" {
+				continue
+			}
+			for _, op := range portType.Operations {
+				if op.Name != soapOp.Name {
+					continue
+				}
+
+				add(op.Input.Message, tag, soapOp.Input.SOAPBody)
+
+				// The response element is named after the operation,
+				// suffixed with Response, in the namespace of the output.
+				namespace := soapOp.Output.SOAPBody.Namespace
+				if namespace == "" {
+					namespace = g.wsdl.TargetNamespace
+				}
+				add(op.Output.Message, strings.TrimSpace(namespace+" "+op.Name+"Response"), soapOp.Output.SOAPBody)
+			}
+		}
+	}
+	return messages
+}
+
+// bodyParts returns the parts of msg sent in the SOAP body, which the parts
+// attribute of body restricts when set, the others being header parts.
+func bodyParts(msg *WSDLMessage, body WSDLSOAPBody) []*WSDLPart {
+	if body.Parts == "" {
+		return msg.Parts
+	}
+
+	listed := make(map[string]bool)
+	for _, name := range strings.Fields(body.Parts) {
+		listed[name] = true
+	}
+	var parts []*WSDLPart
+	for _, part := range msg.Parts {
+		if listed[part.Name] {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// rpcPart returns the field generated for part. Parts with a built-in or SOAP
+// encoding type are values, and parts with a generated type are pointers.
+func (g *GoWSDL) rpcPart(part *WSDLPart, encoded bool) rpcPart {
+	namespace, name := g.partType(part)
+
+	p := rpcPart{
+		Name:  part.Name,
+		Field: g.makePublicFn(replaceReservedWords(normalize(part.Name))),
+	}
+	if part.Element != "" {
+		p.Name = stripns(part.Element)
+		p.Space = g.wsdl.Xmlns[strings.SplitN(part.Element, ":", 2)[0]]
+	} else if encoded {
+		p.XSIType = xml.Name{Space: namespace, Local: name}
+	}
+
+	switch {
+	case namespace == xmlschema11 || namespace == soapEncodingNamespace:
+		p.Type = toGoType(name)
+	default:
+		if renamed, ok := g.renames[namespace][name]; ok {
+			name = renamed
+		}
+		p.Type = g.qualifyGoType("*"+replaceReservedWords(g.makePublicFn(name)), namespace, g.pkg, g.opsImports)
+	}
+	return p
+}
+
+// findRPCMessage returns the rpc style message generated for message, or nil
+// if it is not one.
+func (g *GoWSDL) findRPCMessage(message string) *rpcMessage {
+	for _, m := range g.rpcMessages {
+		if m.Message == stripns(message) {
+			return m
+		}
+	}
+	return nil
+}
+
+func (g *GoWSDL) findMessage(message string) *WSDLMessage {
+	for _, msg := range g.wsdl.Messages {
+		if msg.Name == stripns(message) {
+			return msg
+		}
+	}
+	return nil
+}
+
+func (g *GoWSDL) findPortType(name string) *WSDLPortType {
+	for _, portType := range g.wsdl.PortTypes {
+		if strings.EqualFold(portType.Name, name) {
+			return portType
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+var rpcTmpl = `
+{{range .}}
+	// {{.Name}} is the {{.Message}} message of an rpc{{if .Encoded}}/encoded{{end}} style operation. Its
+	// element wraps the message parts, in order. It is decoded in any namespace,
+	// as rpc services often answer in a namespace of their own.
+	type {{.Name}} struct {
+		XMLName xml.Name ` + "`" + `xml:"{{.Element.Local}}"{{jsonTag "-"}}` + "`" + `
+		{{range .Parts}}
+			{{.Field}} {{.Type}} ` + "`" + `xml:"{{with .Space}}{{.}} {{end}}{{.Name}}"{{jsonTag .Name}}` + "`" + `
+		{{end}}
+	}
+
+	// MarshalXML implements xml.Marshaler, encoding the parts unqualified{{if .Encoded}} and
+	// marked with their xsi:type{{end}}.
+	func (m {{.Name}}) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+		start.Name = xml.Name{ {{- with .Element.Space}}Space: "{{.}}", {{end}}Local: "{{.Element.Local}}"}
+		return soap.MarshalRPC(e, start, {{.Encoded}},
+			{{- range .Parts}}
+			soap.RPCPart{Name: xml.Name{ {{- with .Space}}Space: "{{.}}", {{end}}Local: "{{.Name}}"}
+				{{- if .XSIType.Local}}, Type: xml.Name{Space: "{{.XSIType.Space}}", Local: "{{.XSIType.Local}}"}{{end}}, Value: m.{{.Field}}},
+			{{- end}}
+		)
+	}
+{{end}}
+`
@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+var serverTmpl = `
+{{range .}}
+	{{$portType := .Name}}
+	{{$exportType := portTypeName .Name | makePublic}}
+
+	// {{$exportType}}Server is implemented by services serving the operations of
+	// {{$exportType}}. The SOAP headers of a request are available from its context
+	// with soap.RequestHeader.
+	type {{$exportType}}Server interface {
+		{{range .Operations}}
+			{{$requestType := findType .Input.Message | replaceReservedWords | makePublic | packageQualify .Input.Message}}
+			{{$responseType := findType .Output.Message | replaceReservedWords | makePublic | packageQualify .Output.Message}}
+			{{if ne .Doc ""}}/* {{.Doc}} */{{end}}
+			{{makePublic .Name | replaceReservedWords}} (ctx context.Context{{if ne $requestType ""}}, request *{{$requestType}}{{end}}) ({{if ne $responseType ""}}*{{$responseType}}, {{end}}error)
+		{{end}}
+	}
+
+	// New{{$exportType}}Handler returns an http.Handler decoding the SOAP requests
+	// of {{$exportType}}, serving them with server and encoding its responses, or
+	// the SOAP faults its errors map to.
+	func New{{$exportType}}Handler(server {{$exportType}}Server) http.Handler {
+		return soap.NewHandler(
+			{{- range .Operations}}
+			{{- $requestType := findType .Input.Message | replaceReservedWords | makePublic | packageQualify .Input.Message}}
+			{{- $responseType := findType .Output.Message | replaceReservedWords | makePublic | packageQualify .Output.Message}}
+			{{- $element := findInputElement .Name $portType .Input.Message}}
+			soap.ServerOperation{
+				Action:  "{{findSOAPAction .Name $portType}}",
+				Element: xml.Name{Space: "{{$element.Space}}", Local: "{{$element.Local}}"},
+				{{- if ne $requestType ""}}
+				Request: func() interface{} { return new({{$requestType}}) },
+				{{- end}}
+				Serve: func(ctx context.Context, request interface{}) (interface{}, error) {
+					{{- if ne $responseType ""}}
+					response, err := server.{{makePublic .Name | replaceReservedWords}}(ctx{{if ne $requestType ""}}, request.(*{{$requestType}}){{end}})
+					// A nil response is returned as such, rather than as a
+					// non nil interface holding a nil pointer, so that it is
+					// answered with a fault.
+					if response == nil {
+						return nil, err
+					}
+					return response, err
+					{{- else}}
+					return nil, server.{{makePublic .Name | replaceReservedWords}}(ctx{{if ne $requestType ""}}, request.(*{{$requestType}}){{end}})
+					{{- end}}
+				},
+				{{- if eq $responseType ""}}
+				OneWay: true,
+				{{- end}}
+			},
+			{{- end}}
+		)
+	}
+{{end}}
+`
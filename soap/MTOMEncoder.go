@@ -1,6 +1,8 @@
 package soap
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -9,13 +11,19 @@ import (
 	"math/rand"
 	"mime"
 	"mime/multipart"
+	"mime/quotedprintable"
 	"net/textproto"
+	"net/url"
 	"reflect"
 	"strings"
 )
 
 type mtomEncoder struct {
 	writer *multipart.Writer
+	// rootType is the Content-Type of the root part holding the envelope.
+	rootType string
+	// prefixes are the namespace prefixes the envelope is marshaled with.
+	prefixes map[string]string
 }
 
 // Binary enables binary data to be enchanged in MTOM mode with XOP encoding
@@ -25,6 +33,11 @@ type Binary struct {
 	contentType string
 	packageID   string
 	useMTOM     bool
+	// contentID, transferEncoding and contentDisposition are the MIME part
+	// headers set by the caller.
+	contentID          string
+	transferEncoding   string
+	contentDisposition string
 }
 
 type xopPlaceholder struct {
@@ -33,7 +46,7 @@ type xopPlaceholder struct {
 
 // NewBinary allocate a new Binary backed by the given byte slice
 func NewBinary(v []byte) *Binary {
-	return &Binary{&v, "application/octet-stream", "", false}
+	return &Binary{content: &v, contentType: "application/octet-stream"}
 }
 
 // Bytes returns a slice backed by the content of the field
@@ -52,10 +65,56 @@ func (b *Binary) ContentType() string {
 	return b.contentType
 }
 
+// SetContentID sets the Content-ID of the MIME part the content is transmitted
+// in, without its angle brackets. A random one is used by default.
+func (b *Binary) SetContentID(contentID string) *Binary {
+	b.contentID = contentID
+	return b
+}
+
+// ContentID returns the Content-ID of the MIME part the content was last
+// transmitted or received in, without its angle brackets.
+func (b *Binary) ContentID() string {
+	return b.packageID
+}
+
+// SetTransferEncoding sets the Content-Transfer-Encoding of the MIME part the
+// content is transmitted in, which is binary by default. The content is
+// encoded accordingly for the base64 and quoted-printable encodings, and sent
+// as is for the others.
+func (b *Binary) SetTransferEncoding(encoding string) *Binary {
+	b.transferEncoding = encoding
+	return b
+}
+
+// TransferEncoding returns the Content-Transfer-Encoding of the MIME part.
+func (b *Binary) TransferEncoding() string {
+	if b.transferEncoding == "" {
+		return "binary"
+	}
+	return b.transferEncoding
+}
+
+// SetContentDisposition sets the Content-Disposition of the MIME part the
+// content is transmitted in, as in `attachment; filename="report.pdf"`. The
+// part has none by default.
+func (b *Binary) SetContentDisposition(disposition string) *Binary {
+	b.contentDisposition = disposition
+	return b
+}
+
+// ContentDisposition returns the Content-Disposition of the MIME part.
+func (b *Binary) ContentDisposition() string {
+	return b.contentDisposition
+}
+
 // MarshalXML implements the xml.Marshaler interface to encode a Binary to XML
 func (b *Binary) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
 	if b.useMTOM {
-		b.packageID = fmt.Sprintf("%d", rand.Int())
+		b.packageID = b.contentID
+		if b.packageID == "" {
+			b.packageID = fmt.Sprintf("%d", rand.Int())
+		}
 		return enc.EncodeElement(struct {
 			Include *xopPlaceholder `xml:"http://www.w3.org/2004/08/xop/include Include"`
 		}{
@@ -64,7 +123,7 @@ func (b *Binary) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
 			},
 		}, start)
 	}
-	return enc.EncodeElement(b.Bytes, start)
+	return enc.EncodeElement(base64.StdEncoding.EncodeToString(b.Bytes()), start)
 }
 
 // UnmarshalXML implements the xml.Unmarshaler interface to decode a Binary form XML
@@ -78,18 +137,28 @@ func (b *Binary) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		return err
 	}
 
-	b.content = &ref.Content
-
 	if ref.Include != nil {
-		b.packageID = strings.TrimPrefix(ref.Include.Href, "cid:")
+		b.content = &ref.Content
+		b.packageID = normalizeContentID(ref.Include.Href)
 		b.useMTOM = true
+		return nil
+	}
+
+	// Without XOP the content is inline base64.
+	content, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(ref.Content)), ""))
+	if err != nil {
+		return err
 	}
+	b.content = &content
+	b.contentType = "application/octet-stream"
 	return nil
 }
 
-func newMtomEncoder(w io.Writer) *mtomEncoder {
+func newMtomEncoder(w io.Writer, rootType string, prefixes map[string]string) *mtomEncoder {
 	return &mtomEncoder{
-		writer: multipart.NewWriter(w),
+		writer:   multipart.NewWriter(w),
+		rootType: rootType,
+		prefixes: prefixes,
 	}
 }
 
@@ -102,35 +171,91 @@ func (e *mtomEncoder) Encode(v interface{}) error {
 	var err error
 
 	h := make(textproto.MIMEHeader)
-	h.Set("Content-Type", `application/xop+xml`)
+	h.Set("Content-Type", e.rootType)
 	h.Set("Content-Transfer-Encoding", "8bit")
 
 	if partWriter, err = e.writer.CreatePart(h); err != nil {
 		return err
 	}
-	xmlEncoder := xml.NewEncoder(partWriter)
+	xmlEncoder := newXMLEncoder(partWriter, e.prefixes)
 	if err := xmlEncoder.Encode(v); err != nil {
 		return err
 	}
 
 	for _, fld := range binaryFields {
 		pkg := fld.Interface().(*Binary)
+		if pkg == nil {
+			continue
+		}
 		h := make(textproto.MIMEHeader)
 		if pkg.contentType == "" {
 			pkg.contentType = "application/octet-stream"
 		}
 		h.Set("Content-Type", pkg.contentType)
 		h.Set("Content-ID", fmt.Sprintf("<%s>", pkg.packageID))
-		h.Set("Content-Transfer-Encoding", "binary")
+		h.Set("Content-Transfer-Encoding", pkg.TransferEncoding())
+		if pkg.contentDisposition != "" {
+			h.Set("Content-Disposition", pkg.contentDisposition)
+		}
 		if partWriter, err = e.writer.CreatePart(h); err != nil {
 			return err
 		}
-		partWriter.Write(*pkg.content)
+		if err := writePart(partWriter, pkg.TransferEncoding(), *pkg.content); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// writePart writes content to the MIME part w, encoded with the transfer
+// encoding of the part.
+func writePart(w io.Writer, encoding string, content []byte) error {
+	var enc io.WriteCloser
+	switch strings.ToLower(encoding) {
+	case "base64":
+		enc = base64.NewEncoder(base64.StdEncoding, &lineWriter{w: w})
+	case "quoted-printable":
+		enc = quotedprintable.NewWriter(w)
+	default:
+		_, err := w.Write(content)
+		return err
+	}
+	if _, err := enc.Write(content); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// lineWriter breaks the base64 text written to w into lines of 76 characters,
+// as MIME requires.
+type lineWriter struct {
+	w   io.Writer
+	col int
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if l.col == 76 {
+			if _, err := l.w.Write([]byte("\r\n")); err != nil {
+				return 0, err
+			}
+			l.col = 0
+		}
+		chunk := p
+		if len(chunk) > 76-l.col {
+			chunk = chunk[:76-l.col]
+		}
+		if _, err := l.w.Write(chunk); err != nil {
+			return 0, err
+		}
+		l.col += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
 func (e *mtomEncoder) Flush() error {
 	return e.writer.Close()
 }
@@ -148,16 +273,35 @@ func getBinaryFields(data interface{}, fields *[]reflect.Value) {
 		f := v.Field(i)
 		if _, ok := f.Interface().(*Binary); ok {
 			*fields = append(*fields, f)
+		} else if f.Kind() == reflect.Slice {
+			getBinarySliceFields(f, fields)
 		} else {
 			getBinaryFields(f.Interface(), fields)
 		}
 	}
 }
 
+// getBinarySliceFields appends the Binary fields held by the elements of the
+// slice v, such as those of repeated elements.
+func getBinarySliceFields(v reflect.Value, fields *[]reflect.Value) {
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		if _, ok := e.Interface().(*Binary); ok {
+			*fields = append(*fields, e)
+		} else {
+			getBinaryFields(e.Interface(), fields)
+		}
+	}
+}
+
 func enableMTOMMode(fields []reflect.Value) {
 	for _, f := range fields {
-		b := f.Interface().(*Binary)
-		b.useMTOM = true
+		if b := f.Interface().(*Binary); b != nil {
+			b.useMTOM = true
+		}
 	}
 }
 
@@ -197,6 +341,22 @@ func getMtomHeader(contentType string) (string, error) {
 	return "", nil
 }
 
+// normalizeContentID returns the Content-ID of a MIME part as found in its
+// Content-ID header, between angle brackets, or in the cid URL of an
+// xop:Include href, whose characters may be percent-encoded, so that parts
+// and references can be matched whatever the form each one uses.
+func normalizeContentID(id string) string {
+	id = strings.TrimSpace(id)
+	if len(id) >= 4 && strings.EqualFold(id[:4], "cid:") {
+		id = id[4:]
+	}
+	id = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+	return id
+}
+
 func newMtomDecoder(r io.Reader, boundary string) *mtomDecoder {
 	return &mtomDecoder{
 		reader: multipart.NewReader(r, boundary),
@@ -204,9 +364,6 @@ func newMtomDecoder(r io.Reader, boundary string) *mtomDecoder {
 }
 
 func (d *mtomDecoder) Decode(v interface{}) error {
-	fields := make([]reflect.Value, 0)
-	getBinaryFields(v, &fields)
-
 	packages := make(map[string]*Binary, 0)
 	for {
 		p, err := d.reader.NextPart()
@@ -217,11 +374,14 @@ func (d *mtomDecoder) Decode(v interface{}) error {
 			return err
 		}
 		contentType := p.Header.Get("Content-Type")
-		if contentType == "application/xop+xml" {
-			err := xml.NewDecoder(p).Decode(v)
+		if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/xop+xml" {
+			content, err := ioutil.ReadAll(p)
 			if err != nil {
 				return err
 			}
+			if err := xml.NewDecoder(bytes.NewReader(stripNilElements(content))).Decode(v); err != nil {
+				return err
+			}
 		} else {
 			contentID := p.Header.Get("Content-Id")
 			if contentID == "" {
@@ -232,7 +392,10 @@ func (d *mtomDecoder) Decode(v interface{}) error {
 				return err
 			}
 
-			contentID = strings.Trim(contentID, "<>")
+			contentID = normalizeContentID(contentID)
+			if _, ok := packages[contentID]; ok {
+				return fmt.Errorf("duplicate MTOM part for Content-ID %s", contentID)
+			}
 			packages[contentID] = &Binary{
 				content:     &content,
 				contentType: contentType,
@@ -240,11 +403,21 @@ func (d *mtomDecoder) Decode(v interface{}) error {
 		}
 	}
 
-	// Set binary fields with correct content
+	// Set binary fields with correct content, once the XML part allocated
+	// the structs holding them.
+	fields := make([]reflect.Value, 0)
+	getBinaryFields(v, &fields)
 	for _, f := range fields {
 		b := f.Interface().(*Binary)
-		b.content = packages[b.packageID].content
-		b.contentType = packages[b.packageID].contentType
+		if b == nil || !b.useMTOM {
+			continue
+		}
+		pkg, ok := packages[b.packageID]
+		if !ok {
+			return fmt.Errorf("missing MTOM part for Content-ID %s", b.packageID)
+		}
+		b.content = pkg.content
+		b.contentType = pkg.contentType
 	}
 	return nil
 }
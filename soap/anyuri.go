@@ -0,0 +1,18 @@
+package soap
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// AnyURI is an xsd:anyURI, a URI reference such as http://example.com/a or
+// ../a#b. It is marshaled as is.
+type AnyURI string
+
+// Validate checks that the value parses as a URI reference.
+func (u AnyURI) Validate() error {
+	if _, err := url.Parse(string(u)); err != nil {
+		return fmt.Errorf("invalid anyURI: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package soap
+
+import (
+	"encoding/xml"
+)
+
+// AnyXML holds an element as raw XML. Generated code uses it for elements of
+// type xsd:anyType and for the elements matched by xsd:any wildcards, whose
+// content is kept as is, so that callers can forward it or decode it
+// themselves. The namespace declarations of the element are kept, but not
+// those of its ancestors, which prefixes used in its content may rely on.
+type AnyXML struct {
+	XMLName xml.Name
+	// Attrs holds the attributes of the element, namespace declarations
+	// included.
+	Attrs []xml.Attr `xml:",any,attr"`
+	// InnerXML holds the content of the element.
+	InnerXML []byte `xml:",innerxml"`
+}
+
+// MarshalXML implements xml.Marshaler. The element is named after XMLName,
+// when set, and its namespace declarations are written as they were read, as
+// are the prefixes of its attributes in the declared namespaces.
+func (a AnyXML) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if a.XMLName.Local != "" {
+		start.Name = a.XMLName
+	}
+	prefixes := make(map[string]string)
+	for _, attr := range a.Attrs {
+		if attr.Name.Space == "xmlns" {
+			prefixes[attr.Value] = attr.Name.Local
+		}
+	}
+	for _, attr := range a.Attrs {
+		switch {
+		case attr.Name.Space == "xmlns":
+			attr.Name = xml.Name{Local: "xmlns:" + attr.Name.Local}
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			// The default namespace is the one of the element name.
+			continue
+		case prefixes[attr.Name.Space] != "":
+			attr.Name = xml.Name{Local: prefixes[attr.Name.Space] + ":" + attr.Name.Local}
+		}
+		start.Attr = append(start.Attr, attr)
+	}
+
+	content := struct {
+		InnerXML []byte `xml:",innerxml"`
+	}{a.InnerXML}
+	return e.EncodeElement(content, start)
+}
+
+// Unmarshal decodes the element held by a into v, as xml.Unmarshal does.
+func (a *AnyXML) Unmarshal(v interface{}) error {
+	data, err := xml.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
@@ -0,0 +1,116 @@
+package soap
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F of windows-1252, the only ones that
+// differ from ISO-8859-1. Bytes windows-1252 leaves undefined map to the C1
+// control characters, as in ISO-8859-1.
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+// iso885915 maps the bytes of ISO-8859-15 that differ from ISO-8859-1.
+var iso885915 = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž', 0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+}
+
+// charsetDecoder returns the function mapping the bytes of the single byte
+// charset label to runes, or nil for UTF-8 and its ASCII subset. As in web
+// browsers, ISO-8859-1 is decoded as windows-1252, its superset that legacy
+// services send under the ISO-8859-1 label.
+func charsetDecoder(label string) (func(byte) rune, error) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return nil, nil
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1", "cp819",
+		"windows-1252", "cp1252", "x-cp1252":
+		return func(b byte) rune {
+			if b >= 0x80 && b < 0xA0 {
+				return windows1252[b-0x80]
+			}
+			return rune(b)
+		}, nil
+	case "iso-8859-15", "iso8859-15", "iso_8859-15", "latin9", "l9":
+		return func(b byte) rune {
+			if r, ok := iso885915[b]; ok {
+				return r
+			}
+			return rune(b)
+		}, nil
+	}
+	return nil, fmt.Errorf("soap: unsupported charset %q", label)
+}
+
+// charsetReader is an xml.Decoder CharsetReader converting input, encoded in
+// the charset named by the XML declaration, to UTF-8.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	decode, err := charsetDecoder(label)
+	if err != nil || decode == nil {
+		return input, err
+	}
+	return &utf8Reader{r: input, decode: decode}, nil
+}
+
+// utf8Reader converts the single byte charset read from r to UTF-8.
+type utf8Reader struct {
+	r       io.Reader
+	decode  func(byte) rune
+	buf     [512]byte
+	pending []byte
+}
+
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	if len(u.pending) == 0 {
+		n, err := u.r.Read(u.buf[:])
+		if n == 0 {
+			return 0, err
+		}
+		u.pending = appendUTF8(nil, u.buf[:n], u.decode)
+	}
+	n := copy(p, u.pending)
+	u.pending = u.pending[n:]
+	return n, nil
+}
+
+// appendUTF8 appends the UTF-8 encoding of the single byte charset text to dst.
+func appendUTF8(dst, text []byte, decode func(byte) rune) []byte {
+	var enc [utf8.UTFMax]byte
+	for _, b := range text {
+		n := utf8.EncodeRune(enc[:], decode(b))
+		dst = append(dst, enc[:n]...)
+	}
+	return dst
+}
+
+var xmlEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([^"']+)["'][^>]*\?>`)
+
+// utf8Body converts a response body to UTF-8. Its charset is the one of the
+// Content-Type header, which takes precedence, or else the one of its XML
+// declaration. The encoding declaration is dropped, so that the body is not
+// converted again when decoded.
+func utf8Body(contentType string, body []byte) ([]byte, error) {
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = params["charset"]
+	}
+	if decl := xmlEncoding.FindSubmatchIndex(body); decl != nil {
+		if label == "" {
+			label = string(body[decl[2]:decl[3]])
+		}
+		body = body[decl[1]:]
+	}
+
+	decode, err := charsetDecoder(label)
+	if err != nil || decode == nil {
+		return body, err
+	}
+	return appendUTF8(make([]byte, 0, len(body)+len(body)/8), body, decode), nil
+}
@@ -0,0 +1,105 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// The Clone and Equal methods below are called by the methods of the same
+// name that WithCloneMethods generates.
+
+// Clone returns a copy of b, with a copy of its content.
+func (b *Binary) Clone() *Binary {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	if b.content != nil {
+		content := append([]byte(nil), *b.content...)
+		c.content = &content
+	}
+	return &c
+}
+
+// Equal reports whether b and other have the same content and content type.
+func (b *Binary) Equal(other *Binary) bool {
+	if b == nil || other == nil {
+		return b == other
+	}
+	return b.contentType == other.contentType && bytes.Equal(b.Bytes(), other.Bytes())
+}
+
+// Clone returns a copy of a, with copies of its attributes and content.
+func (a *AnyXML) Clone() *AnyXML {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	c.Attrs = append([]xml.Attr(nil), a.Attrs...)
+	c.InnerXML = append([]byte(nil), a.InnerXML...)
+	return &c
+}
+
+// Equal reports whether a and other have the same name, attributes and
+// content, as raw XML.
+func (a *AnyXML) Equal(other *AnyXML) bool {
+	if a == nil || other == nil {
+		return a == other
+	}
+	if a.XMLName != other.XMLName || len(a.Attrs) != len(other.Attrs) || !bytes.Equal(a.InnerXML, other.InnerXML) {
+		return false
+	}
+	for i := range a.Attrs {
+		if a.Attrs[i] != other.Attrs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of a, with a copy of its items.
+func (a *EncodedArray) Clone() *EncodedArray {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	c.Items = append([]EncodedItem(nil), a.Items...)
+	return &c
+}
+
+// Equal reports whether a and other have the same array type, offset and
+// items.
+func (a *EncodedArray) Equal(other *EncodedArray) bool {
+	if a == nil || other == nil {
+		return a == other
+	}
+	return a.ArrayType == other.ArrayType && a.Offset == other.Offset && equalItems(a.Items, other.Items)
+}
+
+// Clone returns a copy of s, with a copy of its items.
+func (s *EncodedStruct) Clone() *EncodedStruct {
+	if s == nil {
+		return nil
+	}
+	return &EncodedStruct{Items: append([]EncodedItem(nil), s.Items...)}
+}
+
+// Equal reports whether s and other have the same items.
+func (s *EncodedStruct) Equal(other *EncodedStruct) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	return equalItems(s.Items, other.Items)
+}
+
+func equalItems(a, b []EncodedItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package soap
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// A DecodeError is returned by calls whose response cannot be decoded. It
+// keeps the start of the response and request bodies, so that a failure can
+// be diagnosed from the logs without capturing the traffic again.
+//
+// The errors carrying a response body, which are DecodeError, HTTPError,
+// SOAPFault and VersionMismatchError, implement interface{ RawBody() []byte }.
+type DecodeError struct {
+	Err error
+	// Response is the start of the response body, truncated to 4 KiB.
+	Response []byte
+	// Request is the start of the request body, truncated to 4 KiB. It is
+	// nil for streamed requests, whose body is not kept.
+	Request []byte
+}
+
+func (e *DecodeError) Error() string {
+	return "soap: cannot decode response: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// RawBody returns the start of the response body.
+func (e *DecodeError) RawBody() []byte {
+	return e.Response
+}
+
+// newDecodeError returns the DecodeError of the response res, whose body
+// started with body.
+func newDecodeError(err error, res *http.Response, body []byte) *DecodeError {
+	return &DecodeError{Err: err, Response: truncateBody(body), Request: requestBody(res.Request)}
+}
+
+// truncateBody returns a copy of the first 4 KiB of body.
+func truncateBody(body []byte) []byte {
+	if len(body) > maxHTTPErrorBody {
+		body = body[:maxHTTPErrorBody]
+	}
+	return append([]byte(nil), body...)
+}
+
+// requestBody returns the start of the body of req, decompressed, or nil if
+// it cannot be read again.
+func requestBody(req *http.Request) []byte {
+	if req == nil || req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+
+	var r io.Reader = body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		if r, err = gzip.NewReader(body); err != nil {
+			return nil
+		}
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(r, maxHTTPErrorBody))
+	return data
+}
+
+// headWriter keeps the first 4 KiB written to it, discarding the rest.
+type headWriter struct {
+	head []byte
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if n := maxHTTPErrorBody - len(w.head); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		w.head = append(w.head, p[:n]...)
+	}
+	return len(p), nil
+}
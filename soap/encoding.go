@@ -0,0 +1,26 @@
+package soap
+
+import "encoding/xml"
+
+// SOAPEncNs is the namespace of the SOAP 1.1 encoding, used by rpc/encoded services.
+const SOAPEncNs = "http://schemas.xmlsoap.org/soap/encoding/"
+
+// EncodedItem is a member of a SOAP encoded array or struct. Its content is
+// kept as raw XML, since member names and types are only known at runtime.
+type EncodedItem struct {
+	XMLName xml.Name
+	Type    string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr,omitempty"`
+	Content string `xml:",innerxml"`
+}
+
+// EncodedArray represents a SOAP encoded array, soapenc:Array.
+type EncodedArray struct {
+	ArrayType string        `xml:"http://schemas.xmlsoap.org/soap/encoding/ arrayType,attr,omitempty"`
+	Offset    string        `xml:"http://schemas.xmlsoap.org/soap/encoding/ offset,attr,omitempty"`
+	Items     []EncodedItem `xml:",any"`
+}
+
+// EncodedStruct represents a SOAP encoded compound value, soapenc:Struct.
+type EncodedStruct struct {
+	Items []EncodedItem `xml:",any"`
+}
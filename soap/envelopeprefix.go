@@ -0,0 +1,105 @@
+package soap
+
+import "encoding/xml"
+
+// WithEnvelopePrefix is an Option to bind the SOAP envelope namespace to
+// prefix once, on the Envelope element, and to name the Envelope, Header and
+// Body elements with it, as in soap:Envelope. By default these elements each
+// declare the envelope namespace as their default namespace, which some
+// strict parsers reject. Header and body content keeps its own namespaces
+// either way, but content without a namespace only inherits the envelope
+// namespace by default.
+func WithEnvelopePrefix(prefix string) Option {
+	return func(o *options) {
+		o.envelopePrefix = prefix
+	}
+}
+
+// WithSchemaNamespaces is an Option to declare the xsi and xsd prefixes, of the
+// XML Schema instance and XML Schema namespaces, on the Envelope element of
+// every request, as some servers require even when the body uses neither, or
+// uses them without declaring them, as in xsi:nil="true".
+func WithSchemaNamespaces() Option {
+	return func(o *options) {
+		o.schemaNamespaces = true
+	}
+}
+
+// plainEnvelope is a SOAPEnvelope marshaled without its MarshalXML method.
+type plainEnvelope SOAPEnvelope
+
+// MarshalXML implements xml.Marshaler. Envelopes of clients created with
+// WithEnvelopePrefix are encoded with the prefixed element names, and those of
+// clients created with WithSchemaNamespaces declare the xsi and xsd prefixes.
+func (env SOAPEnvelope) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	var attrs []xml.Attr
+	if env.schemaNamespaces {
+		attrs = []xml.Attr{
+			{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace},
+			{Name: xml.Name{Local: "xmlns:xsd"}, Value: xsdNamespace},
+		}
+	}
+
+	if env.prefix == "" {
+		start := xml.StartElement{Name: xml.Name{Space: envelopeNamespace, Local: "Envelope"}, Attr: attrs}
+		return e.EncodeElement(plainEnvelope(env), start)
+	}
+
+	envelope := env.prefixed("Envelope")
+	envelope.Attr = append([]xml.Attr{{Name: xml.Name{Local: "xmlns:" + env.prefix}, Value: envelopeNamespace}}, attrs...)
+	if err := e.EncodeToken(envelope); err != nil {
+		return err
+	}
+
+	if env.Header != nil {
+		header := env.prefixed("Header")
+		if err := e.EncodeToken(header); err != nil {
+			return err
+		}
+		for _, h := range env.Header.Headers {
+			if h == nil {
+				continue
+			}
+			if err := e.Encode(h); err != nil {
+				return err
+			}
+		}
+		if err := e.EncodeToken(header.End()); err != nil {
+			return err
+		}
+	}
+
+	body := env.prefixed("Body")
+	if err := e.EncodeToken(body); err != nil {
+		return err
+	}
+	if env.Body.Fault != nil {
+		if err := e.Encode(env.Body.Fault); err != nil {
+			return err
+		}
+	}
+	if env.Body.Content != nil {
+		if err := e.Encode(env.Body.Content); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeToken(body.End()); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(envelope.End())
+}
+
+// prefixed returns the start of the envelope element local, named with the
+// prefix of env.
+func (env SOAPEnvelope) prefixed(local string) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: env.prefix + ":" + local}}
+}
+
+// bodyEnd returns the end tag of the Body element of env, as marshaled.
+func (env SOAPEnvelope) bodyEnd() string {
+	if env.prefix == "" {
+		return "</Body>"
+	}
+	return "</" + env.prefix + ":Body>"
+}
@@ -0,0 +1,273 @@
+package soap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The XSD Gregorian types below represent recurring or partial dates. Their
+// Zone is nil when the lexical value has no time zone, and a fixed zone
+// otherwise, which is marshaled as "Z" when its offset is zero.
+
+// GYear is an xsd:gYear, such as 2006 or 2006-05:00.
+type GYear struct {
+	Year int
+	Zone *time.Location
+}
+
+// GYearMonth is an xsd:gYearMonth, such as 2006-01 or 2006-01Z.
+type GYearMonth struct {
+	Year  int
+	Month time.Month
+	Zone  *time.Location
+}
+
+// GMonth is an xsd:gMonth, such as --01.
+type GMonth struct {
+	Month time.Month
+	Zone  *time.Location
+}
+
+// GDay is an xsd:gDay, such as ---02.
+type GDay struct {
+	Day  int
+	Zone *time.Location
+}
+
+// GMonthDay is an xsd:gMonthDay, such as --01-02.
+type GMonthDay struct {
+	Month time.Month
+	Day   int
+	Zone  *time.Location
+}
+
+func (g GYear) String() string {
+	return formatYear(g.Year) + formatZone(g.Zone)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (g GYear) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (g *GYear) UnmarshalText(text []byte) error {
+	s, zone, err := parseZone(string(text))
+	if err != nil {
+		return err
+	}
+	year, err := parseYear(s)
+	if err != nil {
+		return err
+	}
+
+	*g = GYear{Year: year, Zone: zone}
+	return nil
+}
+
+func (g GYearMonth) String() string {
+	return fmt.Sprintf("%s-%02d%s", formatYear(g.Year), g.Month, formatZone(g.Zone))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (g GYearMonth) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (g *GYearMonth) UnmarshalText(text []byte) error {
+	s, zone, err := parseZone(string(text))
+	if err != nil {
+		return err
+	}
+
+	i := strings.LastIndex(s, "-")
+	if i <= 0 {
+		return fmt.Errorf("invalid gYearMonth %q", text)
+	}
+	year, err := parseYear(s[:i])
+	if err != nil {
+		return err
+	}
+	month, err := parseMonth(s[i+1:])
+	if err != nil {
+		return err
+	}
+
+	*g = GYearMonth{Year: year, Month: month, Zone: zone}
+	return nil
+}
+
+func (g GMonth) String() string {
+	return fmt.Sprintf("--%02d%s", g.Month, formatZone(g.Zone))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (g GMonth) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (g *GMonth) UnmarshalText(text []byte) error {
+	s, zone, err := parseZone(string(text))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(s, "--") {
+		return fmt.Errorf("invalid gMonth %q", text)
+	}
+	month, err := parseMonth(s[2:])
+	if err != nil {
+		return err
+	}
+
+	*g = GMonth{Month: month, Zone: zone}
+	return nil
+}
+
+func (g GDay) String() string {
+	return fmt.Sprintf("---%02d%s", g.Day, formatZone(g.Zone))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (g GDay) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (g *GDay) UnmarshalText(text []byte) error {
+	s, zone, err := parseZone(string(text))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(s, "---") {
+		return fmt.Errorf("invalid gDay %q", text)
+	}
+	day, err := parseDay(s[3:])
+	if err != nil {
+		return err
+	}
+
+	*g = GDay{Day: day, Zone: zone}
+	return nil
+}
+
+func (g GMonthDay) String() string {
+	return fmt.Sprintf("--%02d-%02d%s", g.Month, g.Day, formatZone(g.Zone))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (g GMonthDay) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (g *GMonthDay) UnmarshalText(text []byte) error {
+	s, zone, err := parseZone(string(text))
+	if err != nil {
+		return err
+	}
+	if len(s) != 7 || !strings.HasPrefix(s, "--") || s[4] != '-' {
+		return fmt.Errorf("invalid gMonthDay %q", text)
+	}
+	month, err := parseMonth(s[2:4])
+	if err != nil {
+		return err
+	}
+	day, err := parseDay(s[5:])
+	if err != nil {
+		return err
+	}
+
+	*g = GMonthDay{Month: month, Day: day, Zone: zone}
+	return nil
+}
+
+// formatYear formats a year with at least four digits, as XSD requires.
+func formatYear(year int) string {
+	if year < 0 {
+		return fmt.Sprintf("-%04d", -year)
+	}
+	return fmt.Sprintf("%04d", year)
+}
+
+func parseYear(s string) (int, error) {
+	digits := strings.TrimPrefix(s, "-")
+	if len(digits) < 4 || (len(digits) > 4 && digits[0] == '0') || strings.Trim(digits, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid year %q", s)
+	}
+	return strconv.Atoi(s)
+}
+
+func parseMonth(s string) (time.Month, error) {
+	month, err := parseTwoDigits(s)
+	if err != nil || month < 1 || month > 12 {
+		return 0, fmt.Errorf("invalid month %q", s)
+	}
+	return time.Month(month), nil
+}
+
+func parseDay(s string) (int, error) {
+	day, err := parseTwoDigits(s)
+	if err != nil || day < 1 || day > 31 {
+		return 0, fmt.Errorf("invalid day %q", s)
+	}
+	return day, nil
+}
+
+func parseTwoDigits(s string) (int, error) {
+	if len(s) != 2 || strings.Trim(s, "0123456789") != "" {
+		return 0, fmt.Errorf("expected two digits, got %q", s)
+	}
+	return strconv.Atoi(s)
+}
+
+// formatZone returns the lexical time zone of zone, or an empty string if
+// zone is nil.
+func formatZone(zone *time.Location) string {
+	if zone == nil {
+		return ""
+	}
+
+	_, offset := time.Date(2000, 1, 1, 0, 0, 0, 0, zone).Zone()
+	if offset == 0 {
+		return "Z"
+	}
+
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// parseZone splits the optional time zone, "Z" or ±hh:mm, off the end of s.
+func parseZone(s string) (string, *time.Location, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "Z") {
+		return s[:len(s)-1], time.UTC, nil
+	}
+
+	if len(s) < 6 || (s[len(s)-6] != '+' && s[len(s)-6] != '-') || s[len(s)-3] != ':' {
+		return s, nil, nil
+	}
+
+	zone := s[len(s)-6:]
+	hours, err := parseTwoDigits(zone[1:3])
+	if err != nil || hours > 14 {
+		return "", nil, fmt.Errorf("invalid time zone %q", zone)
+	}
+	minutes, err := parseTwoDigits(zone[4:])
+	if err != nil || minutes > 59 {
+		return "", nil, fmt.Errorf("invalid time zone %q", zone)
+	}
+
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return s[:len(s)-6], time.FixedZone(zone, offset), nil
+}
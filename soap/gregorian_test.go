@@ -0,0 +1,107 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestGYearMonth_RoundTrip(t *testing.T) {
+	type Period struct {
+		XMLName xml.Name    `xml:"Period"`
+		Start   GYearMonth  `xml:"start,attr"`
+		End     *GYearMonth `xml:"end,omitempty"`
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		year   int
+		month  time.Month
+		offset *int
+	}{
+		{"without time zone", "2006-01", 2006, time.January, nil},
+		{"UTC", "2006-01Z", 2006, time.January, new(int)},
+		{"negative offset", "1999-12-05:00", 1999, time.December, intPtr(-5 * 3600)},
+		{"positive offset", "2020-06+01:30", 2020, time.June, intPtr(5400)},
+		{"negative year", "-0044-03", -44, time.March, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `<Period start="` + tt.value + `"><end>` + tt.value + `</end></Period>`
+
+			p := new(Period)
+			if err := xml.Unmarshal([]byte(input), p); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, got := range []GYearMonth{p.Start, *p.End} {
+				if got.Year != tt.year || got.Month != tt.month {
+					t.Errorf("got %d-%d wanted %d-%d", got.Year, got.Month, tt.year, tt.month)
+				}
+				if tt.offset == nil {
+					if got.Zone != nil {
+						t.Errorf("got time zone %v wanted none", got.Zone)
+					}
+				} else if got.Zone == nil {
+					t.Error("time zone is missing")
+				} else if _, offset := time.Date(2000, 1, 1, 0, 0, 0, 0, got.Zone).Zone(); offset != *tt.offset {
+					t.Errorf("got offset %d wanted %d", offset, *tt.offset)
+				}
+			}
+
+			output, err := xml.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(output) != input {
+				t.Errorf("got %s wanted %s", output, input)
+			}
+		})
+	}
+}
+
+func TestGregorian_Lexical(t *testing.T) {
+	tests := []struct {
+		value string
+		typ   interface {
+			UnmarshalText([]byte) error
+			String() string
+		}
+	}{
+		{"2006", new(GYear)},
+		{"12345+14:00", new(GYear)},
+		{"--01", new(GMonth)},
+		{"--12Z", new(GMonth)},
+		{"---02", new(GDay)},
+		{"---31-01:00", new(GDay)},
+		{"--01-02", new(GMonthDay)},
+		{"--02-29Z", new(GMonthDay)},
+	}
+
+	for _, tt := range tests {
+		if err := tt.typ.UnmarshalText([]byte(tt.value)); err != nil {
+			t.Errorf("%s: %v", tt.value, err)
+			continue
+		}
+		if got := tt.typ.String(); got != tt.value {
+			t.Errorf("got %s wanted %s", got, tt.value)
+		}
+	}
+
+	for _, invalid := range []string{"06", "02006", "2006-13", "2006-1", "2006-01+15:00", "2006-01+1:00"} {
+		if err := new(GYearMonth).UnmarshalText([]byte(invalid)); err == nil {
+			t.Errorf("expected %q to be an invalid gYearMonth", invalid)
+		}
+	}
+	for _, invalid := range []string{"---32", "--13", "01"} {
+		if err := new(GDay).UnmarshalText([]byte(invalid)); err == nil {
+			t.Errorf("expected %q to be an invalid gDay", invalid)
+		}
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
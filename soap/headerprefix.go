@@ -0,0 +1,197 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// A PrefixConflictPolicy decides what happens when SOAP headers declare the
+// same namespace prefix for different namespaces.
+type PrefixConflictPolicy int
+
+const (
+	// PrefixConflictKeep sends the headers as they are marshaled. It is the
+	// default.
+	PrefixConflictKeep PrefixConflictPolicy = iota
+	// PrefixConflictRename renames the conflicting prefixes of later headers,
+	// so that every prefix of the Header block is bound to a single namespace.
+	// Prefixes used within attribute values or text, such as QName values,
+	// are not renamed.
+	PrefixConflictRename
+	// PrefixConflictFail fails the call with a PrefixConflictError.
+	PrefixConflictFail
+)
+
+// WithHeaderPrefixConflicts is an Option to set how headers declaring the same
+// namespace prefix for different namespaces are handled.
+func WithHeaderPrefixConflicts(policy PrefixConflictPolicy) Option {
+	return func(o *options) {
+		o.prefixConflicts = policy
+	}
+}
+
+// A PrefixConflictError reports a namespace prefix that a header declares for
+// a namespace other than the one an earlier header declared it for.
+type PrefixConflictError struct {
+	Prefix    string
+	Header    int // Index of the header, counting from zero.
+	Namespace string
+	Earlier   string // Namespace declared by the earlier header.
+}
+
+func (e *PrefixConflictError) Error() string {
+	return fmt.Sprintf("soap: header %d declares prefix %q for %s, which an earlier header declares for %s",
+		e.Header, e.Prefix, e.Namespace, e.Earlier)
+}
+
+// resolvePrefixConflicts applies policy to the prefixes declared by headers.
+// Renamed headers are replaced with their marshaled form.
+func resolvePrefixConflicts(headers []interface{}, policy PrefixConflictPolicy) ([]interface{}, error) {
+	if policy == PrefixConflictKeep || len(headers) < 2 {
+		return headers, nil
+	}
+
+	bound := make(map[string]string)
+	resolved := make([]interface{}, len(headers))
+	for i, header := range headers {
+		resolved[i] = header
+
+		raw, err := xml.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		declared, err := declaredPrefixes(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		renames := make(map[string]string)
+		for _, decl := range declared {
+			earlier, ok := bound[decl.Local]
+			if !ok || earlier == decl.Space {
+				continue
+			}
+			if policy == PrefixConflictFail {
+				return nil, &PrefixConflictError{Prefix: decl.Local, Header: i, Namespace: decl.Space, Earlier: earlier}
+			}
+			if _, ok := renames[decl.Local]; !ok {
+				renames[decl.Local] = uniquePrefix(decl.Local, bound, declared)
+			}
+		}
+
+		for _, decl := range declared {
+			prefix := decl.Local
+			if renamed, ok := renames[prefix]; ok {
+				prefix = renamed
+			}
+			if _, ok := bound[prefix]; !ok {
+				bound[prefix] = decl.Space
+			}
+		}
+		if len(renames) > 0 {
+			resolved[i] = &renamedHeader{raw: raw, renames: renames}
+		}
+	}
+	return resolved, nil
+}
+
+// declaredPrefixes returns the prefix declarations of an XML document, as
+// names whose Local is the prefix and Space the namespace.
+func declaredPrefixes(raw []byte) ([]xml.Name, error) {
+	var declared []xml.Name
+	d := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return declared, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if se, ok := token.(xml.StartElement); ok {
+			for _, attr := range se.Attr {
+				if attr.Name.Space == "xmlns" {
+					declared = append(declared, xml.Name{Space: attr.Value, Local: attr.Name.Local})
+				}
+			}
+		}
+	}
+}
+
+// uniquePrefix returns prefix followed by the first number that makes it
+// neither bound by earlier headers nor declared by the header itself.
+func uniquePrefix(prefix string, bound map[string]string, declared []xml.Name) string {
+	taken := func(p string) bool {
+		if _, ok := bound[p]; ok {
+			return true
+		}
+		for _, decl := range declared {
+			if decl.Local == p {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 2; ; i++ {
+		if p := fmt.Sprintf("%s%d", prefix, i); !taken(p) {
+			return p
+		}
+	}
+}
+
+// renamedHeader is a marshaled header whose namespace prefixes are renamed
+// when it is encoded.
+type renamedHeader struct {
+	raw     []byte
+	renames map[string]string
+}
+
+// MarshalXML implements xml.Marshaler. The tokens of the header are encoded
+// with their prefixes as is, rather than being namespaced again.
+func (h *renamedHeader) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	rename := func(name xml.Name) xml.Name {
+		if name.Space == "xmlns" {
+			if renamed, ok := h.renames[name.Local]; ok {
+				return xml.Name{Local: "xmlns:" + renamed}
+			}
+		}
+		if renamed, ok := h.renames[name.Space]; ok {
+			name.Space = renamed
+		}
+		if name.Space == "" {
+			return name
+		}
+		return xml.Name{Local: name.Space + ":" + name.Local}
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(h.raw))
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			se := xml.StartElement{Name: rename(t.Name)}
+			for _, attr := range t.Attr {
+				se.Attr = append(se.Attr, xml.Attr{Name: rename(attr.Name), Value: attr.Value})
+			}
+			token = se
+		case xml.EndElement:
+			token = xml.EndElement{Name: rename(t.Name)}
+		case xml.ProcInst:
+			continue
+		}
+		if err := e.EncodeToken(xml.CopyToken(token)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package soap
+
+import "context"
+
+// WithPreCallHook is an Option to call hook before each call is sent, with the
+// context, SOAP action and request of the call. Hooks run in the order their
+// options are given, and must not modify the request.
+func WithPreCallHook(hook func(ctx context.Context, action string, req interface{})) Option {
+	return func(o *options) {
+		o.preCallHooks = append(o.preCallHooks, hook)
+	}
+}
+
+// WithPostCallHook is an Option to call hook once each call completes, with
+// the context and SOAP action of the call, the response it was decoded into
+// and its error, such as a *SOAPFault. The response is nil for CallOneWay and
+// CallRawStream, and may be partially decoded when err is not nil. Hooks run
+// in the order their options are given.
+func WithPostCallHook(hook func(ctx context.Context, action string, resp interface{}, err error)) Option {
+	return func(o *options) {
+		o.postCallHooks = append(o.postCallHooks, hook)
+	}
+}
+
+// preCall runs the pre-call hooks of a call.
+func (s *Client) preCall(ctx context.Context, soapAction string, request interface{}) {
+	for _, hook := range s.opts.preCallHooks {
+		hook(ctx, soapAction, request)
+	}
+}
+
+// postCall runs the post-call hooks of a call.
+func (s *Client) postCall(ctx context.Context, soapAction string, response interface{}, err error) {
+	for _, hook := range s.opts.postCallHooks {
+		hook(ctx, soapAction, response, err)
+	}
+}
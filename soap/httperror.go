@@ -0,0 +1,55 @@
+package soap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxHTTPErrorBody is the number of body bytes an HTTPError, a DecodeError or
+// a SOAPFault keeps.
+const maxHTTPErrorBody = 4 << 10
+
+// An HTTPError is returned by calls whose response has a non 2xx HTTP status
+// and is not a SOAP fault, such as the HTML error page of a proxy or gateway
+// in front of the service.
+type HTTPError struct {
+	// StatusCode is the HTTP status code of the response, as in 502.
+	StatusCode int
+	// Status is the HTTP status of the response, as in "502 Bad Gateway".
+	Status string
+	// Body is the start of the response body, truncated to 4 KiB.
+	Body []byte
+}
+
+// RawBody returns the start of the response body.
+func (e *HTTPError) RawBody() []byte {
+	return e.Body
+}
+
+func (e *HTTPError) Error() string {
+	body := bytes.TrimSpace(e.Body)
+	if len(body) == 0 {
+		return "unexpected HTTP status: " + e.Status
+	}
+	return "unexpected HTTP status: " + e.Status + ": " + string(body)
+}
+
+// newHTTPError returns the HTTPError of res, whose body starts with the bytes
+// already read in start and continues in the unread res.Body.
+func newHTTPError(res *http.Response, start []byte) *HTTPError {
+	body := start
+	if len(body) > maxHTTPErrorBody {
+		body = body[:maxHTTPErrorBody]
+	} else {
+		rest, _ := ioutil.ReadAll(io.LimitReader(res.Body, int64(maxHTTPErrorBody-len(body))))
+		body = append(body[:len(body):len(body)], rest...)
+	}
+	return &HTTPError{StatusCode: res.StatusCode, Status: res.Status, Body: body}
+}
+
+// isSuccess reports whether the HTTP status code of res is 2xx.
+func isSuccess(res *http.Response) bool {
+	return res.StatusCode >= 200 && res.StatusCode <= 299
+}
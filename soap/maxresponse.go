@@ -0,0 +1,62 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrResponseTooLarge is returned, wrapped, by calls whose response body
+// exceeds the size set with WithMaxResponseSize.
+var ErrResponseTooLarge = errors.New("soap: response body too large")
+
+// WithMaxResponseSize is an Option to fail calls whose response body, the
+// whole multipart payload for MTOM responses, exceeds bytes, rather than
+// reading it into memory. Calls then fail with an error wrapping
+// ErrResponseTooLarge. Response bodies are not limited by default, or when
+// bytes is not positive.
+func WithMaxResponseSize(bytes int64) Option {
+	return func(o *options) {
+		o.maxResponseSize = bytes
+	}
+}
+
+// limitedBody is a response body failing reads beyond limit bytes.
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+	// declared is the Content-Length of the response, or -1 if unknown.
+	declared int64
+}
+
+func newLimitedBody(body io.ReadCloser, limit, contentLength int64) *limitedBody {
+	return &limitedBody{ReadCloser: body, limit: limit, remaining: limit, declared: contentLength}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.declared > b.limit {
+		return 0, b.tooLarge()
+	}
+	if b.remaining <= 0 {
+		// Bodies ending right at the limit are fine, so one more byte is
+		// read to tell them apart from larger ones.
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, b.tooLarge()
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) tooLarge() error {
+	return fmt.Errorf("%w: exceeds the limit of %d bytes", ErrResponseTooLarge, b.limit)
+}
@@ -0,0 +1,189 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+)
+
+// multiRefElement is an element of a document, located by its byte offsets.
+type multiRefElement struct {
+	name  xml.Name
+	attrs []xml.Attr
+	// start and end delimit the element, and contentStart and contentEnd
+	// its content, which is empty for self-closing elements.
+	start, contentStart, contentEnd, end int64
+	// topLevel is set for the children of the SOAP Body.
+	topLevel bool
+}
+
+// attr returns the value of the unqualified attribute local of el.
+func (el *multiRefElement) attr(local string) string {
+	for _, attr := range el.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// resolveMultiRefs inlines the SOAP encoding multi-reference values of a
+// response, as sent by rpc/encoded services such as Axis: an element with an
+// href="#id" attribute is replaced by the element of the SOAP Body with that
+// id, renamed after it, and the referenced elements are removed from the Body,
+// which is left with the single element a response is decoded from.
+// Documents that cannot be tokenized are returned unmodified, leaving the
+// error reporting to the actual decoder.
+func resolveMultiRefs(data []byte) []byte {
+	if !bytes.Contains(data, []byte(`href="#`)) && !bytes.Contains(data, []byte(`href='#`)) {
+		return data
+	}
+
+	elements, ok := tokenizeElements(data)
+	if !ok {
+		return data
+	}
+
+	ids := make(map[string]*multiRefElement)
+	referenced := make(map[string]bool)
+	for _, el := range elements {
+		if id := el.attr("id"); id != "" && el.topLevel {
+			ids[id] = el
+		}
+	}
+	for _, el := range elements {
+		if href := el.attr("href"); len(href) > 1 && href[0] == '#' && ids[href[1:]] != nil {
+			referenced[href[1:]] = true
+		}
+	}
+	if len(referenced) == 0 {
+		return data
+	}
+
+	r := &multiRefResolver{data: data, elements: elements, ids: ids, referenced: referenced, resolving: make(map[string]bool)}
+	out := new(bytes.Buffer)
+	r.render(out, 0, int64(len(data)))
+	return out.Bytes()
+}
+
+// tokenizeElements returns the elements of data in document order.
+func tokenizeElements(data []byte) ([]*multiRefElement, bool) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var elements, open []*multiRefElement
+	bodyDepth := -1
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return elements, len(open) == 0
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			el := &multiRefElement{
+				name:         t.Name,
+				attrs:        t.Attr,
+				start:        offset,
+				contentStart: d.InputOffset(),
+				topLevel:     bodyDepth >= 0 && len(open) == bodyDepth+1,
+			}
+			if t.Name.Local == "Body" && len(open) == 1 {
+				bodyDepth = len(open)
+			}
+			elements = append(elements, el)
+			open = append(open, el)
+		case xml.EndElement:
+			if len(open) == 0 {
+				return nil, false
+			}
+			el := open[len(open)-1]
+			open = open[:len(open)-1]
+			el.contentEnd, el.end = offset, d.InputOffset()
+			if el.contentEnd < el.contentStart {
+				// Self-closing elements end where their start ends.
+				el.contentEnd = el.contentStart
+			}
+			if len(open) == bodyDepth {
+				bodyDepth = -1
+			}
+		}
+	}
+}
+
+type multiRefResolver struct {
+	data       []byte
+	elements   []*multiRefElement
+	ids        map[string]*multiRefElement
+	referenced map[string]bool
+	// resolving holds the ids being inlined, so that cyclic references are
+	// left unresolved.
+	resolving map[string]bool
+}
+
+// render writes the bytes of data from start to end, inlining the references
+// and dropping the referenced elements.
+func (r *multiRefResolver) render(out *bytes.Buffer, start, end int64) {
+	cursor := start
+	first := sort.Search(len(r.elements), func(i int) bool { return r.elements[i].start >= start })
+	for _, el := range r.elements[first:] {
+		if el.start >= end {
+			break
+		}
+		if el.start < cursor {
+			continue
+		}
+
+		if id := el.attr("id"); el.topLevel && r.referenced[id] && r.ids[id] == el {
+			out.Write(r.data[cursor:el.start])
+			cursor = el.end
+			continue
+		}
+
+		href := el.attr("href")
+		if len(href) < 2 || href[0] != '#' || r.ids[href[1:]] == nil || r.resolving[href[1:]] {
+			continue
+		}
+		out.Write(r.data[cursor:el.start])
+		r.inline(out, el, r.ids[href[1:]])
+		cursor = el.end
+	}
+	out.Write(r.data[cursor:end])
+}
+
+// inline writes the element ref, which refers to target, as target named after
+// ref. The attributes of both are kept, but for href and id.
+func (r *multiRefResolver) inline(out *bytes.Buffer, ref, target *multiRefElement) {
+	id := target.attr("id")
+	r.resolving[id] = true
+	defer delete(r.resolving, id)
+
+	name := rawName(ref.name)
+	out.WriteString("<" + name)
+	written := make(map[xml.Name]bool)
+	for _, attrs := range [][]xml.Attr{ref.attrs, target.attrs} {
+		for _, attr := range attrs {
+			if attr.Name.Space == "" && (attr.Name.Local == "href" || attr.Name.Local == "id") || written[attr.Name] {
+				continue
+			}
+			written[attr.Name] = true
+			out.WriteString(" " + rawName(attr.Name) + `="`)
+			xml.EscapeText(out, []byte(attr.Value))
+			out.WriteString(`"`)
+		}
+	}
+	out.WriteString(">")
+	r.render(out, target.contentStart, target.contentEnd)
+	out.WriteString("</" + name + ">")
+}
+
+// rawName returns the name of a raw token, with its prefix.
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
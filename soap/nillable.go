@@ -0,0 +1,50 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+)
+
+// EncodeNillable encodes value as the element start, or as an empty element
+// marked with xsi:nil="true" if value is nil or a nil pointer or slice. It is
+// called by the MarshalXML methods of the Nillable types of generated code,
+// whose nillable elements are then always encoded, holding either their value
+// or an explicit nil.
+func EncodeNillable(e *xml.Encoder, start xml.StartElement, value interface{}) error {
+	if !isNil(value) {
+		return e.EncodeElement(value, start)
+	}
+
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace},
+		xml.Attr{Name: xml.Name{Local: "xsi:nil"}, Value: "true"},
+	)
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// DecodeNillable decodes the element start into value, a pointer to the
+// pointer or slice held by a Nillable type of generated code, which is set to
+// nil if the element is marked with xsi:nil="true".
+func DecodeNillable(d *xml.Decoder, start xml.StartElement, value interface{}) error {
+	if !isNilElement(start) {
+		return d.DecodeElement(value, &start)
+	}
+
+	v := reflect.ValueOf(value).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return d.Skip()
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
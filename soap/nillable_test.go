@@ -0,0 +1,65 @@
+package soap
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+type NillableInt32 struct {
+	Value *int32
+}
+
+func (n NillableInt32) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return EncodeNillable(e, start, n.Value)
+}
+
+func (n *NillableInt32) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return DecodeNillable(d, start, &n.Value)
+}
+
+func TestNillable_RoundTrip(t *testing.T) {
+	type Level struct {
+		XMLName  xml.Name       `xml:"http://example.com/service.xsd Level"`
+		Quantity NillableInt32  `xml:"Quantity"`
+		Reserved *NillableInt32 `xml:"Reserved,omitempty"`
+		Reorder  *NillableInt32 `xml:"Reorder,omitempty"`
+	}
+
+	quantity := int32(3)
+	data, err := xml.Marshal(&Level{Quantity: NillableInt32{&quantity}, Reserved: &NillableInt32{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<Reserved xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"></Reserved>`; !strings.Contains(string(data), expected) {
+		t.Errorf("got %s, wanted it to hold %s", data, expected)
+	}
+	if strings.Contains(string(data), "Reorder") {
+		t.Errorf("got %s, wanted no Reorder element", data)
+	}
+
+	level := &Level{Quantity: NillableInt32{new(int32)}}
+	if err := xml.Unmarshal(data, level); err != nil {
+		t.Fatal(err)
+	}
+	if level.Quantity.Value == nil || *level.Quantity.Value != 3 {
+		t.Errorf("got quantity %v, wanted 3", level.Quantity.Value)
+	}
+	if level.Reserved == nil || level.Reserved.Value != nil {
+		t.Errorf("got reserved %v, wanted an explicit nil", level.Reserved)
+	}
+	if level.Reorder != nil {
+		t.Errorf("got reorder %v, wanted it absent", level.Reorder)
+	}
+
+	data, err = xml.Marshal(&Level{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(data, level); err != nil {
+		t.Fatal(err)
+	}
+	if level.Quantity.Value != nil {
+		t.Errorf("got quantity %v, wanted an explicit nil", *level.Quantity.Value)
+	}
+}
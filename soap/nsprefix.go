@@ -0,0 +1,199 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WithNamespacePrefixes is an Option to name the elements and attributes of
+// request envelopes in the given namespaces with fixed prefixes, declared on
+// the Envelope element, for servers that match prefixes rather than
+// namespaces. prefixes maps each prefix to its namespace URI, as in
+// {"tns": "http://example.com/service.xsd"}. Elements in other namespaces keep
+// the declarations encoding/xml gives them. Streamed request bodies are sent
+// as is, inside an envelope using the prefixes.
+func WithNamespacePrefixes(prefixes map[string]string) Option {
+	copied := make(map[string]string, len(prefixes))
+	for prefix, namespace := range prefixes {
+		copied[prefix] = namespace
+	}
+	return func(o *options) {
+		o.namespacePrefixes = copied
+	}
+}
+
+// newXMLEncoder returns the encoder of request envelopes written to w, which
+// applies the prefixes of WithNamespacePrefixes, if any.
+func newXMLEncoder(w io.Writer, prefixes map[string]string) SOAPEncoder {
+	if len(prefixes) == 0 {
+		return xml.NewEncoder(w)
+	}
+	return &prefixEncoder{w: w, prefixes: prefixes}
+}
+
+// prefixEncoder marshals values with fixed namespace prefixes.
+type prefixEncoder struct {
+	w        io.Writer
+	prefixes map[string]string
+}
+
+func (e *prefixEncoder) Encode(v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if data, err = applyNamespacePrefixes(data, e.prefixes); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *prefixEncoder) Flush() error {
+	return nil
+}
+
+// applyNamespacePrefixes rewrites the XML document data so that the elements
+// and attributes in the namespaces of prefixes are named with their prefix,
+// which the root element declares. The default namespace declarations of
+// these namespaces become unnecessary and are dropped, but the declarations
+// of other prefixes are kept, since attribute values such as xsi:type ones
+// may refer to them.
+func applyNamespacePrefixes(data []byte, prefixes map[string]string) ([]byte, error) {
+	sorted, byNamespace := prefixesByNamespace(prefixes)
+
+	type element struct {
+		name     string
+		bindings map[string]string
+	}
+	var open []element
+	bindings := map[string]string{"xml": "http://www.w3.org/XML/1998/namespace"}
+	root := true
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	out := new(bytes.Buffer)
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			inner, copied := bindings, false
+			for _, attr := range t.Attr {
+				prefix, ok := declaredPrefix(attr)
+				if !ok {
+					continue
+				}
+				if namespace, ok := prefixes[prefix]; ok && prefix != "" && namespace != attr.Value {
+					return nil, fmt.Errorf("soap: prefix %s is bound to %s, and cannot be rebound to %s", prefix, namespace, attr.Value)
+				}
+				if !copied {
+					inner, copied = make(map[string]string, len(bindings)+1), true
+					for p, ns := range bindings {
+						inner[p] = ns
+					}
+				}
+				inner[prefix] = attr.Value
+			}
+
+			name := rawName(t.Name)
+			if prefix, ok := byNamespace[inner[t.Name.Space]]; ok {
+				name = prefix + ":" + t.Name.Local
+			}
+			out.WriteString("<" + name)
+			if root {
+				for _, prefix := range sorted {
+					writeAttr(out, "xmlns:"+prefix, prefixes[prefix])
+				}
+				root = false
+			}
+			for _, attr := range t.Attr {
+				if prefix, ok := declaredPrefix(attr); ok {
+					if _, mapped := byNamespace[attr.Value]; mapped && (prefix == "" || prefixes[prefix] == attr.Value) {
+						continue
+					}
+					writeAttr(out, rawName(attr.Name), attr.Value)
+					continue
+				}
+				attrName := rawName(attr.Name)
+				if prefix, ok := byNamespace[inner[attr.Name.Space]]; ok && attr.Name.Space != "" {
+					attrName = prefix + ":" + attr.Name.Local
+				}
+				writeAttr(out, attrName, attr.Value)
+			}
+			out.WriteString(">")
+
+			open = append(open, element{name: name, bindings: bindings})
+			bindings = inner
+		case xml.EndElement:
+			if len(open) == 0 {
+				return nil, fmt.Errorf("soap: unexpected end element %s", rawName(t.Name))
+			}
+			el := open[len(open)-1]
+			open = open[:len(open)-1]
+			out.WriteString("</" + el.name + ">")
+			bindings = el.bindings
+		case xml.CharData:
+			xml.EscapeText(out, t)
+		case xml.Comment:
+			out.WriteString("<!--" + string(t) + "-->")
+		case xml.ProcInst:
+			out.WriteString("<?" + t.Target + " " + string(t.Inst) + "?>")
+		case xml.Directive:
+			out.WriteString("<!" + string(t) + ">")
+		}
+	}
+}
+
+// prefixesByNamespace returns the sorted prefixes, and the prefix of every
+// namespace, which is the first one when several prefixes are bound to it.
+func prefixesByNamespace(prefixes map[string]string) ([]string, map[string]string) {
+	sorted := make([]string, 0, len(prefixes))
+	for prefix := range prefixes {
+		sorted = append(sorted, prefix)
+	}
+	sort.Strings(sorted)
+
+	byNamespace := make(map[string]string, len(prefixes))
+	for _, prefix := range sorted {
+		if _, ok := byNamespace[prefixes[prefix]]; !ok {
+			byNamespace[prefixes[prefix]] = prefix
+		}
+	}
+	return sorted, byNamespace
+}
+
+// bodyEnd returns the end tag of the Body element of env as marshaled with
+// prefixes.
+func bodyEnd(env SOAPEnvelope, prefixes map[string]string) string {
+	if _, byNamespace := prefixesByNamespace(prefixes); byNamespace[envelopeNamespace] != "" {
+		return "</" + byNamespace[envelopeNamespace] + ":Body>"
+	}
+	return env.bodyEnd()
+}
+
+// declaredPrefix returns the prefix attr declares, which is empty for the
+// default namespace, and whether attr is a namespace declaration.
+func declaredPrefix(attr xml.Attr) (string, bool) {
+	switch {
+	case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+		return "", true
+	case attr.Name.Space == "xmlns":
+		return attr.Name.Local, true
+	}
+	return "", false
+}
+
+func writeAttr(out *bytes.Buffer, name, value string) {
+	out.WriteString(" " + name + `="`)
+	xml.EscapeText(out, []byte(value))
+	out.WriteString(`"`)
+}
@@ -0,0 +1,154 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotRecorded is returned, wrapped, by calls of a client created with
+// WithReplayer whose request was not recorded.
+var ErrNotRecorded = errors.New("soap: no recorded interaction")
+
+// WithRecorder is an Option to record every request made by the client and
+// the response it got into a file of dir, for a client created with
+// WithReplayer to serve later. Recordings are named after the SOAP action and
+// a hash of the request body, and overwrite earlier recordings of the same
+// request.
+func WithRecorder(dir string) Option {
+	return func(o *options) {
+		o.recordDir = dir
+	}
+}
+
+// WithReplayer is an Option to serve the responses recorded in dir with
+// WithRecorder instead of sending requests. A request is matched by its SOAP
+// action and the hash of its body, so bodies must be deterministic: MTOM
+// boundaries and WS-Security nonces defeat the matching. Requests that were
+// not recorded fail with ErrNotRecorded.
+func WithReplayer(dir string) Option {
+	return func(o *options) {
+		o.replayDir = dir
+	}
+}
+
+// interaction is a recorded request and its response.
+type interaction struct {
+	Action   string      `json:"action"`
+	Request  string      `json:"request"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Response string      `json:"response"`
+}
+
+// interactionFile returns the file recording the request of soapAction with
+// the given body, in dir.
+func interactionFile(dir, soapAction string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(soapAction))
+	h.Write([]byte{0})
+	h.Write(body)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// readRequestBody reads the body of req, which is replaced so that it can
+// still be sent.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// recordingClient is an HTTPClient recording the interactions of client.
+type recordingClient struct {
+	client HTTPClient
+	dir    string
+}
+
+func (c *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(response))
+
+	soapAction := req.Header.Get("SOAPAction")
+	data, err := json.MarshalIndent(&interaction{
+		Action:   soapAction,
+		Request:  string(body),
+		Status:   res.StatusCode,
+		Header:   res.Header,
+		Response: string(response),
+	}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(interactionFile(c.dir, soapAction, body), data, 0644); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// replayingClient is an HTTPClient serving the interactions recorded in dir.
+type replayingClient struct {
+	dir string
+}
+
+func (c *replayingClient) Do(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	soapAction := req.Header.Get("SOAPAction")
+	data, err := ioutil.ReadFile(interactionFile(c.dir, soapAction, body))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w for action %q in %s", ErrNotRecorded, soapAction, c.dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded interaction
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(recorded.Response))),
+		ContentLength: int64(len(recorded.Response)),
+		Request:       req,
+	}, nil
+}
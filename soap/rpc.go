@@ -0,0 +1,65 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+)
+
+// An RPCPart is a part of an rpc style message, encoded by MarshalRPC.
+type RPCPart struct {
+	// Name is the name of the part element, unqualified unless the part
+	// names a global element.
+	Name xml.Name
+	// Type is the schema type the part element of an rpc/encoded message is
+	// marked with as its xsi:type. It is not marked if Local is empty.
+	Type  xml.Name
+	Value interface{}
+}
+
+// MarshalRPC encodes start, the operation or response element of an rpc style
+// message, with parts as its children, in order. Nil parts are omitted. The
+// namespace of start is bound to a prefix rather than made the default one,
+// which unqualified part elements would otherwise inherit. With encoded set,
+// start is marked with the SOAP encoding style and the parts with their
+// xsi:type, as rpc/encoded services expect.
+func MarshalRPC(e *xml.Encoder, start xml.StartElement, encoded bool, parts ...RPCPart) error {
+	if start.Name.Space != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:rpc"}, Value: start.Name.Space})
+		start.Name = xml.Name{Local: "rpc:" + start.Name.Local}
+	}
+	if encoded {
+		start.Attr = append(start.Attr,
+			xml.Attr{Name: xml.Name{Local: "xmlns:soapenv"}, Value: envelopeNamespace},
+			xml.Attr{Name: xml.Name{Local: "soapenv:encodingStyle"}, Value: SOAPEncNs},
+			xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace},
+			xml.Attr{Name: xml.Name{Local: "xmlns:xsd"}, Value: xsdNamespace},
+		)
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		v := reflect.ValueOf(part.Value)
+		if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+			continue
+		}
+
+		partStart := xml.StartElement{Name: part.Name}
+		switch {
+		case !encoded || part.Type.Local == "":
+		case part.Type.Space == xsdNamespace:
+			partStart.Attr = append(partStart.Attr, xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: "xsd:" + part.Type.Local})
+		default:
+			partStart.Attr = append(partStart.Attr,
+				xml.Attr{Name: xml.Name{Local: "xmlns:xsitype"}, Value: part.Type.Space},
+				xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: "xsitype:" + part.Type.Local},
+			)
+		}
+		if err := e.EncodeElement(part.Value, partStart); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,217 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// A ServerOperation is an operation served by the handler returned by
+// NewHandler. Generated servers declare one per operation of a port type.
+type ServerOperation struct {
+	// Action is the SOAP action requests of the operation are sent with.
+	Action string
+	// Element is the name of the body element of the requests, which
+	// dispatches requests whose SOAP action matches no operation.
+	Element xml.Name
+	// Request returns the value the body element is decoded into. It is nil
+	// for operations without input, whose body element is skipped.
+	Request func() interface{}
+	// Serve serves the decoded request. It returns the content of the
+	// response body, or nil for one-way operations.
+	Serve func(ctx context.Context, request interface{}) (interface{}, error)
+	// OneWay is set for operations without output, whose requests are
+	// answered with a 202 HTTP status. The other operations get a
+	// soap:Server fault if Serve returns no response.
+	OneWay bool
+}
+
+type requestHeaderKey struct{}
+
+// RequestHeader returns the raw XML content of the SOAP Header of the request
+// served with ctx by a handler returned by NewHandler, or nil if the request
+// has no header.
+func RequestHeader(ctx context.Context) []byte {
+	header, _ := ctx.Value(requestHeaderKey{}).([]byte)
+	return header
+}
+
+// NewHandler returns an http.Handler serving SOAP requests with operations.
+// Requests are dispatched by their SOAPAction header, or by their body element
+// when the action is missing or ambiguous. The response content is sent back
+// in an envelope, and errors as SOAP faults: a *SOAPFault is sent as is, and
+// other errors as a soap:Server fault with the error message. Requests that
+// cannot be decoded or dispatched get a soap:Client fault.
+func NewHandler(operations ...ServerOperation) http.Handler {
+	return &handler{operations: operations}
+}
+
+type handler struct {
+	operations []ServerOperation
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "SOAP requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	d := xml.NewDecoder(r.Body)
+	d.CharsetReader = charsetReader
+	header, body, err := envelopeParts(d)
+	if err != nil {
+		writeFault(w, &SOAPFault{Code: "soap:Client", String: err.Error()})
+		return
+	}
+	if header != nil {
+		ctx = context.WithValue(ctx, requestHeaderKey{}, header)
+	}
+
+	op := h.operation(strings.Trim(r.Header.Get("SOAPAction"), `"`), body.Name)
+	if op == nil {
+		writeFault(w, &SOAPFault{Code: "soap:Client", String: fmt.Sprintf("no operation for SOAP action %q and element %s", r.Header.Get("SOAPAction"), body.Name.Local)})
+		return
+	}
+
+	var request interface{}
+	if op.Request != nil {
+		request = op.Request()
+		err = d.DecodeElement(request, &body)
+	} else {
+		err = d.Skip()
+	}
+	if err != nil {
+		writeFault(w, &SOAPFault{Code: "soap:Client", String: err.Error()})
+		return
+	}
+
+	response, err := op.Serve(ctx, request)
+	if err != nil {
+		var fault *SOAPFault
+		if !errors.As(err, &fault) {
+			fault = &SOAPFault{String: err.Error()}
+		}
+		if fault.Code == "" {
+			fault = &SOAPFault{Code: "soap:Server", String: fault.String, Actor: fault.Actor, Detail: fault.Detail}
+		}
+		writeFault(w, fault)
+		return
+	}
+	if response == nil && op.OneWay {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if response == nil {
+		writeFault(w, &SOAPFault{Code: "soap:Server", String: fmt.Sprintf("no response to %s", body.Name.Local)})
+		return
+	}
+
+	envelope := SOAPEnvelope{}
+	envelope.Body.Content = response
+	data, err := xml.Marshal(envelope)
+	if err != nil {
+		writeFault(w, &SOAPFault{Code: "soap:Server", String: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// operation returns the operation of soapAction, or the one whose requests
+// have the element name if no single operation has that action.
+func (h *handler) operation(soapAction string, name xml.Name) *ServerOperation {
+	var found *ServerOperation
+	if soapAction != "" {
+		for i := range h.operations {
+			if h.operations[i].Action != soapAction {
+				continue
+			}
+			if found != nil {
+				found = nil
+				break
+			}
+			found = &h.operations[i]
+		}
+	}
+	if found != nil {
+		return found
+	}
+
+	for i := range h.operations {
+		if h.operations[i].Element == name {
+			return &h.operations[i]
+		}
+	}
+	return nil
+}
+
+// envelopeParts reads a SOAP envelope from d up to the start of the body
+// element, returning the raw header content, if any, and the body element.
+func envelopeParts(d *xml.Decoder) ([]byte, xml.StartElement, error) {
+	var header []byte
+	inBody := false
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil, xml.StartElement{}, errors.New("missing SOAP body element")
+		}
+		if err != nil {
+			return nil, xml.StartElement{}, err
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch {
+		case inBody:
+			return header, se, nil
+		case se.Name.Space == envelopeNamespace && se.Name.Local == "Header":
+			var raw struct {
+				Content []byte `xml:",innerxml"`
+			}
+			if err := d.DecodeElement(&raw, &se); err != nil {
+				return nil, xml.StartElement{}, err
+			}
+			header = raw.Content
+		case se.Name.Space == envelopeNamespace && se.Name.Local == "Body":
+			inBody = true
+		case se.Name.Space != envelopeNamespace || se.Name.Local != "Envelope":
+			return nil, xml.StartElement{}, fmt.Errorf("unexpected element %s in SOAP envelope", se.Name.Local)
+		}
+	}
+}
+
+// writeFault writes a SOAP fault envelope. Its fault elements are written
+// unqualified, as SOAP 1.1 requires, which xml.Marshal of SOAPFault does not.
+func writeFault(w http.ResponseWriter, fault *SOAPFault) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + envelopeNamespace + `"><soap:Body><soap:Fault>`)
+	for _, field := range []struct{ name, value string }{
+		{"faultcode", fault.Code},
+		{"faultstring", fault.String},
+		{"faultactor", fault.Actor},
+		{"detail", fault.Detail},
+	} {
+		if field.value == "" && field.name != "faultstring" {
+			continue
+		}
+		buf.WriteString("<" + field.name + ">")
+		xml.EscapeText(buf, []byte(field.value))
+		buf.WriteString("</" + field.name + ">")
+	}
+	buf.WriteString(`</soap:Fault></soap:Body></soap:Envelope>`)
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(buf.Bytes())
+}
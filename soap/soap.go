@@ -3,11 +3,20 @@ package soap
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -24,6 +33,9 @@ type SOAPEnvelope struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
 	Header  *SOAPHeader
 	Body    SOAPBody
+
+	prefix           string
+	schemaNamespaces bool
 }
 
 type SOAPHeader struct {
@@ -97,18 +109,30 @@ type SOAPFault struct {
 	String string `xml:"faultstring,omitempty"`
 	Actor  string `xml:"faultactor,omitempty"`
 	Detail string `xml:"detail,omitempty"`
+
+	// raw is the start of the response body the fault was decoded from.
+	raw []byte
 }
 
 func (f *SOAPFault) Error() string {
 	return f.String
 }
 
+// RawBody returns the start of the response body the fault was decoded from,
+// truncated to 4 KiB, or nil if it was not received by a Client.
+func (f *SOAPFault) RawBody() []byte {
+	return f.raw
+}
+
 const (
 	// Predefined WSS namespaces to be used in
-	WssNsWSSE       string = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
-	WssNsWSU        string = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
-	WssNsType       string = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText"
-	mtomContentType string = `multipart/related; start-info="application/soap+xml"; type="application/xop+xml"; boundary="%s"`
+	WssNsWSSE         string = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	WssNsWSU          string = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	WssNsType         string = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText"
+	xsiNamespace      string = "http://www.w3.org/2001/XMLSchema-instance"
+	xsdNamespace      string = "http://www.w3.org/2001/XMLSchema"
+	envelopeNamespace string = "http://schemas.xmlsoap.org/soap/envelope/"
+	mtomContentType   string = `multipart/related; start-info="%s"; type="%s"; boundary="%s"`
 )
 
 type WSSSecurityHeader struct {
@@ -117,7 +141,8 @@ type WSSSecurityHeader struct {
 
 	MustUnderstand string `xml:"mustUnderstand,attr,omitempty"`
 
-	Token *WSSUsernameToken `xml:",omitempty"`
+	Timestamp *WSSTimestamp     `xml:",omitempty"`
+	Token     *WSSUsernameToken `xml:",omitempty"`
 }
 
 type WSSUsernameToken struct {
@@ -129,6 +154,8 @@ type WSSUsernameToken struct {
 
 	Username *WSSUsername `xml:",omitempty"`
 	Password *WSSPassword `xml:",omitempty"`
+	Nonce    *WSSNonce    `xml:",omitempty"`
+	Created  string       `xml:"wsu:Created,omitempty"`
 }
 
 type WSSUsername struct {
@@ -146,7 +173,9 @@ type WSSPassword struct {
 	Data string `xml:",chardata"`
 }
 
-// NewWSSSecurityHeader creates WSSSecurityHeader instance
+// NewWSSSecurityHeader creates WSSSecurityHeader instance, whose UsernameToken
+// sends pass as text. Use WithPasswordDigest rather than a header built with
+// NewWSSPasswordDigestHeader to send a digest of it instead.
 func NewWSSSecurityHeader(user, pass, tokenID, mustUnderstand string) *WSSSecurityHeader {
 	hdr := &WSSSecurityHeader{XmlNSWsse: WssNsWSSE, MustUnderstand: mustUnderstand}
 	hdr.Token = &WSSUsernameToken{XmlNSWsu: WssNsWSU, XmlNSWsse: WssNsWSSE, Id: tokenID}
@@ -161,20 +190,46 @@ type basicAuth struct {
 }
 
 type options struct {
-	tlsCfg           *tls.Config
-	auth             *basicAuth
-	timeout          time.Duration
-	contimeout       time.Duration
-	tlshshaketimeout time.Duration
-	client           HTTPClient
-	httpHeaders      map[string]string
-	mtom             bool
+	tlsCfg            *tls.Config
+	proxy             *url.URL
+	auth              *basicAuth
+	bearerToken       string
+	tokenSource       TokenSource
+	timeout           time.Duration
+	contimeout        time.Duration
+	tlshshaketimeout  time.Duration
+	client            HTTPClient
+	httpHeaders       map[string]string
+	mtom              bool
+	mtomType          string
+	mtomStartInfo     string
+	requestGzip       bool
+	gzipThreshold     int
+	securityTimestamp time.Duration
+	passwordDigest    *basicAuth
+	securitySkew      time.Duration
+	namespacePrefixes map[string]string
+	certPin           []byte
+	retry             RetryPolicy
+	maxRetryBuffer    int
+	maxResponseSize   int64
+	prefixConflicts   PrefixConflictPolicy
+	recordDir         string
+	envelopePrefix    string
+	schemaNamespaces  bool
+	preCallHooks      []func(ctx context.Context, action string, req interface{})
+	postCallHooks     []func(ctx context.Context, action string, resp interface{}, err error)
+	replayDir         string
 }
 
 var defaultOptions = options{
 	timeout:          time.Duration(30 * time.Second),
 	contimeout:       time.Duration(90 * time.Second),
 	tlshshaketimeout: time.Duration(15 * time.Second),
+	maxRetryBuffer:   1 << 20,
+	mtomType:         "application/xop+xml",
+	mtomStartInfo:    "application/soap+xml",
+	gzipThreshold:    defaultGzipThreshold,
 }
 
 // A Option sets options such as credentials, tls, etc.
@@ -182,7 +237,8 @@ type Option func(*options)
 
 // WithHTTPClient is an Option to set the HTTP client to use
 // This cannot be used with WithTLSHandshakeTimeout, WithTLS,
-// WithTimeout options
+// WithTimeout, WithProxy options. The transport of the HTTP client decides
+// on the proxy, as http.DefaultTransport does from the environment.
 func WithHTTPClient(c HTTPClient) Option {
 	return func(o *options) {
 		o.client = c
@@ -220,6 +276,37 @@ func WithTLS(tls *tls.Config) Option {
 	}
 }
 
+// WithProxy is an Option to send requests through the HTTP or HTTPS proxy u.
+// Without it, requests use the proxy of the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables, as the http.DefaultTransport does.
+// This option cannot be used with WithHTTPClient, whose client decides on
+// the proxy itself
+func WithProxy(u *url.URL) Option {
+	return func(o *options) {
+		o.proxy = u
+	}
+}
+
+// WithServerCertPin is an Option to pin the server certificate to the given
+// SHA-256 fingerprint, hex encoded with or without colons. The pin is checked
+// in addition to the regular chain validation, or on its own when the TLS
+// config set with WithTLS skips verification. Like regexp.MustCompile, it
+// panics if fingerprint is not a hex encoded SHA-256 digest, rather than
+// build a client whose pin could never match.
+// This option cannot be used with WithHTTPClient
+func WithServerCertPin(fingerprint string) Option {
+	pin, err := hex.DecodeString(strings.Replace(fingerprint, ":", "", -1))
+	if err != nil {
+		panic(fmt.Sprintf("soap: invalid server certificate pin %q: %v", fingerprint, err))
+	}
+	if len(pin) != sha256.Size {
+		panic(fmt.Sprintf("soap: invalid server certificate pin %q: got %d bytes, want the %d of a SHA-256 digest", fingerprint, len(pin), sha256.Size))
+	}
+	return func(o *options) {
+		o.certPin = pin
+	}
+}
+
 // WithTimeout is an Option to set default HTTP dial timeout
 func WithTimeout(t time.Duration) Option {
 	return func(o *options) {
@@ -227,6 +314,62 @@ func WithTimeout(t time.Duration) Option {
 	}
 }
 
+// A RetryPolicy decides whether a request for soapAction is sent again after
+// its attempt-th attempt failed, either with the transport error err or with
+// the HTTP response res. Only the response status and headers should be
+// inspected, since the body is discarded when the request is retried.
+type RetryPolicy func(soapAction string, attempt int, res *http.Response, err error) bool
+
+// maxRetryAttempts is the number of attempts made by WithRetryForActions.
+const maxRetryAttempts = 3
+
+// retryBackoff is the delay before the first retry, which grows linearly with
+// the number of attempts.
+var retryBackoff = 100 * time.Millisecond
+
+// WithRetryPolicy is an Option to retry failed requests as decided by policy.
+// Requests are not retried by default.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithRetryForActions is an Option to retry requests for the given SOAP
+// actions, up to three attempts, when they fail with a transport error or a
+// 502, 503 or 504 HTTP status. Only actions that are safe to repeat, such as
+// idempotent reads, should be listed; other actions are never retried.
+func WithRetryForActions(actions ...string) Option {
+	retried := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		retried[action] = true
+	}
+
+	return WithRetryPolicy(func(soapAction string, attempt int, res *http.Response, err error) bool {
+		if !retried[soapAction] || attempt >= maxRetryAttempts {
+			return false
+		}
+		if err != nil {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+		switch res.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	})
+}
+
+// WithMaxRetryBuffer is an Option to set how many bytes of a streamed request
+// body are buffered so that the request can be retried. Requests whose body is
+// larger, and cannot be rewound, are sent once without retries. It defaults to
+// 1 MiB and only matters when a retry policy is set.
+func WithMaxRetryBuffer(bytes int) Option {
+	return func(o *options) {
+		o.maxRetryBuffer = bytes
+	}
+}
+
 // WithHTTPHeaders is an Option to set global HTTP headers for all requests
 func WithHTTPHeaders(headers map[string]string) Option {
 	return func(o *options) {
@@ -242,6 +385,22 @@ func WithMTOM() Option {
 	}
 }
 
+// WithMTOMContentType is an Option to set the type and start-info parameters
+// of the multipart/related Content-Type of MTOM requests, which default to
+// application/xop+xml and application/soap+xml, for servers that expect other
+// values. The type is also the Content-Type of the root part. Empty values
+// keep the defaults. It has no effect without WithMTOM.
+func WithMTOMContentType(typ, startInfo string) Option {
+	return func(o *options) {
+		if typ != "" {
+			o.mtomType = typ
+		}
+		if startInfo != "" {
+			o.mtomStartInfo = startInfo
+		}
+	}
+}
+
 // Client is soap client
 type Client struct {
 	url     string
@@ -279,7 +438,60 @@ func (s *Client) SetHeaders(headers ...interface{}) {
 	s.headers = headers
 }
 
-// CallContext performs HTTP POST request with a context
+type headersKey struct{}
+
+// ContextWithHeaders returns a copy of ctx carrying SOAP headers, which are
+// sent after the client headers by the calls made with the returned context.
+// Unlike AddHeader, the headers only apply to those calls.
+func ContextWithHeaders(ctx context.Context, headers ...interface{}) context.Context {
+	previous, _ := ctx.Value(headersKey{}).([]interface{})
+	all := make([]interface{}, 0, len(previous)+len(headers))
+	all = append(append(all, previous...), headers...)
+	return context.WithValue(ctx, headersKey{}, all)
+}
+
+type endpointKey struct{}
+
+// ContextWithEndpoint returns a copy of ctx directing the calls made with the
+// returned context to url rather than to the URL of the client, which is left
+// unchanged.
+func ContextWithEndpoint(ctx context.Context, url string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, url)
+}
+
+// endpoint returns the URL a call made with ctx is sent to.
+func (s *Client) endpoint(ctx context.Context) string {
+	if url, ok := ctx.Value(endpointKey{}).(string); ok && url != "" {
+		return url
+	}
+	return s.url
+}
+
+// envelopeHeaders returns the headers of a call made with ctx, with their
+// prefix conflicts handled as configured.
+func (s *Client) envelopeHeaders(ctx context.Context) ([]interface{}, error) {
+	headers := s.headers
+	if extra, _ := ctx.Value(headersKey{}).([]interface{}); len(extra) > 0 {
+		headers = append(append([]interface{}{}, s.headers...), extra...)
+	}
+	created := time.Now().Add(s.opts.securitySkew)
+	if s.opts.passwordDigest != nil {
+		headers = digestHeaders(headers, s.opts.passwordDigest, created)
+	}
+	if s.opts.securityTimestamp > 0 {
+		headers = timestampHeaders(headers, s.opts.securityTimestamp, created)
+	}
+	return resolvePrefixConflicts(headers, s.opts.prefixConflicts)
+}
+
+// CallContext performs HTTP POST request with a context.
+//
+// A request implementing io.Reader is streamed as the raw XML content of the
+// SOAP body. It is rewound before a retry if it implements io.Seeker, and
+// buffered up to the WithMaxRetryBuffer limit otherwise.
+//
+// A SOAP fault in the response is returned as a *SOAPFault, and a response
+// with a non 2xx HTTP status that is not a fault as an *HTTPError.
 func (s *Client) CallContext(ctx context.Context, soapAction string, request, response interface{}) error {
 	return s.call(ctx, soapAction, request, response)
 }
@@ -288,8 +500,145 @@ func (s *Client) CallContext(ctx context.Context, soapAction string, request, re
 func (s *Client) Call(soapAction string, request, response interface{}) error {
 	return s.call(context.Background(), soapAction, request, response)
 }
+
+// CallTo performs HTTP POST request to url rather than to the URL of the
+// client, as CallContext does with a context returned by ContextWithEndpoint.
+func (s *Client) CallTo(url, soapAction string, request, response interface{}) error {
+	return s.call(ContextWithEndpoint(context.Background(), url), soapAction, request, response)
+}
+
+// CallOneWay performs HTTP POST request for one-way operations. The response
+// body is read and discarded without being unmarshalled; any 2xx status,
+// including an empty body, is considered a success, and other statuses fail
+// with an *HTTPError.
+func (s *Client) CallOneWay(ctx context.Context, soapAction string, request interface{}) (err error) {
+	s.preCall(ctx, soapAction, request)
+	defer func() { s.postCall(ctx, soapAction, nil, err) }()
+
+	res, err := s.doRequest(ctx, soapAction, request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if !isSuccess(res) {
+		return newHTTPError(res, nil)
+	}
+
+	_, err = io.Copy(ioutil.Discard, res.Body)
+	return err
+}
+
+// maxFaultPeek is the number of response bytes CallRawStream reads ahead,
+// looking for a SOAP fault, before it starts copying the response.
+const maxFaultPeek = 64 << 10
+
+// CallRawStream performs HTTP POST request and copies the raw response body,
+// the SOAP envelope as received, to w without decoding it, as a passthrough
+// proxy does. Only the start of the response is read ahead to detect a SOAP
+// fault, which is returned instead of being copied. Responses with a non 2xx
+// HTTP status that are not faults are not copied either, but returned as an
+// *HTTPError.
+func (s *Client) CallRawStream(ctx context.Context, soapAction string, request interface{}, w io.Writer) (err error) {
+	s.preCall(ctx, soapAction, request)
+	defer func() { s.postCall(ctx, soapAction, nil, err) }()
+
+	res, err := s.doRequest(ctx, soapAction, request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, _, err := streamedBody(res)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// streamedBody returns the body of the response res to a streamed call, and
+// the start of it, which is read ahead to detect a SOAP fault. The fault is
+// returned as the error instead, as is a response with a non 2xx HTTP status.
+func streamedBody(res *http.Response) (io.Reader, []byte, error) {
+	peeked := new(bytes.Buffer)
+	isFault := peekFault(io.TeeReader(io.LimitReader(res.Body, maxFaultPeek), peeked))
+	start := peeked.Bytes()
+	body := io.MultiReader(peeked, res.Body)
+	if vm := versionMismatch(start); vm != nil {
+		return nil, nil, vm
+	}
+
+	if isFault {
+		envelope := &SOAPEnvelope{Body: SOAPBody{Content: &struct{}{}}}
+		d := xml.NewDecoder(body)
+		d.CharsetReader = charsetReader
+		if err := d.Decode(envelope); err != nil {
+			return nil, nil, newDecodeError(err, res, start)
+		}
+		if envelope.Body.Fault != nil {
+			envelope.Body.Fault.raw = truncateBody(start)
+			return nil, nil, envelope.Body.Fault
+		}
+	}
+
+	if !isSuccess(res) {
+		return nil, nil, newHTTPError(res, start)
+	}
+	return body, start, nil
+}
+
+// peekFault reports whether the SOAP envelope read from r holds a fault,
+// reading no further than the first element of its body.
+func peekFault(r io.Reader) bool {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charsetReader
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return false
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "Envelope", "Body":
+		case "Header":
+			if err := d.Skip(); err != nil {
+				return false
+			}
+		default:
+			return se.Name.Local == "Fault" && se.Name.Space == "http://schemas.xmlsoap.org/soap/envelope/"
+		}
+	}
+}
+
+// PreviewHeaders marshals the SOAP Header block that would be sent with the
+// next request, without a body, so the header configuration (WS-Security,
+// addressing, ...) can be inspected in isolation. It returns nil if no
+// headers are set.
+func (s *Client) PreviewHeaders() ([]byte, error) {
+	if len(s.headers) == 0 {
+		return nil, nil
+	}
+
+	headers, err := resolvePrefixConflicts(s.headers, s.opts.prefixConflicts)
+	if err != nil {
+		return nil, err
+	}
+	return xml.Marshal(&SOAPHeader{Headers: headers})
+}
+
+// newEnvelope returns an empty request envelope, marshaled as configured.
+func (s *Client) newEnvelope() SOAPEnvelope {
+	return SOAPEnvelope{prefix: s.opts.envelopePrefix, schemaNamespaces: s.opts.schemaNamespaces}
+}
+
 func (s *Client) GetRequest(request interface{}) (SOAPEnvelope, error) {
-	envelope := SOAPEnvelope{}
+	envelope := s.newEnvelope()
 
 	if s.headers != nil && len(s.headers) > 0 {
 		envelope.Header = &SOAPHeader{
@@ -301,9 +650,9 @@ func (s *Client) GetRequest(request interface{}) (SOAPEnvelope, error) {
 	buffer := new(bytes.Buffer)
 	var encoder SOAPEncoder
 	if s.opts.mtom {
-		encoder = newMtomEncoder(buffer)
+		encoder = newMtomEncoder(buffer, s.opts.mtomType, s.opts.namespacePrefixes)
 	} else {
-		encoder = xml.NewEncoder(buffer)
+		encoder = newXMLEncoder(buffer, s.opts.namespacePrefixes)
 	}
 
 	if err := encoder.Encode(envelope); err != nil {
@@ -317,11 +666,158 @@ func (s *Client) GetRequest(request interface{}) (SOAPEnvelope, error) {
 }
 
 func (s *Client) call(ctx context.Context, soapAction string, request, response interface{}) error {
-	envelope := SOAPEnvelope{}
+	s.preCall(ctx, soapAction, request)
+	err := s.roundTrip(ctx, soapAction, request, response)
+	s.postCall(ctx, soapAction, response, err)
+	return err
+}
 
-	if s.headers != nil && len(s.headers) > 0 {
+// roundTrip sends the request of a call and decodes its response.
+func (s *Client) roundTrip(ctx context.Context, soapAction string, request, response interface{}) error {
+	res, err := s.doRequest(ctx, soapAction, request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	respEnvelope := new(SOAPEnvelope)
+	respEnvelope.Body = SOAPBody{Content: response}
+
+	mtomBoundary, err := getMtomHeader(res.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	var (
+		dec SOAPDecoder
+		raw func() []byte
+	)
+	if mtomBoundary != "" {
+		head := new(headWriter)
+		dec = newMtomDecoder(io.TeeReader(res.Body, head), mtomBoundary)
+		raw = func() []byte { return head.head }
+	} else {
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		if vm := versionMismatch(body); vm != nil {
+			return vm
+		}
+		if !isSuccess(res) && !peekFault(bytes.NewReader(body)) {
+			return newHTTPError(res, body)
+		}
+		raw = func() []byte { return body }
+		decoded, err := utf8Body(res.Header.Get("Content-Type"), body)
+		if err != nil {
+			return newDecodeError(err, res, body)
+		}
+		dec = xml.NewDecoder(bytes.NewReader(stripNilElements(resolveMultiRefs(decoded))))
+	}
+
+	if err := dec.Decode(respEnvelope); err != nil {
+		return newDecodeError(err, res, raw())
+	}
+
+	fault := respEnvelope.Body.Fault
+	if fault != nil {
+		fault.raw = truncateBody(raw())
+		return fault
+	}
+
+	return nil
+}
+
+// tlsConfig returns the TLS configuration of the default transport.
+func (s *Client) tlsConfig() *tls.Config {
+	if s.opts.certPin == nil {
+		return s.opts.tlsCfg
+	}
+
+	cfg := &tls.Config{}
+	if s.opts.tlsCfg != nil {
+		cfg = s.opts.tlsCfg.Clone()
+	}
+	pin := s.opts.certPin
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+		fingerprint := sha256.Sum256(rawCerts[0])
+		if !bytes.Equal(fingerprint[:], pin) {
+			return fmt.Errorf("server certificate fingerprint %x does not match the pinned one", fingerprint)
+		}
+		return nil
+	}
+	return cfg
+}
+
+// stripNilElements removes every element marked with xsi:nil="true" from an
+// XML document, so that the pointer fields they map to are left nil when the
+// document is decoded instead of pointing to a zero value. Documents that
+// cannot be tokenized are returned unmodified, leaving the error reporting to
+// the actual decoder.
+func stripNilElements(data []byte) []byte {
+	if !bytes.Contains(data, []byte(xsiNamespace)) {
+		return data
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	out := new(bytes.Buffer)
+	var last int64
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return data
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok || !isNilElement(se) {
+			continue
+		}
+
+		out.Write(data[last:offset])
+		if err := d.Skip(); err != nil {
+			return data
+		}
+		last = d.InputOffset()
+	}
+	out.Write(data[last:])
+
+	return out.Bytes()
+}
+
+func isNilElement(se xml.StartElement) bool {
+	for _, attr := range se.Attr {
+		if attr.Name.Space == xsiNamespace && attr.Name.Local == "nil" {
+			return attr.Value == "true" || attr.Value == "1"
+		}
+	}
+	return false
+}
+
+// doRequest marshals the request into a SOAP envelope and posts it to the
+// service, retrying as decided by the retry policy. The caller is responsible
+// for closing the response body.
+func (s *Client) doRequest(ctx context.Context, soapAction string, request interface{}) (*http.Response, error) {
+	if r, ok := request.(io.Reader); ok {
+		return s.doStreamRequest(ctx, soapAction, r)
+	}
+
+	headers, err := s.envelopeHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := s.newEnvelope()
+
+	if len(headers) > 0 {
 		envelope.Header = &SOAPHeader{
-			Headers: s.headers,
+			Headers: headers,
 		}
 	}
 
@@ -329,33 +825,148 @@ func (s *Client) call(ctx context.Context, soapAction string, request, response
 	buffer := new(bytes.Buffer)
 	var encoder SOAPEncoder
 	if s.opts.mtom {
-		encoder = newMtomEncoder(buffer)
+		encoder = newMtomEncoder(buffer, s.opts.mtomType, s.opts.namespacePrefixes)
 	} else {
-		encoder = xml.NewEncoder(buffer)
+		encoder = newXMLEncoder(buffer, s.opts.namespacePrefixes)
 	}
 
 	if err := encoder.Encode(envelope); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := encoder.Flush(); err != nil {
-		return err
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", s.url, buffer)
+	var contentType string
+	if s.opts.mtom {
+		contentType = fmt.Sprintf(mtomContentType, s.opts.mtomStartInfo, s.opts.mtomType, encoder.(*mtomEncoder).Boundary())
+	} else {
+		contentType = "text/xml; charset=\"utf-8\""
+	}
+
+	body, contentEncoding, err := s.gzipBody(buffer.Bytes())
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return s.send(ctx, soapAction, contentType, contentEncoding, s.retryPolicy(), func() (io.Reader, error) {
+		return bytes.NewReader(body), nil
+	})
+}
+
+// doStreamRequest posts an envelope whose body content is read from r. Bodies
+// that can neither be rewound nor buffered within the retry buffer limit are
+// sent without retries.
+func (s *Client) doStreamRequest(ctx context.Context, soapAction string, r io.Reader) (*http.Response, error) {
+	if s.opts.mtom {
+		return nil, errors.New("streamed request bodies cannot be sent with MTOM")
+	}
+
+	headers, err := s.envelopeHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := s.newEnvelope()
+	if len(headers) > 0 {
+		envelope.Header = &SOAPHeader{Headers: headers}
+	}
+	buffer := new(bytes.Buffer)
+	if err := newXMLEncoder(buffer, s.opts.namespacePrefixes).Encode(envelope); err != nil {
+		return nil, err
+	}
+	framing := buffer.Bytes()
+	i := bytes.LastIndex(framing, []byte(bodyEnd(envelope, s.opts.namespacePrefixes)))
+	prefix, suffix := framing[:i], framing[i:]
+
+	retry := s.retryPolicy()
+	var content func() (io.Reader, error)
+	if seeker, ok := r.(io.Seeker); ok && retry != nil {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		content = func() (io.Reader, error) {
+			_, err := seeker.Seek(start, io.SeekStart)
+			return r, err
+		}
+	} else if retry != nil {
+		buffered, err := ioutil.ReadAll(io.LimitReader(r, int64(s.opts.maxRetryBuffer)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(buffered) <= s.opts.maxRetryBuffer {
+			content = func() (io.Reader, error) { return bytes.NewReader(buffered), nil }
+		} else {
+			log.Printf("soap: request body for %s exceeds the %d bytes retry buffer, the request won't be retried", soapAction, s.opts.maxRetryBuffer)
+			retry = nil
+			r = io.MultiReader(bytes.NewReader(buffered), r)
+		}
+	}
+	if content == nil {
+		content = func() (io.Reader, error) { return r, nil }
+	}
+
+	return s.send(ctx, soapAction, "text/xml; charset=\"utf-8\"", "", retry, func() (io.Reader, error) {
+		c, err := content()
+		if err != nil {
+			return nil, err
+		}
+		return io.MultiReader(bytes.NewReader(prefix), c, bytes.NewReader(suffix)), nil
+	})
+}
+
+// send posts the request body returned by body, which is called again for
+// every attempt made according to retry. The body is encoded with
+// contentEncoding, if not empty.
+func (s *Client) send(ctx context.Context, soapAction, contentType, contentEncoding string, retry RetryPolicy, body func() (io.Reader, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		token, err := s.accessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r, err := body()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := s.post(ctx, soapAction, contentType, contentEncoding, token, r)
+		if retry == nil || !retry(soapAction, attempt, res, err) {
+			return res, err
+		}
+
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+	}
+}
+
+// post sends a single attempt of a request whose encoded envelope is body,
+// with the bearer token, if not empty.
+func (s *Client) post(ctx context.Context, soapAction, contentType, contentEncoding, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest("POST", s.endpoint(ctx), body)
+	if err != nil {
+		return nil, err
 	}
 	if s.opts.auth != nil {
 		req.SetBasicAuth(s.opts.auth.Login, s.opts.auth.Password)
 	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	req = req.WithContext(ctx)
 
-	if s.opts.mtom {
-		req.Header.Add("Content-Type", fmt.Sprintf(mtomContentType, encoder.(*mtomEncoder).Boundary()))
-	} else {
-		req.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
+	req.Header.Add("Content-Type", contentType)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
 	}
 	req.Header.Add("SOAPAction", soapAction)
 	req.Header.Set("User-Agent", "gowsdl/0.1")
@@ -368,8 +979,13 @@ func (s *Client) call(ctx context.Context, soapAction string, request, response
 
 	client := s.opts.client
 	if client == nil {
+		proxy := http.ProxyFromEnvironment
+		if s.opts.proxy != nil {
+			proxy = http.ProxyURL(s.opts.proxy)
+		}
 		tr := &http.Transport{
-			TLSClientConfig: s.opts.tlsCfg,
+			Proxy:           proxy,
+			TLSClientConfig: s.tlsConfig(),
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
 				d := net.Dialer{Timeout: s.opts.timeout}
 				return d.DialContext(ctx, network, addr)
@@ -378,36 +994,16 @@ func (s *Client) call(ctx context.Context, soapAction string, request, response
 		}
 		client = &http.Client{Timeout: s.opts.contimeout, Transport: tr}
 	}
-
-	res, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	respEnvelope := new(SOAPEnvelope)
-	respEnvelope.Body = SOAPBody{Content: response}
-
-	mtomBoundary, err := getMtomHeader(res.Header.Get("Content-Type"))
-	if err != nil {
-		return err
-	}
-
-	var dec SOAPDecoder
-	if mtomBoundary != "" {
-		dec = newMtomDecoder(res.Body, mtomBoundary)
-	} else {
-		dec = xml.NewDecoder(res.Body)
+	if s.opts.recordDir != "" {
+		client = &recordingClient{client: client, dir: s.opts.recordDir}
 	}
-
-	if err := dec.Decode(respEnvelope); err != nil {
-		return err
+	if s.opts.replayDir != "" {
+		client = &replayingClient{dir: s.opts.replayDir}
 	}
 
-	fault := respEnvelope.Body.Fault
-	if fault != nil {
-		return fault
+	res, err := client.Do(req)
+	if err == nil && s.opts.maxResponseSize > 0 {
+		res.Body = newLimitedBody(res.Body, s.opts.maxResponseSize, res.ContentLength)
 	}
-
-	return nil
+	return res, err
 }
@@ -2,11 +2,28 @@ package soap
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/andreyvit/diff"
 	"github.com/clbanning/mxj"
@@ -71,6 +88,605 @@ func TestClient_Call(t *testing.T) {
 	}
 }
 
+func TestClient_CallOneWay(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{http.StatusOK, "", false},
+		{http.StatusAccepted, "", false},
+		{http.StatusOK, "not even xml", false},
+		{http.StatusInternalServerError, "", true},
+	}
+
+	for _, test := range tests {
+		var pingRequest = new(Ping)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			envelope := &SOAPEnvelope{Body: SOAPBody{Content: pingRequest}}
+			xml.NewDecoder(r.Body).Decode(envelope)
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+
+		client := NewClient(ts.URL)
+		req := &Ping{Request: &PingRequest{Message: "Hi"}}
+		err := client.CallOneWay(context.Background(), "Notify", req)
+		ts.Close()
+
+		if test.wantErr && err == nil {
+			t.Errorf("status %d: expected an error", test.status)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("status %d: unexpected error: %v", test.status, err)
+		}
+		if pingRequest.Request == nil || pingRequest.Request.Message != "Hi" {
+			t.Errorf("status %d: server did not receive the request", test.status)
+		}
+	}
+}
+
+func TestClient_HTTPError(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("upstream down ", 1000) + "</body></html>"
+	fault := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>out of stock</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") == "Fault" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(fault))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(page))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	for name, call := range map[string]func() error{
+		"Call":       func() error { return client.Call("Ping", &Ping{}, &PingResponse{}) },
+		"CallOneWay": func() error { return client.CallOneWay(context.Background(), "Ping", &Ping{}) },
+		"CallRawStream": func() error {
+			return client.CallRawStream(context.Background(), "Ping", &Ping{}, ioutil.Discard)
+		},
+	} {
+		err := call()
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Errorf("%s: got error %v, wanted an *HTTPError", name, err)
+			continue
+		}
+		if httpErr.StatusCode != http.StatusBadGateway || httpErr.Status != "502 Bad Gateway" {
+			t.Errorf("%s: got status %d %q", name, httpErr.StatusCode, httpErr.Status)
+		}
+		if string(httpErr.Body) != page[:maxHTTPErrorBody] {
+			t.Errorf("%s: got body %q, wanted the first %d bytes of the page", name, httpErr.Body, maxHTTPErrorBody)
+		}
+	}
+
+	err := client.Call("Fault", &Ping{}, &PingResponse{})
+	var soapFault *SOAPFault
+	if !errors.As(err, &soapFault) || soapFault.String != "out of stock" {
+		t.Errorf("got error %v, wanted the SOAP fault", err)
+	}
+}
+
+func TestClient_DecodeError(t *testing.T) {
+	broken := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"><PingResult>`
+	fault := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>out of stock</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.Header.Get("SOAPAction") {
+		case "Fault":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(fault))
+		case "Huge":
+			w.Write([]byte(broken + strings.Repeat("x", 2*maxHTTPErrorBody)))
+		default:
+			w.Write([]byte(broken))
+		}
+	}))
+	defer ts.Close()
+
+	for _, client := range []*Client{NewClient(ts.URL), NewClient(ts.URL, WithRequestGzip(), WithRequestGzipThreshold(0))} {
+		err := client.Call("Ping", &Ping{Request: &PingRequest{Message: "hi"}}, &PingResponse{})
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("got error %v, wanted a *DecodeError", err)
+		}
+		if string(decodeErr.RawBody()) != broken {
+			t.Errorf("got response body %q, wanted %q", decodeErr.Response, broken)
+		}
+		if !strings.Contains(string(decodeErr.Request), "<Message>hi</Message>") {
+			t.Errorf("got request body %q, wanted the envelope of the request", decodeErr.Request)
+		}
+		var syntaxErr *xml.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("got error %v, wanted it to wrap the decoding error", err)
+		}
+	}
+
+	client := NewClient(ts.URL)
+	err := client.Call("Huge", &Ping{}, &PingResponse{})
+	var raw interface{ RawBody() []byte }
+	if !errors.As(err, &raw) || len(raw.RawBody()) != maxHTTPErrorBody {
+		t.Errorf("got error %v, wanted the first %d bytes of the response", err, maxHTTPErrorBody)
+	}
+
+	for name, call := range map[string]func() error{
+		"Call": func() error { return client.Call("Fault", &Ping{}, &PingResponse{}) },
+		"CallRawStream": func() error {
+			return client.CallRawStream(context.Background(), "Fault", &Ping{}, ioutil.Discard)
+		},
+	} {
+		var soapFault *SOAPFault
+		if err := call(); !errors.As(err, &soapFault) || string(soapFault.RawBody()) != fault {
+			t.Errorf("%s: got error %v, wanted the SOAP fault with its response body", name, err)
+		}
+	}
+}
+
+func TestClient_VersionMismatch(t *testing.T) {
+	soap12 := `<?xml version="1.0"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+	<env:Header>
+		<env:Upgrade>
+			<env:SupportedEnvelope qname="ns1:Envelope" xmlns:ns1="http://www.w3.org/2003/05/soap-envelope"/>
+		</env:Upgrade>
+	</env:Header>
+	<env:Body>
+		<env:Fault>
+			<env:Code><env:Value>env:VersionMismatch</env:Value></env:Code>
+			<env:Reason><env:Text xml:lang="en">Version Mismatch</env:Text></env:Reason>
+		</env:Fault>
+	</env:Body>
+</env:Envelope>`
+	soap11 := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:VersionMismatch</faultcode><faultstring>wrong envelope</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/soap+xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		if r.Header.Get("SOAPAction") == "SOAP11" {
+			w.Write([]byte(soap11))
+			return
+		}
+		w.Write([]byte(soap12))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	for _, tc := range []struct {
+		action    string
+		reason    string
+		envelopes []string
+	}{
+		{"SOAP12", "Version Mismatch", []string{"http://www.w3.org/2003/05/soap-envelope"}},
+		{"SOAP11", "wrong envelope", nil},
+	} {
+		for name, call := range map[string]func() error{
+			"Call": func() error { return client.Call(tc.action, &Ping{}, &PingResponse{}) },
+			"CallRawStream": func() error {
+				return client.CallRawStream(context.Background(), tc.action, &Ping{}, ioutil.Discard)
+			},
+		} {
+			err := call()
+			var vm *VersionMismatchError
+			if !errors.As(err, &vm) {
+				t.Errorf("%s %s: got error %v, wanted a *VersionMismatchError", name, tc.action, err)
+				continue
+			}
+			if vm.Reason != tc.reason {
+				t.Errorf("%s %s: got reason %q, wanted %q", name, tc.action, vm.Reason, tc.reason)
+			}
+			if fmt.Sprint(vm.SupportedEnvelopes) != fmt.Sprint(tc.envelopes) {
+				t.Errorf("%s %s: got supported envelopes %q, wanted %q", name, tc.action, vm.SupportedEnvelopes, tc.envelopes)
+			}
+		}
+	}
+}
+
+func TestClient_CallRawStream(t *testing.T) {
+	var large bytes.Buffer
+	large.WriteString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><ListResponse>`)
+	for i := 0; large.Len() < 8<<20; i++ {
+		fmt.Fprintf(&large, "<item>%d</item>", i)
+	}
+	large.WriteString(`</ListResponse></soap:Body></soap:Envelope>`)
+
+	fault := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+		<soap:Header><Trace>abc</Trace></soap:Header>
+		<soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>out of stock</faultstring></soap:Fault></soap:Body>
+	</soap:Envelope>`
+
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantErr  string
+		wantBody bool
+	}{
+		{"large response", http.StatusOK, large.String(), "", true},
+		{"fault", http.StatusInternalServerError, fault, "out of stock", false},
+		{"bad gateway", http.StatusBadGateway, "<html>upstream down</html>", "unexpected HTTP status: 502 Bad Gateway: <html>upstream down</html>", false},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+
+		var out bytes.Buffer
+		client := NewClient(ts.URL)
+		err := client.CallRawStream(context.Background(), "List", &Ping{}, &out)
+		ts.Close()
+
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+			t.Errorf("%s: got error %v, wanted %s", test.name, err, test.wantErr)
+		}
+		if test.wantBody && out.String() != test.body {
+			t.Errorf("%s: the %d bytes copied differ from the %d bytes sent", test.name, out.Len(), len(test.body))
+		}
+		if !test.wantBody && out.Len() > 0 {
+			t.Errorf("%s: expected nothing to be copied, got %s", test.name, out.String())
+		}
+	}
+}
+
+func TestClient_CallStream(t *testing.T) {
+	const items = 200000
+	var large bytes.Buffer
+	large.WriteString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header><Trace>abc</Trace></soap:Header><soap:Body><ListResponse>`)
+	for i := 0; i < items; i++ {
+		fmt.Fprintf(&large, "<item>%d</item>", i)
+	}
+	large.WriteString(`</ListResponse></soap:Body></soap:Envelope>`)
+
+	// The header of the fault is longer than the start of the response read
+	// ahead, so that the fault is found by the decoder of the Body.
+	fault := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+		<soap:Header><Trace>` + strings.Repeat("a", maxFaultPeek) + `</Trace></soap:Header>
+		<soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>out of stock</faultstring></soap:Fault></soap:Body>
+	</soap:Envelope>`
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+		called  bool
+	}{
+		{"large response", large.String(), "", true},
+		{"fault", fault, "out of stock", false},
+		{"not an envelope", `<html>maintenance</html>`, "soap: cannot decode response: soap: unexpected element <html> in response envelope", false},
+		{"truncated", large.String()[:large.Len()/2], "XML syntax error on line 1: unexpected EOF", true},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(test.body))
+		}))
+
+		called, count := false, 0
+		client := NewClient(ts.URL)
+		err := client.CallStream(context.Background(), "List", &Ping{}, func(d *xml.Decoder) error {
+			called = true
+			for {
+				token, err := d.Token()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if se, ok := token.(xml.StartElement); ok && se.Name.Local == "item" {
+					var item int
+					if err := d.DecodeElement(&item, &se); err != nil {
+						return err
+					}
+					if item != count {
+						return fmt.Errorf("got item %d, wanted %d", item, count)
+					}
+					count++
+				}
+			}
+		})
+		ts.Close()
+
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+			t.Errorf("%s: got error %v, wanted %s", test.name, err, test.wantErr)
+		}
+		if called != test.called {
+			t.Errorf("%s: got handler called %t, wanted %t", test.name, called, test.called)
+		}
+		if test.wantErr == "" && count != items {
+			t.Errorf("%s: got %d items, wanted %d", test.name, count, items)
+		}
+	}
+}
+
+func TestClient_Call_NilAndOptionalElements(t *testing.T) {
+	type Level struct {
+		XMLName  xml.Name `xml:"http://example.com/service.xsd Level"`
+		Quantity int32    `xml:"Quantity,omitempty"`
+		Reserved *int32   `xml:"Reserved,omitempty"`
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		reserved *int32
+	}{
+		{"absent", `<Quantity>3</Quantity>`, nil},
+		{"zero", `<Quantity>3</Quantity><Reserved>0</Reserved>`, new(int32)},
+		{"nil", `<Quantity>3</Quantity><Reserved xsi:nil="true"/>`, nil},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+			<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+				<soap:Body>
+					<Level xmlns="http://example.com/service.xsd">` + test.content + `</Level>
+				</soap:Body>
+			</soap:Envelope>`))
+		}))
+
+		client := NewClient(ts.URL)
+		reply := &Level{}
+		err := client.Call("GetLevel", &Ping{}, reply)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("%s: couln't call service: %v", test.name, err)
+		}
+
+		if reply.Quantity != 3 {
+			t.Errorf("%s: got quantity %d wanted 3", test.name, reply.Quantity)
+		}
+		if test.reserved == nil && reply.Reserved != nil {
+			t.Errorf("%s: got reserved %d wanted nil", test.name, *reply.Reserved)
+		}
+		if test.reserved != nil && (reply.Reserved == nil || *reply.Reserved != *test.reserved) {
+			t.Errorf("%s: got reserved %v wanted %d", test.name, reply.Reserved, *test.reserved)
+		}
+	}
+}
+
+func TestClient_ServerCertPin(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+			<soap:Body><PingResponse xmlns="http://example.com/service.xsd"/></soap:Body>
+		</soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	fingerprint := sha256.Sum256(ts.Certificate().Raw)
+	pinned := hex.EncodeToString(fingerprint[:])
+	other := sha256.Sum256([]byte("some other certificate"))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	tests := []struct {
+		name    string
+		tlsCfg  *tls.Config
+		pin     string
+		wantErr bool
+	}{
+		{"pinned with chain validation", &tls.Config{RootCAs: roots}, pinned, false},
+		{"pinned without chain validation", &tls.Config{InsecureSkipVerify: true}, pinned, false},
+		{"colon separated pin", &tls.Config{InsecureSkipVerify: true}, strings.ToUpper(colonHex(fingerprint[:])), false},
+		{"different pin", &tls.Config{InsecureSkipVerify: true}, hex.EncodeToString(other[:]), true},
+		{"different pin with chain validation", &tls.Config{RootCAs: roots}, hex.EncodeToString(other[:]), true},
+	}
+
+	for _, test := range tests {
+		client := NewClient(ts.URL, WithTLS(test.tlsCfg), WithServerCertPin(test.pin))
+		err := client.Call("GetData", &Ping{}, &PingResponse{})
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected the certificate to be rejected", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestWithServerCertPin_Malformed(t *testing.T) {
+	fingerprint := sha256.Sum256([]byte("certificate"))
+	for _, pin := range []string{
+		"not a fingerprint",
+		hex.EncodeToString(fingerprint[:16]),
+		hex.EncodeToString(fingerprint[:]) + "00",
+		"",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic for the malformed pin %q", pin)
+				}
+			}()
+			WithServerCertPin(pin)
+		}()
+	}
+}
+
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = hex.EncodeToString(b[i : i+1])
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestClient_RetryForActions(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	attempts := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("SOAPAction")
+		attempts[action]++
+		if attempts[action] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		xml.NewEncoder(w).Encode(SOAPEnvelope{Body: SOAPBody{Content: &PingResponse{}}})
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithRetryForActions("GetStatus"))
+
+	if err := client.Call("GetStatus", &Ping{}, &PingResponse{}); err != nil {
+		t.Errorf("read action should succeed once retried, got %v", err)
+	}
+	if attempts["GetStatus"] != 2 {
+		t.Errorf("read action was attempted %d times, wanted 2", attempts["GetStatus"])
+	}
+
+	if err := client.Call("UpdateStatus", &Ping{}, &PingResponse{}); err == nil {
+		t.Error("write action should fail without being retried")
+	}
+	if attempts["UpdateStatus"] != 1 {
+		t.Errorf("write action was attempted %d times, wanted 1", attempts["UpdateStatus"])
+	}
+}
+
+func TestClient_RetryStreamedBody(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		envelope := &SOAPEnvelope{Body: SOAPBody{Content: &Ping{}}}
+		if err := xml.NewDecoder(r.Body).Decode(envelope); err != nil {
+			t.Errorf("attempt %d sent an invalid envelope: %v", attempts, err)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	ping := func(size int) io.Reader {
+		body := `<Ping xmlns="http://example.com/service.xsd"><request><Message>` +
+			strings.Repeat("x", size) + `</Message></request></Ping>`
+		// Hide the Seeker of strings.Reader, as a network stream would.
+		return struct{ io.Reader }{strings.NewReader(body)}
+	}
+
+	client := NewClient(ts.URL, WithRetryForActions("Ping"), WithMaxRetryBuffer(1024))
+
+	if err := client.CallOneWay(context.Background(), "Ping", ping(100)); err == nil {
+		t.Error("expected an error")
+	}
+	if attempts != maxRetryAttempts {
+		t.Errorf("a body within the retry buffer was attempted %d times, wanted %d", attempts, maxRetryAttempts)
+	}
+
+	attempts = 0
+	if err := client.CallOneWay(context.Background(), "Ping", ping(4096)); err == nil {
+		t.Error("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("a body above the retry buffer was attempted %d times, wanted 1", attempts)
+	}
+
+	attempts = 0
+	seekable := strings.NewReader(`<Ping xmlns="http://example.com/service.xsd"><request><Message>` +
+		strings.Repeat("x", 4096) + `</Message></request></Ping>`)
+	if err := client.CallOneWay(context.Background(), "Ping", seekable); err == nil {
+		t.Error("expected an error")
+	}
+	if attempts != maxRetryAttempts {
+		t.Errorf("a seekable body was attempted %d times, wanted %d", attempts, maxRetryAttempts)
+	}
+}
+
+func TestClient_ContextWithHeaders(t *testing.T) {
+	type Session struct {
+		XMLName xml.Name `xml:"http://example.com/service.xsd Session"`
+		Token   string   `xml:"token"`
+	}
+	type Credentials struct {
+		XMLName xml.Name `xml:"http://example.com/service.xsd Credentials"`
+		Login   string   `xml:"Login"`
+	}
+
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		xml.NewEncoder(w).Encode(SOAPEnvelope{Body: SOAPBody{Content: &PingResponse{}}})
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.AddHeader(&Credentials{Login: "login"})
+
+	ctx := ContextWithHeaders(context.Background(), &Session{Token: "abc"})
+	if err := client.CallContext(ctx, "GetData", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call("GetData", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(bodies[0], "<Login>login</Login>") || !strings.Contains(bodies[0], "<token>abc</token>") {
+		t.Errorf("first call should send the client and context headers, got %s", bodies[0])
+	}
+	if strings.Contains(bodies[1], "<token>abc</token>") {
+		t.Errorf("context headers should not be kept for later calls, got %s", bodies[1])
+	}
+}
+
+func TestClient_CallTo(t *testing.T) {
+	type Session struct {
+		XMLName xml.Name `xml:"http://example.com/service.xsd Session"`
+		Token   string   `xml:"token"`
+	}
+
+	var hits []string
+	serve := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			hits = append(hits, name+" "+string(body))
+			xml.NewEncoder(w).Encode(SOAPEnvelope{Body: SOAPBody{Content: &PingResponse{}}})
+		}))
+	}
+	active, standby := serve("active"), serve("standby")
+	defer active.Close()
+	defer standby.Close()
+
+	client := NewClient(active.URL)
+	if err := client.CallTo(standby.URL, "GetData", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithEndpoint(ContextWithHeaders(context.Background(), &Session{Token: "abc"}), standby.URL)
+	if err := client.CallContext(ctx, "GetData", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call("GetData", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 3 {
+		t.Fatalf("got %d requests, wanted 3", len(hits))
+	}
+	for i, want := range []string{"standby", "standby", "active"} {
+		if !strings.HasPrefix(hits[i], want+" ") {
+			t.Errorf("call %d was sent to %s, wanted %s", i, strings.Fields(hits[i])[0], want)
+		}
+	}
+	if !strings.Contains(hits[1], "<token>abc</token>") {
+		t.Errorf("the call to the endpoint of the context should send its headers, got %s", hits[1])
+	}
+}
+
 func TestClient_Send_Correct_Headers(t *testing.T) {
 	tests := []struct {
 		action          string
@@ -104,50 +720,757 @@ func TestClient_Send_Correct_Headers(t *testing.T) {
 		},
 	}
 
-	var gotHeaders http.Header
+	var gotHeaders http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header
+	}))
+	defer ts.Close()
+
+	for _, test := range tests {
+		client := NewClient(ts.URL, WithHTTPHeaders(test.reqHeaders))
+		req := struct{}{}
+		reply := struct{}{}
+		client.Call(test.action, req, reply)
+
+		for k, v := range test.expectedHeaders {
+			h := gotHeaders.Get(k)
+			if h != v {
+				t.Errorf("got %s wanted %s", h, v)
+			}
+		}
+	}
+}
+
+func TestClient_RecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<PingResponse xmlns="http://example.com/service.xsd"><PingResult><Message>pong</Message></PingResult></PingResponse>` +
+			`</soap:Body></soap:Envelope>`))
+	}))
+
+	ping := &Ping{Request: &PingRequest{Message: "ping"}}
+	recorder := NewClient(ts.URL, WithRecorder(dir))
+	recorded := &PingResponse{}
+	if err := recorder.Call("GetData", ping, recorded); err != nil {
+		t.Fatalf("couldn't record the call: %v", err)
+	}
+	ts.Close()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d recordings, wanted 1", len(files))
+	}
+
+	replayer := NewClient(ts.URL, WithReplayer(dir))
+	replayed := &PingResponse{}
+	if err := replayer.Call("GetData", ping, replayed); err != nil {
+		t.Fatalf("couldn't replay the call: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls to the service, wanted 1", calls)
+	}
+	if replayed.PingResult == nil || replayed.PingResult.Message != "pong" {
+		t.Errorf("got replayed response %+v, wanted the recorded one %+v", replayed.PingResult, recorded.PingResult)
+	}
+
+	for _, test := range []struct {
+		action  string
+		request interface{}
+	}{
+		{"GetData", &Ping{Request: &PingRequest{Message: "other"}}},
+		{"SetData", ping},
+	} {
+		err := replayer.Call(test.action, test.request, &PingResponse{})
+		if !errors.Is(err, ErrNotRecorded) {
+			t.Errorf("%s: got error %v, wanted ErrNotRecorded", test.action, err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var header string
+	ts := httptest.NewServer(NewHandler(
+		ServerOperation{
+			Action:  "Ping",
+			Element: xml.Name{Space: "http://example.com/service.xsd", Local: "Ping"},
+			Request: func() interface{} { return new(Ping) },
+			Serve: func(ctx context.Context, request interface{}) (interface{}, error) {
+				header = string(RequestHeader(ctx))
+				message := request.(*Ping).Request.Message
+				if message == "fail" {
+					return nil, fmt.Errorf("cannot ping <%s>", message)
+				}
+				if message == "drop" {
+					return nil, nil
+				}
+				return &PingResponse{PingResult: &PingReply{Message: "pong " + message}}, nil
+			},
+		},
+		ServerOperation{
+			Action:  "Notify",
+			Element: xml.Name{Space: "http://example.com/service.xsd", Local: "Notify"},
+			Serve: func(ctx context.Context, request interface{}) (interface{}, error) {
+				return nil, nil
+			},
+			OneWay: true,
+		},
+	))
+	defer ts.Close()
+
+	type Trace struct {
+		XMLName xml.Name `xml:"http://example.com/trace Trace"`
+		ID      string   `xml:"id"`
+	}
+	client := NewClient(ts.URL)
+	client.AddHeader(&Trace{ID: "abc"})
+
+	reply := &PingResponse{}
+	// Without a matching action, requests are dispatched by their element.
+	if err := client.Call("", &Ping{Request: &PingRequest{Message: "hello"}}, reply); err != nil {
+		t.Fatalf("couldn't call the handler: %v", err)
+	}
+	if reply.PingResult == nil || reply.PingResult.Message != "pong hello" {
+		t.Errorf("got reply %+v, wanted pong hello", reply.PingResult)
+	}
+	if !strings.Contains(header, "<id>abc</id>") {
+		t.Errorf("got request header %q, wanted the Trace header", header)
+	}
+
+	err := client.Call("Ping", &Ping{Request: &PingRequest{Message: "fail"}}, &PingResponse{})
+	fault, ok := err.(*SOAPFault)
+	if !ok || fault.Code != "soap:Server" || fault.String != "cannot ping <fail>" {
+		t.Errorf("got error %#v, wanted a soap:Server fault", err)
+	}
+
+	// A request/response operation serving no response gets a fault rather
+	// than an empty 202 response.
+	err = client.Call("Ping", &Ping{Request: &PingRequest{Message: "drop"}}, &PingResponse{})
+	if fault, ok := err.(*SOAPFault); !ok || fault.Code != "soap:Server" || fault.String != "no response to Ping" {
+		t.Errorf("got error %#v, wanted a soap:Server fault", err)
+	}
+
+	err = client.Call("Unknown", &PingRequest{Message: "hello"}, &PingResponse{})
+	if fault, ok := err.(*SOAPFault); !ok || fault.Code != "soap:Client" {
+		t.Errorf("got error %#v, wanted a soap:Client fault", err)
+	}
+
+	if err := client.CallOneWay(context.Background(), "Notify", &struct {
+		XMLName xml.Name `xml:"http://example.com/service.xsd Notify"`
+	}{}); err != nil {
+		t.Errorf("couldn't call the one-way operation: %v", err)
+	}
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d for a GET request, wanted %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestClient_CallHooks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") == "Fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+				`<soap:Fault><faultcode>soap:Server</faultcode><faultstring>broken</faultstring></soap:Fault></soap:Body></soap:Envelope>`))
+			return
+		}
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<PingResponse xmlns="http://example.com/service.xsd"><PingResult><Message>pong</Message></PingResult></PingResponse>` +
+			`</soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	type key struct{}
+	var events []string
+	client := NewClient(ts.URL,
+		WithPreCallHook(func(ctx context.Context, action string, req interface{}) {
+			events = append(events, fmt.Sprintf("pre %v %s %s", ctx.Value(key{}), action, req.(*Ping).Request.Message))
+		}),
+		WithPostCallHook(func(ctx context.Context, action string, resp interface{}, err error) {
+			message := ""
+			if resp, ok := resp.(*PingResponse); ok && resp.PingResult != nil {
+				message = resp.PingResult.Message
+			}
+			fault, _ := err.(*SOAPFault)
+			events = append(events, fmt.Sprintf("post %v %s %q %v", ctx.Value(key{}), action, message, fault))
+		}),
+	)
+
+	ctx := context.WithValue(context.Background(), key{}, "traced")
+	if err := client.CallContext(ctx, "Ping", &Ping{Request: &PingRequest{Message: "ping"}}, &PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CallContext(ctx, "Fail", &Ping{Request: &PingRequest{Message: "boom"}}, &PingResponse{}); err == nil {
+		t.Fatal("expected the fault to be returned")
+	}
+	if err := client.CallOneWay(ctx, "Notify", &Ping{Request: &PingRequest{Message: "note"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`pre traced Ping ping`,
+		`post traced Ping "pong" <nil>`,
+		`pre traced Fail boom`,
+		`post traced Fail "" broken`,
+		`pre traced Notify note`,
+		`post traced Notify "" <nil>`,
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got hook events\n%s\nwanted\n%s", strings.Join(events, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestClient_ResponseCharsets(t *testing.T) {
+	// "Mañana, Zürich" and a windows-1252 euro sign, encoded in latin1.
+	latin1 := []byte("Ma\xf1ana, Z\xfcrich \x80")
+	envelope := func(decl string) []byte {
+		return []byte(decl + `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<PingResponse xmlns="http://example.com/service.xsd"><PingResult><Message>` + string(latin1) + `</Message></PingResult></PingResponse>` +
+			`</soap:Body></soap:Envelope>`)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{"declaration", "text/xml", envelope(`<?xml version="1.0" encoding="ISO-8859-1"?>`)},
+		{"content type", `text/xml; charset="iso-8859-1"`, envelope("")},
+		{"both", "text/xml; charset=windows-1252", envelope(`<?xml version="1.0" encoding="ISO-8859-1"?>`)},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.Write(test.body)
+		}))
+
+		reply := &PingResponse{}
+		if err := NewClient(ts.URL).Call("Ping", &Ping{}, reply); err != nil {
+			t.Errorf("%s: couldn't decode the response: %v", test.name, err)
+		} else if reply.PingResult == nil || reply.PingResult.Message != "Mañana, Zürich €" {
+			t.Errorf("%s: got %+v, wanted Mañana, Zürich €", test.name, reply.PingResult)
+		}
+		ts.Close()
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=koi8-r")
+		w.Write(envelope(""))
+	}))
+	defer ts.Close()
+	if err := NewClient(ts.URL).Call("Ping", &Ping{}, &PingResponse{}); err == nil || !strings.Contains(err.Error(), "koi8-r") {
+		t.Errorf("got error %v, wanted an unsupported charset error", err)
+	}
+}
+
+func TestClient_MultiRef(t *testing.T) {
+	type Address struct {
+		City string `xml:"city"`
+	}
+	type User struct {
+		Name    string   `xml:"name"`
+		Address *Address `xml:"address"`
+	}
+	type GetUserResponse struct {
+		XMLName xml.Name `xml:"urn:users getUserResponse"`
+		Return  *User    `xml:"getUserReturn"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+			<soapenv:Body>
+				<ns1:getUserResponse soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" xmlns:ns1="urn:users">
+					<getUserReturn href="#id0"/>
+				</ns1:getUserResponse>
+				<multiRef id="id0" soapenc:root="0" soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" xsi:type="ns2:User" xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:ns2="urn:users">
+					<name xsi:type="xsd:string">Ada</name>
+					<address href="#id1"/>
+				</multiRef>
+				<multiRef id="id1" soapenc:root="0" xsi:type="ns3:Address" xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:ns3="urn:users">
+					<city xsi:type="xsd:string">London</city>
+				</multiRef>
+			</soapenv:Body>
+		</soapenv:Envelope>`))
+	}))
+	defer ts.Close()
+
+	response := &GetUserResponse{}
+	if err := NewClient(ts.URL).Call("getUser", &Ping{}, response); err != nil {
+		t.Fatalf("couldn't call service: %v", err)
+	}
+	if response.Return == nil || response.Return.Name != "Ada" {
+		t.Fatalf("got return %+v, wanted the user of the multiRef", response.Return)
+	}
+	if response.Return.Address == nil || response.Return.Address.City != "London" {
+		t.Errorf("got address %+v, wanted the address of the nested multiRef", response.Return.Address)
+	}
+}
+
+func TestClient_Proxy(t *testing.T) {
+	var host string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.URL.Host
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"><PingResult><Message>proxied</Message></PingResult></PingResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient("http://service.invalid/ping", WithProxy(proxyURL))
+	reply := &PingResponse{}
+	if err := client.Call("Ping", &Ping{Request: &PingRequest{Message: "hi"}}, reply); err != nil {
+		t.Fatalf("couln't call service: %v", err)
+	}
+	if host != "service.invalid" {
+		t.Errorf("got request for host %q through the proxy, wanted service.invalid", host)
+	}
+	if reply.PingResult == nil || reply.PingResult.Message != "proxied" {
+		t.Errorf("got %+v, wanted the proxied response", reply.PingResult)
+	}
+}
+
+func TestClient_BearerToken(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	var authorizations []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"></PingResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	authorizations = nil
+	if err := NewClient(ts.URL, WithBearerToken("fresh")).Call("Ping", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatalf("couln't call service: %v", err)
+	}
+	if len(authorizations) != 1 || authorizations[0] != "Bearer fresh" {
+		t.Errorf("got Authorization headers %q, wanted the bearer token", authorizations)
+	}
+
+	tokens := []string{"expired", "fresh"}
+	client := NewClient(ts.URL, WithTokenSource(func(ctx context.Context) (string, error) {
+		token := tokens[0]
+		tokens = tokens[1:]
+		return token, nil
+	}))
+	authorizations = nil
+	if err := client.Call("Ping", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatalf("couln't call service: %v", err)
+	}
+	if len(authorizations) != 2 || authorizations[0] != "Bearer expired" || authorizations[1] != "Bearer fresh" {
+		t.Errorf("got Authorization headers %q, wanted a retry with the refreshed token", authorizations)
+	}
+
+	tokens = []string{"expired", "revoked"}
+	authorizations = nil
+	var httpErr *HTTPError
+	if err := client.Call("Ping", &Ping{}, &PingResponse{}); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got error %v, wanted the 401 of the retry", err)
+	}
+	if len(authorizations) != 2 {
+		t.Errorf("got %d attempts, wanted a single retry", len(authorizations))
+	}
+
+	errExpired := errors.New("refresh token expired")
+	for _, source := range []TokenSource{
+		func(ctx context.Context) (string, error) { return "", errExpired },
+		func(ctx context.Context) (string, error) { return "", nil },
+	} {
+		authorizations = nil
+		err := NewClient(ts.URL, WithTokenSource(source)).Call("Ping", &Ping{}, &PingResponse{})
+		if err == nil || !strings.HasPrefix(err.Error(), "soap: token source") {
+			t.Errorf("got error %v, wanted the token source error", err)
+		}
+		if len(authorizations) != 0 {
+			t.Errorf("got %d requests, wanted none without a token", len(authorizations))
+		}
+	}
+	if err := NewClient(ts.URL, WithTokenSource(func(ctx context.Context) (string, error) { return "", errExpired })).Call("Ping", &Ping{}, &PingResponse{}); !errors.Is(err, errExpired) {
+		t.Errorf("got error %v, wanted it to wrap the token source error", err)
+	}
+}
+
+func TestClient_RequestGzip(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantGzip bool
+	}{
+		{name: "below threshold", opts: []Option{WithRequestGzip()}},
+		{name: "above threshold", opts: []Option{WithRequestGzip(), WithRequestGzipThreshold(64)}, wantGzip: true},
+		{name: "mtom", opts: []Option{WithRequestGzip(), WithRequestGzipThreshold(0), WithMTOM()}, wantGzip: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var encoding string
+			var body []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding = r.Header.Get("Content-Encoding")
+				var reader io.Reader = r.Body
+				if encoding == "gzip" {
+					zr, err := gzip.NewReader(r.Body)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					reader = zr
+				}
+				body, _ = ioutil.ReadAll(reader)
+				w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"><PingResult><Message>pong</Message></PingResult></PingResponse></soap:Body></soap:Envelope>`))
+			}))
+			defer ts.Close()
+
+			client := NewClient(ts.URL, test.opts...)
+			reply := &PingResponse{}
+			if err := client.Call("Ping", &Ping{Request: &PingRequest{Message: "hi"}}, reply); err != nil {
+				t.Fatalf("couln't call service: %v", err)
+			}
+			if got := encoding == "gzip"; got != test.wantGzip {
+				t.Errorf("got Content-Encoding %q, wanted gzip: %v", encoding, test.wantGzip)
+			}
+			if !bytes.Contains(body, []byte("<Message>hi</Message>")) {
+				t.Errorf("got request body %s, wanted the Ping envelope", body)
+			}
+			if reply.PingResult == nil || reply.PingResult.Message != "pong" {
+				t.Errorf("got %+v, wanted the pong response", reply.PingResult)
+			}
+		})
+	}
+}
+
+func TestClient_NamespacePrefixes(t *testing.T) {
+	var body []byte
+	var envelope struct {
+		Ping *Ping `xml:"Body>Ping"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		xml.Unmarshal(body, &envelope)
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"/></soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithNamespacePrefixes(map[string]string{
+		"soapenv": "http://schemas.xmlsoap.org/soap/envelope/",
+		"tns":     "http://example.com/service.xsd",
+	}))
+	client.AddHeader(NewWSSSecurityHeader("user", "pass", "UsernameToken-1", ""))
+	if err := client.Call("Ping", &Ping{Request: &PingRequest{Message: "hi"}}, &PingResponse{}); err != nil {
+		t.Fatalf("couln't call service: %v", err)
+	}
+
+	expected := `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:tns="http://example.com/service.xsd">` +
+		`<soapenv:Header><wsse:Security xmlns:wsse="` + WssNsWSSE + `">`
+	if !strings.HasPrefix(string(body), expected) {
+		t.Errorf("got %s, expected it to start with %s", body, expected)
+	}
+	expected = `<soapenv:Body><tns:Ping><tns:request><tns:Message>hi</tns:Message></tns:request></tns:Ping></soapenv:Body></soapenv:Envelope>`
+	if !strings.HasSuffix(string(body), expected) {
+		t.Errorf("got %s, expected it to end with %s", body, expected)
+	}
+	if envelope.Ping == nil || envelope.Ping.Request == nil || envelope.Ping.Request.Message != "hi" {
+		t.Errorf("the server decoded %+v from %s", envelope.Ping, body)
+	}
+}
+
+func TestClient_MTOM(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range r.Header {
+			w.Header().Set(k, v[0])
+		}
+		bodyBuf, _ := ioutil.ReadAll(r.Body)
+		w.Write(bodyBuf)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithMTOM())
+	req := &PingRequest{Attachment: NewBinary([]byte("Attached data")).SetContentType("text/plain")}
+	reply := &PingRequest{}
+	if err := client.Call("GetData", req, reply); err != nil {
+		t.Fatalf("couln't call service: %v", err)
+	}
+
+	if !bytes.Equal(reply.Attachment.Bytes(), req.Attachment.Bytes()) {
+		t.Errorf("got %s wanted %s", reply.Attachment.Bytes(), req.Attachment.Bytes())
+	}
+
+	if reply.Attachment.ContentType() != req.Attachment.ContentType() {
+		t.Errorf("got %s wanted %s", reply.Attachment.Bytes(), req.Attachment.ContentType())
+	}
+}
+
+func TestClient_MTOMContentIDs(t *testing.T) {
+	type Photos struct {
+		Photo     *Binary `xml:"Photo"`
+		Thumbnail *Binary `xml:"Thumbnail"`
+	}
+
+	// The attachments come before the root part, in another order than they
+	// are referenced, with Content-IDs in several forms.
+	body := "--MIMEBoundary\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-ID: thumb@example.com\r\n\r\n" +
+		"small\r\n" +
+		"--MIMEBoundary\r\n" +
+		"Content-Type: image/jpeg\r\n" +
+		"Content-ID: <photo@example.com>\r\n\r\n" +
+		"large\r\n" +
+		"--MIMEBoundary\r\n" +
+		"Content-Type: application/xop+xml; charset=UTF-8; type=\"text/xml\"\r\n" +
+		"Content-ID: <root@example.com>\r\n\r\n" +
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xop="http://www.w3.org/2004/08/xop/include"><soap:Body><Photos>` +
+		`<Photo><xop:Include href="cid:photo@example.com"/></Photo>` +
+		`<Thumbnail><xop:Include href="CID:thumb%40example.com"/></Thumbnail>` +
+		`</Photos></soap:Body></soap:Envelope>` + "\r\n" +
+		"--MIMEBoundary--\r\n"
+
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		gotHeaders = r.Header
+		w.Header().Set("Content-Type", `multipart/related; type="application/xop+xml"; start-info="application/soap+xml"; boundary=MIMEBoundary`)
+		w.Write([]byte(body))
 	}))
 	defer ts.Close()
 
-	for _, test := range tests {
-		client := NewClient(ts.URL, WithHTTPHeaders(test.reqHeaders))
-		req := struct{}{}
-		reply := struct{}{}
-		client.Call(test.action, req, reply)
+	reply := &Photos{}
+	if err := NewClient(ts.URL).Call("GetPhotos", &Ping{}, reply); err != nil {
+		t.Fatalf("couldn't call service: %v", err)
+	}
 
-		for k, v := range test.expectedHeaders {
-			h := gotHeaders.Get(k)
-			if h != v {
-				t.Errorf("got %s wanted %s", h, v)
-			}
-		}
+	if got := string(reply.Photo.Bytes()); got != "large" || reply.Photo.ContentType() != "image/jpeg" {
+		t.Errorf("got photo %q of type %s, wanted the image/jpeg part", got, reply.Photo.ContentType())
+	}
+	if got := string(reply.Thumbnail.Bytes()); got != "small" || reply.Thumbnail.ContentType() != "image/png" {
+		t.Errorf("got thumbnail %q of type %s, wanted the image/png part", got, reply.Thumbnail.ContentType())
 	}
 }
 
-func TestClient_MTOM(t *testing.T) {
+func TestBinary_CloneEqual(t *testing.T) {
+	b := NewBinary([]byte("Attached data")).SetContentType("text/plain")
+	clone := b.Clone()
+	if !clone.Equal(b) {
+		t.Errorf("got clone %s, wanted it equal to %s", clone.Bytes(), b.Bytes())
+	}
+
+	clone.Bytes()[0] = 'a'
+	if string(b.Bytes()) != "Attached data" || clone.Equal(b) {
+		t.Errorf("got %s after changing the clone, wanted the content not to be shared", b.Bytes())
+	}
+	if (*Binary)(nil).Clone() != nil || !(*Binary)(nil).Equal(nil) || b.Equal(nil) {
+		t.Error("expected nil binaries to clone to nil and to be equal to nil only")
+	}
+}
+
+func TestClient_MaxResponseSize(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		for k, v := range r.Header {
 			w.Header().Set(k, v[0])
 		}
 		bodyBuf, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("SOAPAction") == "Chunked" {
+			// Flushing leaves the response without a Content-Length.
+			w.(http.Flusher).Flush()
+		}
 		w.Write(bodyBuf)
 	}))
 	defer ts.Close()
 
-	client := NewClient(ts.URL, WithMTOM())
+	attachment := bytes.Repeat([]byte("x"), 64<<10)
+	for _, action := range []string{"GetData", "Chunked"} {
+		client := NewClient(ts.URL, WithMTOM(), WithMaxResponseSize(32<<10))
+		req := &PingRequest{Attachment: NewBinary(attachment)}
+		err := client.Call(action, req, &PingRequest{})
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("%s: got error %v, wanted ErrResponseTooLarge", action, err)
+		}
+
+		client = NewClient(ts.URL, WithMTOM(), WithMaxResponseSize(128<<10))
+		reply := &PingRequest{}
+		if err := client.Call(action, req, reply); err != nil {
+			t.Fatalf("%s: couldn't call service: %v", action, err)
+		}
+		if !bytes.Equal(reply.Attachment.Bytes(), attachment) {
+			t.Errorf("%s: got an attachment of %d bytes, wanted %d", action, len(reply.Attachment.Bytes()), len(attachment))
+		}
+	}
+}
+func TestClient_MTOMContentType(t *testing.T) {
+	var contentType, rootType string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			if part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart(); err == nil {
+				rootType = part.Header.Get("Content-Type")
+			}
+		}
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingRequest/></soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithMTOM(), WithMTOMContentType(`application/xop+xml; charset=UTF-8`, "text/xml"))
 	req := &PingRequest{Attachment: NewBinary([]byte("Attached data")).SetContentType("text/plain")}
-	reply := &PingRequest{}
-	if err := client.Call("GetData", req, reply); err != nil {
+	if err := client.Call("GetData", req, &PingRequest{}); err != nil {
 		t.Fatalf("couln't call service: %v", err)
 	}
 
-	if !bytes.Equal(reply.Attachment.Bytes(), req.Attachment.Bytes()) {
-		t.Errorf("got %s wanted %s", reply.Attachment.Bytes(), req.Attachment.Bytes())
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("invalid Content-Type %q: %v", contentType, err)
+	}
+	if mediaType != "multipart/related" {
+		t.Errorf("got media type %s wanted multipart/related", mediaType)
 	}
+	if params["type"] != "application/xop+xml; charset=UTF-8" {
+		t.Errorf("got type %q wanted %q", params["type"], "application/xop+xml; charset=UTF-8")
+	}
+	if params["start-info"] != "text/xml" {
+		t.Errorf("got start-info %q wanted %q", params["start-info"], "text/xml")
+	}
+	if rootType != params["type"] {
+		t.Errorf("got root part Content-Type %q wanted %q", rootType, params["type"])
+	}
+}
 
-	if reply.Attachment.ContentType() != req.Attachment.ContentType() {
-		t.Errorf("got %s wanted %s", reply.Attachment.Bytes(), req.Attachment.ContentType())
+func TestMTOMEncoder_PartHeaders(t *testing.T) {
+	content := bytes.Repeat([]byte("Attached data "), 10)
+	for _, tc := range []struct {
+		binary   *Binary
+		encoding string
+		id       string
+	}{
+		{NewBinary(content), "binary", ""},
+		{NewBinary(content).SetTransferEncoding("base64").SetContentID("report@example.com").SetContentDisposition(`attachment; filename="report.txt"`), "base64", "report@example.com"},
+	} {
+		buf := new(bytes.Buffer)
+		encoder := newMtomEncoder(buf, "application/xop+xml", nil)
+		if err := encoder.Encode(&PingRequest{Attachment: tc.binary}); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := multipart.NewReader(buf, encoder.Boundary())
+		root, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		envelope, _ := ioutil.ReadAll(root)
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(part)
+
+		if got := part.Header.Get("Content-Transfer-Encoding"); got != tc.encoding {
+			t.Errorf("got Content-Transfer-Encoding %q, wanted %q", got, tc.encoding)
+		}
+		if got := part.Header.Get("Content-Disposition"); got != tc.binary.ContentDisposition() {
+			t.Errorf("got Content-Disposition %q, wanted %q", got, tc.binary.ContentDisposition())
+		}
+		if tc.id != "" && (part.Header.Get("Content-ID") != "<"+tc.id+">" || tc.binary.ContentID() != tc.id) {
+			t.Errorf("got Content-ID %q, wanted <%s>", part.Header.Get("Content-ID"), tc.id)
+		}
+		if !bytes.Contains(envelope, []byte(`href="cid:`+tc.binary.ContentID()+`"`)) {
+			t.Errorf("the envelope %s should include the part %s", envelope, tc.binary.ContentID())
+		}
+		if tc.encoding == "base64" {
+			if data, err = base64.StdEncoding.DecodeString(strings.Replace(string(data), "\r\n", "", -1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("got part content %q, wanted %q", data, content)
+		}
+	}
+}
+
+func TestEncodedArray_Unmarshal(t *testing.T) {
+	type ArrayOfString struct {
+		*EncodedArray
+	}
+	type Document struct {
+		Tags *ArrayOfString `xml:"tags"`
+	}
+
+	data := `<Document xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+		<tags soapenc:arrayType="xsd:string[2]">
+			<item xsi:type="xsd:string">red</item>
+			<item xsi:type="xsd:string">blue</item>
+		</tags>
+	</Document>`
+
+	doc := new(Document)
+	if err := xml.Unmarshal([]byte(data), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Tags.ArrayType != "xsd:string[2]" {
+		t.Errorf("got array type %s wanted xsd:string[2]", doc.Tags.ArrayType)
+	}
+	if len(doc.Tags.Items) != 2 || doc.Tags.Items[0].Content != "red" || doc.Tags.Items[1].Content != "blue" {
+		t.Fatalf("got items %+v wanted red and blue", doc.Tags.Items)
+	}
+	if doc.Tags.Items[0].Type != "xsd:string" {
+		t.Errorf("got item type %s wanted xsd:string", doc.Tags.Items[0].Type)
+	}
+}
+
+func TestAnyXML(t *testing.T) {
+	type Document struct {
+		XMLName xml.Name `xml:"urn:doc Document"`
+		Items   []AnyXML `xml:",any"`
+	}
+
+	data := `<Document xmlns="urn:doc"><x:trace xmlns:x="urn:trace" x:level="2" id="t1"><x:span>a</x:span></x:trace><note>plain</note></Document>`
+	doc := new(Document)
+	if err := xml.Unmarshal([]byte(data), doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Items) != 2 || doc.Items[0].XMLName != (xml.Name{Space: "urn:trace", Local: "trace"}) || string(doc.Items[0].InnerXML) != "<x:span>a</x:span>" {
+		t.Fatalf("got items %+v", doc.Items)
+	}
+
+	out, err := xml.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<Document xmlns="urn:doc"><trace xmlns="urn:trace" xmlns:x="urn:trace" x:level="2" id="t1"><x:span>a</x:span></trace><note xmlns="urn:doc">plain</note></Document>`
+	if string(out) != want {
+		t.Errorf("got %s, wanted %s", out, want)
+	}
+
+	var trace struct {
+		Level string `xml:"urn:trace level,attr"`
+		Span  string `xml:"urn:trace span"`
+	}
+	if err := doc.Items[0].Unmarshal(&trace); err != nil {
+		t.Fatal(err)
+	}
+	if trace.Level != "2" || trace.Span != "a" {
+		t.Errorf("got %+v, wanted the decoded trace", trace)
 	}
 }
 
@@ -168,37 +1491,66 @@ func TestGetEnvelope(t *testing.T) {
 		SecondItem []Item
 	}
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
-	SOAPClient := NewClient(ts.URL)
-	SOAPClient.AddHeader(Credentials{
-		Login:    "login_value",
-		Password: "password_value",
-	})
-	body := MessageRequest{
-		FirstItem: Item{
-			Type:  "item_1",
-			Value: "value_1",
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{
+			name: "default namespaces",
+			expected: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+			<Header xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+				<Credentials xmlns="http://www.namespace.ninja">
+					<Login>login_value</Login>
+					<Password>password_value</Password>
+				</Credentials>
+			</Header>
+			<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+				<MessageRequest xmlns="http://www.midoco.de/order">
+					<FirstItem type="item_1">
+						<Value>value_1</Value>
+					</FirstItem>
+					<SecondItem type="item_2_1">
+						<Value>value_2_1</Value>
+					</SecondItem>
+					<SecondItem type="item_2_2">
+						<Value>value_2_2</Value>
+					</SecondItem>
+				</MessageRequest>
+			</Body>
+		</Envelope>`,
 		},
-		SecondItem: []Item{
-			{
-				Type:  "item_2_1",
-				Value: "value_2_1",
-			},
-			{
-				Type:  "item_2_2",
-				Value: "value_2_2",
-			},
+		{
+			name: "prefixed envelope",
+			opts: []Option{WithEnvelopePrefix("soap")},
+			expected: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+			<soap:Header>
+				<Credentials xmlns="http://www.namespace.ninja">
+					<Login>login_value</Login>
+					<Password>password_value</Password>
+				</Credentials>
+			</soap:Header>
+			<soap:Body>
+				<MessageRequest xmlns="http://www.midoco.de/order">
+					<FirstItem type="item_1">
+						<Value>value_1</Value>
+					</FirstItem>
+					<SecondItem type="item_2_1">
+						<Value>value_2_1</Value>
+					</SecondItem>
+					<SecondItem type="item_2_2">
+						<Value>value_2_2</Value>
+					</SecondItem>
+				</MessageRequest>
+			</soap:Body>
+		</soap:Envelope>`,
 		},
-	}
-	envelope, err := SOAPClient.GetRequest(body)
-	if err != nil {
-		t.Errorf("Something went wrong trying to get the request (GetRequest): %v", err)
-	} else {
-		output, err := xml.MarshalIndent(envelope, "  ", "    ")
-		if err != nil {
-			t.Errorf("Something went wrong trying to marshal request: %v", err)
-		}
-
-		expected := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+		{
+			name: "schema namespaces",
+			opts: []Option{WithSchemaNamespaces()},
+			expected: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema">
 			<Header xmlns="http://schemas.xmlsoap.org/soap/envelope/">
 				<Credentials xmlns="http://www.namespace.ninja">
 					<Login>login_value</Login>
@@ -218,17 +1570,300 @@ func TestGetEnvelope(t *testing.T) {
 					</SecondItem>
 				</MessageRequest>
 			</Body>
-		</Envelope>`
-		if !compareXMLs(expected, string(output)) {
-			a, _ := mxj.BeautifyXml([]byte(expected), "", "  ")
+		</Envelope>`,
+		},
+		{
+			name: "prefixed envelope with schema namespaces",
+			opts: []Option{WithEnvelopePrefix("soap"), WithSchemaNamespaces()},
+			expected: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+			<soap:Header>
+				<Credentials xmlns="http://www.namespace.ninja">
+					<Login>login_value</Login>
+					<Password>password_value</Password>
+				</Credentials>
+			</soap:Header>
+			<soap:Body>
+				<MessageRequest xmlns="http://www.midoco.de/order">
+					<FirstItem type="item_1">
+						<Value>value_1</Value>
+					</FirstItem>
+					<SecondItem type="item_2_1">
+						<Value>value_2_1</Value>
+					</SecondItem>
+					<SecondItem type="item_2_2">
+						<Value>value_2_2</Value>
+					</SecondItem>
+				</MessageRequest>
+			</soap:Body>
+		</soap:Envelope>`,
+		},
+	}
+
+	for _, test := range tests {
+		SOAPClient := NewClient(ts.URL, test.opts...)
+		SOAPClient.AddHeader(Credentials{
+			Login:    "login_value",
+			Password: "password_value",
+		})
+		body := MessageRequest{
+			FirstItem: Item{
+				Type:  "item_1",
+				Value: "value_1",
+			},
+			SecondItem: []Item{
+				{
+					Type:  "item_2_1",
+					Value: "value_2_1",
+				},
+				{
+					Type:  "item_2_2",
+					Value: "value_2_2",
+				},
+			},
+		}
+		envelope, err := SOAPClient.GetRequest(body)
+		if err != nil {
+			t.Errorf("%s: Something went wrong trying to get the request (GetRequest): %v", test.name, err)
+			continue
+		}
+
+		output, err := xml.MarshalIndent(envelope, "  ", "    ")
+		if err != nil {
+			t.Errorf("%s: Something went wrong trying to marshal request: %v", test.name, err)
+		}
+
+		if !compareXMLs(test.expected, string(output)) {
+			a, _ := mxj.BeautifyXml([]byte(test.expected), "", "  ")
 			b, _ := mxj.BeautifyXml(output, "", "  ")
-			aStr := string(a)
-			bStr := string(b)
-			// ioutil.WriteFile(tt.outputXMLFile, []byte(prettifyXML(midocoReqBody)), os.ModePerm)
-			t.Errorf("Output differ from a golden file: \n%v", diff.LineDiff(aStr, bStr))
+			t.Errorf("%s: Output differ from a golden file: \n%v", test.name, diff.LineDiff(string(a), string(b)))
+		}
+	}
+}
+
+func TestClient_PreviewHeaders(t *testing.T) {
+	client := NewClient("http://localhost")
+
+	preview, err := client.PreviewHeaders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview != nil {
+		t.Errorf("expected no preview without headers, got %s", preview)
+	}
+
+	client.AddHeader(NewWSSSecurityHeader("user", "pass", "UsernameToken-1", "1"))
+
+	preview, err = client.PreviewHeaders()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := string(preview)
+	for _, expected := range []string{
+		`<Header xmlns="http://schemas.xmlsoap.org/soap/envelope/">`,
+		`<wsse:Security`,
+		`>user</wsse:Username>`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("preview %s does not contain %s", output, expected)
+		}
+	}
+	if strings.Contains(output, "Body") {
+		t.Errorf("preview should not contain a body: %s", output)
+	}
+}
+
+func TestNewWSSTimestamp(t *testing.T) {
+	created := time.Date(2024, 3, 1, 13, 4, 5, 123456789, time.FixedZone("CET", 3600))
+	data, err := xml.Marshal(NewWSSTimestamp(created, 5*time.Minute, "TS-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<wsu:Timestamp xmlns:wsu="` + WssNsWSU + `" wsu:Id="TS-1">` +
+		`<wsu:Created>2024-03-01T12:04:05.123Z</wsu:Created>` +
+		`<wsu:Expires>2024-03-01T12:09:05.123Z</wsu:Expires></wsu:Timestamp>`
+	if string(data) != expected {
+		t.Errorf("got %s, expected %s", data, expected)
+	}
+}
+
+func TestClient_SecurityTimestamp(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"/></soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithSecurityTimestamp(5*time.Minute))
+	token := NewWSSSecurityHeader("user", "pass", "UsernameToken-1", "1")
+	client.AddHeader(token)
+	if err := client.Call("Ping", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatalf("couln't call service: %v", err)
+	}
+	if token.Timestamp != nil {
+		t.Error("the security header of the client was modified")
+	}
+
+	var envelope struct {
+		Security []struct {
+			Timestamp struct {
+				Id      string `xml:"Id,attr"`
+				Created string `xml:"Created"`
+				Expires string `xml:"Expires"`
+			} `xml:"Timestamp"`
+			Username string `xml:"UsernameToken>Username"`
+		} `xml:"Header>Security"`
+	}
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if len(envelope.Security) != 1 {
+		t.Fatalf("got %d security headers, expected 1: %s", len(envelope.Security), body)
+	}
+	security := envelope.Security[0]
+	if security.Username != "user" || !strings.HasPrefix(security.Timestamp.Id, "TS-") {
+		t.Errorf("expected a UsernameToken and a Timestamp with an Id: %s", body)
+	}
+	created, err := time.Parse(wssTimeFormat, security.Timestamp.Created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, err := time.Parse(wssTimeFormat, security.Timestamp.Expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expires.Sub(created) != 5*time.Minute {
+		t.Errorf("got a validity of %v, expected 5m", expires.Sub(created))
+	}
+}
+
+func TestClient_PasswordDigest(t *testing.T) {
+	var bodies [][]byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"/></soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithPasswordDigest("user", "secret"), WithSecurityClockSkew(-time.Hour))
+	client.AddHeader(NewWSSSecurityHeader("user", "secret", "UsernameToken-1", "1"))
+	for i := 0; i < 2; i++ {
+		if err := client.Call("Ping", &Ping{}, &PingResponse{}); err != nil {
+			t.Fatalf("couln't call service: %v", err)
+		}
+	}
+
+	var nonces []string
+	for _, body := range bodies {
+		var envelope struct {
+			Token []struct {
+				Id       string `xml:"Id,attr"`
+				Password struct {
+					Type string `xml:"Type,attr"`
+					Data string `xml:",chardata"`
+				} `xml:"Password"`
+				Nonce   string `xml:"Nonce"`
+				Created string `xml:"Created"`
+			} `xml:"Header>Security>UsernameToken"`
+		}
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if len(envelope.Token) != 1 {
+			t.Fatalf("got %d UsernameTokens, expected 1: %s", len(envelope.Token), body)
+		}
+		token := envelope.Token[0]
+		if token.Id != "UsernameToken-1" || token.Password.Type != WssNsDigestType {
+			t.Errorf("expected the UsernameToken of the client header with a digest: %s", body)
+		}
+
+		nonce, err := base64.StdEncoding.DecodeString(token.Nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha1.Sum(append(append(nonce, token.Created...), "secret"...))
+		if token.Password.Data != base64.StdEncoding.EncodeToString(digest[:]) {
+			t.Errorf("got digest %s, which does not match the nonce and created time", token.Password.Data)
+		}
+		created, err := time.Parse(wssTimeFormat, token.Created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skew := time.Until(created); skew > -59*time.Minute || skew < -61*time.Minute {
+			t.Errorf("got a created time %v away, expected the -1h skew", skew)
+		}
+		nonces = append(nonces, token.Nonce)
+	}
+	if nonces[0] == nonces[1] {
+		t.Errorf("consecutive calls reused the nonce %s", nonces[0])
+	}
+}
+
+func TestClient_HeaderPrefixConflicts(t *testing.T) {
+	type Trace struct {
+		XMLName xml.Name `xml:"ns:Trace"`
+		Ns      string   `xml:"xmlns:ns,attr"`
+		ID      string   `xml:"ns:id"`
+	}
+	type Route struct {
+		XMLName xml.Name `xml:"ns:Route"`
+		Ns      string   `xml:"xmlns:ns,attr"`
+		Hop     string   `xml:"ns:hop"`
+	}
+	headers := []interface{}{
+		&Trace{Ns: "urn:trace", ID: "42"},
+		&Route{Ns: "urn:route", Hop: "gateway"},
+	}
+
+	client := NewClient("http://localhost", WithHeaderPrefixConflicts(PrefixConflictFail))
+	client.SetHeaders(headers...)
+	_, err := client.PreviewHeaders()
+	if conflict, ok := err.(*PrefixConflictError); !ok || conflict.Prefix != "ns" || conflict.Header != 1 {
+		t.Errorf("expected a conflict on prefix ns of header 1, got %v", err)
+	}
+
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PingResponse xmlns="http://example.com/service.xsd"/></soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	client = NewClient(ts.URL, WithHeaderPrefixConflicts(PrefixConflictRename))
+	client.SetHeaders(headers...)
+	if err := client.Call("Ping", &Ping{}, &PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`<ns:Trace xmlns:ns="urn:trace"><ns:id>42</ns:id></ns:Trace>`,
+		`<ns2:Route xmlns:ns2="urn:route"><ns2:hop>gateway</ns2:hop></ns2:Route>`,
+	} {
+		if !strings.Contains(string(received), expected) {
+			t.Errorf("envelope %s does not contain %s", received, expected)
 		}
 	}
 
+	// The renamed envelope still resolves every element to its namespace.
+	var envelope struct {
+		Header struct {
+			Trace struct {
+				ID string `xml:"urn:trace id"`
+			} `xml:"urn:trace Trace"`
+			Route struct {
+				Hop string `xml:"urn:route hop"`
+			} `xml:"urn:route Route"`
+		}
+	}
+	if err := xml.Unmarshal(received, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Header.Trace.ID != "42" || envelope.Header.Route.Hop != "gateway" {
+		t.Errorf("got %+v from %s", envelope.Header, received)
+	}
 }
 
 func compareXMLs(output, expected string) bool {
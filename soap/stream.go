@@ -0,0 +1,180 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// CallStream performs HTTP POST request and hands a decoder of the content of
+// the SOAP Body of the response to handle, which reads it incrementally with
+// Token or DecodeElement rather than decoding it into a single value, as
+// responses holding many records call for. The decoder returns io.EOF at the
+// end of the Body, and the rest of the Body is skipped when handle returns
+// early.
+//
+// The Envelope and Body elements are checked before handle is called, and a
+// SOAP fault in the response is returned as a *SOAPFault without calling it.
+// A response with a non 2xx HTTP status that is not a fault is returned as an
+// *HTTPError, and a response that is not a SOAP envelope, or is cut short, as
+// a *DecodeError. The errors of handle are returned as is. Unlike Call,
+// CallStream does not resolve multiRef elements, xsi:nil elements or MTOM
+// attachments.
+func (s *Client) CallStream(ctx context.Context, soapAction string, request interface{}, handle func(d *xml.Decoder) error) (err error) {
+	s.preCall(ctx, soapAction, request)
+	defer func() { s.postCall(ctx, soapAction, nil, err) }()
+
+	res, err := s.doRequest(ctx, soapAction, request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, start, err := streamedBody(res)
+	if err != nil {
+		return err
+	}
+
+	d := xml.NewDecoder(body)
+	d.CharsetReader = charsetReader
+	content, err := enterBody(d)
+	if err != nil {
+		if fault, ok := err.(*SOAPFault); ok {
+			fault.raw = truncateBody(start)
+			return fault
+		}
+		return newDecodeError(err, res, start)
+	}
+
+	if err := handle(xml.NewTokenDecoder(content)); err != nil {
+		return err
+	}
+
+	// The rest of the response is read to check that the envelope is whole.
+	for {
+		if _, err := content.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			return newDecodeError(err, res, start)
+		}
+	}
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return newDecodeError(err, res, start)
+		}
+	}
+}
+
+// enterBody reads d up to the content of the Body of the SOAP envelope it
+// decodes, skipping its Header, and returns the reader of that content. A
+// fault in the Body is decoded and returned as the error.
+func enterBody(d *xml.Decoder) (*bodyReader, error) {
+	inEnvelope := false
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case !inEnvelope && isEnvelopeElement(t.Name, "Envelope"):
+				inEnvelope = true
+			case inEnvelope && isEnvelopeElement(t.Name, "Header"):
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+			case inEnvelope && isEnvelopeElement(t.Name, "Body"):
+				return firstBodyToken(d)
+			default:
+				return nil, fmt.Errorf("soap: unexpected element <%s> in response envelope", t.Name.Local)
+			}
+		case xml.EndElement:
+			return nil, fmt.Errorf("soap: response envelope has no Body")
+		}
+	}
+}
+
+// firstBodyToken reads the content of the Body d is positioned in up to its
+// first element, and returns the reader of that content, or the fault the
+// element holds as the error.
+func firstBodyToken(d *xml.Decoder) (*bodyReader, error) {
+	r := &bodyReader{d: d}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if isEnvelopeElement(t.Name, "Fault") {
+				fault := new(SOAPFault)
+				if err := d.DecodeElement(fault, &t); err != nil {
+					return nil, err
+				}
+				return nil, fault
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		}
+		r.pending = append(r.pending, xml.CopyToken(token))
+		if _, ok := token.(xml.CharData); !ok {
+			return r, nil
+		}
+	}
+}
+
+// isEnvelopeElement reports whether name is the SOAP 1.1 envelope element
+// called local.
+func isEnvelopeElement(name xml.Name, local string) bool {
+	return name.Local == local && name.Space == envelopeNamespace
+}
+
+// bodyReader is the xml.TokenReader of the content of a SOAP Body, which
+// returns io.EOF at the end of the Body.
+type bodyReader struct {
+	d *xml.Decoder
+	// pending holds the tokens read ahead, looking for a fault.
+	pending []xml.Token
+	depth   int
+	done    bool
+}
+
+func (r *bodyReader) Token() (xml.Token, error) {
+	var token xml.Token
+	switch {
+	case len(r.pending) > 0:
+		token, r.pending = r.pending[0], r.pending[1:]
+	case r.done:
+		return nil, io.EOF
+	default:
+		var err error
+		if token, err = r.d.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch token.(type) {
+	case xml.StartElement:
+		r.depth++
+	case xml.EndElement:
+		if r.depth == 0 {
+			r.done = true
+			r.pending = nil
+			return nil, io.EOF
+		}
+		r.depth--
+	}
+	return token, nil
+}
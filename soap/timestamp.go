@@ -0,0 +1,70 @@
+package soap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"time"
+)
+
+// wssTimeFormat is the UTC format of the times of a WS-Security Timestamp.
+const wssTimeFormat = "2006-01-02T15:04:05.000Z"
+
+type WSSTimestamp struct {
+	XMLName  xml.Name `xml:"wsu:Timestamp"`
+	XmlNSWsu string   `xml:"xmlns:wsu,attr"`
+
+	Id string `xml:"wsu:Id,attr,omitempty"`
+
+	Created string `xml:"wsu:Created"`
+	Expires string `xml:"wsu:Expires,omitempty"`
+}
+
+// NewWSSTimestamp creates a WSSTimestamp created at created and expiring ttl
+// later, or never if ttl is zero.
+func NewWSSTimestamp(created time.Time, ttl time.Duration, id string) *WSSTimestamp {
+	ts := &WSSTimestamp{XmlNSWsu: WssNsWSU, Id: id, Created: created.UTC().Format(wssTimeFormat)}
+	if ttl > 0 {
+		ts.Expires = created.Add(ttl).UTC().Format(wssTimeFormat)
+	}
+	return ts
+}
+
+// WithSecurityTimestamp is an Option to add a WS-Security Timestamp, created
+// when a request is sent and expiring ttl later, to the wsse:Security header
+// of every request. The Timestamp is added to the WSSSecurityHeader set with
+// AddHeader or SetHeaders, such as a UsernameToken one, or to a new
+// wsse:Security header when there is none. A zero ttl adds no Timestamp. Its
+// Created time is offset by WithSecurityClockSkew.
+func WithSecurityTimestamp(ttl time.Duration) Option {
+	return func(o *options) {
+		o.securityTimestamp = ttl
+	}
+}
+
+// timestampHeaders returns headers with a Timestamp created at created in
+// their security header. The headers of the client are copied rather than
+// modified, as they are shared by concurrent requests.
+func timestampHeaders(headers []interface{}, ttl time.Duration, created time.Time) []interface{} {
+	ts := NewWSSTimestamp(created, ttl, newTimestampID())
+
+	stamped := make([]interface{}, len(headers), len(headers)+1)
+	copy(stamped, headers)
+	for i, header := range stamped {
+		if security, ok := header.(*WSSSecurityHeader); ok {
+			copied := *security
+			copied.Timestamp = ts
+			stamped[i] = &copied
+			return stamped
+		}
+	}
+	return append(stamped, &WSSSecurityHeader{XmlNSWsse: WssNsWSSE, Timestamp: ts})
+}
+
+// newTimestampID returns a random wsu:Id for a Timestamp, which signatures
+// refer to it by.
+func newTimestampID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return "TS-" + hex.EncodeToString(id)
+}
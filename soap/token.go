@@ -0,0 +1,78 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// A TokenSource returns the OAuth2 access token requests are sent with, as
+// an Authorization: Bearer header. It is called before every attempt of a
+// call, so that it can refresh expired tokens.
+type TokenSource func(ctx context.Context) (string, error)
+
+// WithBearerToken is an Option to send requests with an Authorization: Bearer
+// header carrying token. It replaces the header set by WithBasicAuth.
+func WithBearerToken(token string) Option {
+	return func(o *options) {
+		o.bearerToken = token
+		o.tokenSource = nil
+	}
+}
+
+// WithTokenSource is an Option to send requests with an Authorization: Bearer
+// header carrying the token returned by source, which is called before every
+// attempt. A request answered with a 401 HTTP status is retried once, with a
+// token obtained from source again, before the retry policy is consulted.
+// Calls fail with the error of source, without sending the request, if it
+// fails or returns an empty token. It replaces WithBearerToken and the header
+// set by WithBasicAuth.
+func WithTokenSource(source TokenSource) Option {
+	return func(o *options) {
+		o.tokenSource = source
+		o.bearerToken = ""
+	}
+}
+
+// accessToken returns the bearer token of an attempt made with ctx, or an
+// empty string if the client sends none.
+func (s *Client) accessToken(ctx context.Context) (string, error) {
+	if s.opts.tokenSource == nil {
+		return s.opts.bearerToken, nil
+	}
+
+	token, err := s.opts.tokenSource(ctx)
+	if err != nil {
+		return "", fmt.Errorf("soap: token source: %w", err)
+	}
+	if token == "" {
+		return "", errors.New("soap: token source returned an empty token")
+	}
+	return token, nil
+}
+
+// retryPolicy returns the retry policy of a call, which retries a 401 response
+// once when the client has a token source, and otherwise defers to the retry
+// policy of the client, counting attempts without that retry.
+func (s *Client) retryPolicy() RetryPolicy {
+	retry := s.opts.retry
+	if s.opts.tokenSource == nil {
+		return retry
+	}
+
+	refreshed := false
+	return func(soapAction string, attempt int, res *http.Response, err error) bool {
+		if !refreshed && res != nil && res.StatusCode == http.StatusUnauthorized {
+			refreshed = true
+			return true
+		}
+		if retry == nil {
+			return false
+		}
+		if refreshed {
+			attempt--
+		}
+		return retry(soapAction, attempt, res, err)
+	}
+}
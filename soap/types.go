@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FormatList returns the lexical representation of an XSD list, as MarshalList
+// does, or an empty string if an item cannot be formatted. It is kept for code
+// generated by earlier versions, which call it from their MarshalXML methods.
+func FormatList(items interface{}) string {
+	s, _ := MarshalList(items)
+	return s
+}
+
+// MarshalList returns the lexical representation of an XSD list, the items of
+// the given slice separated by a single space. Items implementing
+// encoding.TextMarshaler, such as enumerations, are formatted by it, and
+// time.Time items as xsd:dateTime values.
+func MarshalList(items interface{}) (string, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return fmt.Sprint(items), nil
+	}
+
+	tokens := make([]string, v.Len())
+	for i := range tokens {
+		item := reflect.Indirect(v.Index(i)).Interface()
+		switch item := item.(type) {
+		case time.Time:
+			tokens[i] = item.Format(time.RFC3339Nano)
+		case encoding.TextMarshaler:
+			text, err := item.MarshalText()
+			if err != nil {
+				return "", err
+			}
+			tokens[i] = string(text)
+		default:
+			tokens[i] = fmt.Sprint(item)
+		}
+	}
+	return strings.Join(tokens, " "), nil
+}
+
+// ParseList parses the lexical representation of an XSD list, a whitespace
+// separated sequence of values, into items, which must be a pointer to a slice.
+// Items implementing encoding.TextUnmarshaler are parsed by it, and time.Time
+// items as xsd:dateTime, xsd:date or xsd:time values, whose time zone is
+// optional.
+func ParseList(s string, items interface{}) error {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("expected a pointer to a slice, got %T", items)
+	}
+
+	tokens := strings.Fields(s)
+	list := reflect.MakeSlice(v.Elem().Type(), len(tokens), len(tokens))
+	for i, token := range tokens {
+		item := list.Index(i)
+		if item.Kind() == reflect.Ptr {
+			item.Set(reflect.New(item.Type().Elem()))
+			item = item.Elem()
+		}
+
+		if t, ok := item.Addr().Interface().(*time.Time); ok {
+			parsed, err := parseXSDTime(token)
+			if err != nil {
+				return fmt.Errorf("invalid list item %q: %v", token, err)
+			}
+			*t = parsed
+			continue
+		}
+		if u, ok := item.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(token)); err != nil {
+				return fmt.Errorf("invalid list item %q: %v", token, err)
+			}
+			continue
+		}
+		if item.Kind() == reflect.String {
+			item.SetString(token)
+			continue
+		}
+		if _, err := fmt.Sscan(token, item.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid list item %q: %v", token, err)
+		}
+	}
+
+	v.Elem().Set(list)
+	return nil
+}
+
+// xsdTimeLayouts are the layouts of the lexical representations of
+// xsd:dateTime, xsd:date and xsd:time values, with and without time zone.
+var xsdTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02Z07:00",
+	"2006-01-02",
+	"15:04:05.999999999Z07:00",
+	"15:04:05.999999999",
+}
+
+// parseXSDTime parses an xsd:dateTime, xsd:date or xsd:time value. Values
+// without time zone are parsed as UTC.
+func parseXSDTime(s string) (time.Time, error) {
+	for _, layout := range xsdTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not an XSD date or time", s)
+}
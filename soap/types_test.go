@@ -0,0 +1,158 @@
+package soap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type listOfInt []int32
+
+func (l listOfInt) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	s, err := MarshalList(l)
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(s, start)
+}
+
+func (l *listOfInt) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	return ParseList(s, l)
+}
+
+type color string
+
+type colors []color
+
+func (l colors) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	s, err := MarshalList(l)
+	return xml.Attr{Name: name, Value: s}, err
+}
+
+func (l *colors) UnmarshalXMLAttr(attr xml.Attr) error {
+	return ParseList(attr.Value, l)
+}
+
+func TestList_RoundTrip(t *testing.T) {
+	type Measures struct {
+		XMLName xml.Name   `xml:"Measures"`
+		Colors  *colors    `xml:"colors,attr,omitempty"`
+		Values  *listOfInt `xml:"values,omitempty"`
+	}
+
+	m := new(Measures)
+	if err := xml.Unmarshal([]byte(`<Measures colors="red  green"><values> 1 0
+		-3 </values></Measures>`), m); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*m.Values, listOfInt{1, 0, -3}) {
+		t.Errorf("got values %v wanted [1 0 -3]", *m.Values)
+	}
+	if !reflect.DeepEqual(*m.Colors, colors{"red", "green"}) {
+		t.Errorf("got colors %v wanted [red green]", *m.Colors)
+	}
+
+	output, err := xml.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<Measures colors="red green"><values>1 0 -3</values></Measures>`
+	if string(output) != expected {
+		t.Errorf("got %s wanted %s", output, expected)
+	}
+}
+
+func TestParseList_InvalidItem(t *testing.T) {
+	var l listOfInt
+	if err := ParseList("1 two 3", &l); err == nil {
+		t.Error("expected an error for a non integer item")
+	}
+}
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	switch l {
+	case 1:
+		return []byte("low"), nil
+	case 2:
+		return []byte("high"), nil
+	}
+	return nil, fmt.Errorf("invalid level %d", int(l))
+}
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("invalid level %q", text)
+	}
+	return nil
+}
+
+func TestParseList_TextUnmarshaler(t *testing.T) {
+	var l []level
+	if err := ParseList("high low", &l); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, []level{2, 1}) {
+		t.Errorf("got %v wanted [2 1]", l)
+	}
+
+	if err := ParseList("medium", &l); err == nil {
+		t.Error("expected an error for an item rejected by UnmarshalText")
+	}
+}
+
+func TestMarshalList_TextMarshaler(t *testing.T) {
+	s, err := MarshalList([]level{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "high low" {
+		t.Errorf("got %q wanted %q", s, "high low")
+	}
+
+	if _, err := MarshalList([]level{3}); err == nil {
+		t.Error("expected an error for an item rejected by MarshalText")
+	}
+}
+
+func TestList_DateTime(t *testing.T) {
+	var l []time.Time
+	if err := ParseList("2021-03-04T05:06:07.5+01:00 2021-03-04T05:06:07 2021-03-04", &l); err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Time{
+		time.Date(2021, 3, 4, 5, 6, 7, 500000000, time.FixedZone("", 3600)),
+		time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC),
+	}
+	for i := range expected {
+		if !l[i].Equal(expected[i]) {
+			t.Errorf("got item %d %v wanted %v", i, l[i], expected[i])
+		}
+	}
+
+	s, err := MarshalList(l[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "2021-03-04T05:06:07.5+01:00 2021-03-04T05:06:07Z" {
+		t.Errorf("got %q", s)
+	}
+
+	if err := ParseList("yesterday", &l); err == nil {
+		t.Error("expected an error for an item which is not a dateTime")
+	}
+}
@@ -0,0 +1,135 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// soap12EnvelopeNamespace is the namespace of SOAP 1.2 envelopes.
+const soap12EnvelopeNamespace = "http://www.w3.org/2003/05/soap-envelope"
+
+// A VersionMismatchError is returned by calls answered with a VersionMismatch
+// fault, as a SOAP 1.2 only service answers the SOAP 1.1 envelopes the client
+// sends.
+type VersionMismatchError struct {
+	// SupportedEnvelopes holds the namespaces of the envelopes supported by
+	// the service, as listed by the Upgrade header of the fault, in order
+	// of preference. It is empty if the fault has no Upgrade header.
+	SupportedEnvelopes []string
+	// Reason is the human readable explanation of the fault.
+	Reason string
+
+	raw []byte
+}
+
+func (e *VersionMismatchError) Error() string {
+	msg := "soap: VersionMismatch fault"
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if len(e.SupportedEnvelopes) > 0 {
+		msg += " (supported envelopes: " + strings.Join(e.SupportedEnvelopes, ", ") + ")"
+	}
+	return msg
+}
+
+// RawBody returns the start of the response body, truncated to 4 KiB.
+func (e *VersionMismatchError) RawBody() []byte {
+	return e.raw
+}
+
+// versionMismatch returns the VersionMismatchError of a response whose body is
+// a SOAP 1.1 or SOAP 1.2 VersionMismatch fault, or whose header has an
+// Upgrade element, and nil otherwise.
+func versionMismatch(body []byte) *VersionMismatchError {
+	if !bytes.Contains(body, []byte("VersionMismatch")) && !bytes.Contains(body, []byte("Upgrade")) {
+		return nil
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charsetReader
+	var (
+		// scopes holds the namespace declarations of the open elements.
+		scopes   []map[string]string
+		path     []string
+		text     strings.Builder
+		vm       = &VersionMismatchError{raw: truncateBody(body)}
+		mismatch bool
+		upgrade  bool
+	)
+	resolve := func(qname string) string {
+		prefix, local := "", qname
+		if i := strings.Index(qname, ":"); i >= 0 {
+			prefix, local = qname[:i], qname[i+1:]
+		}
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if ns, ok := scopes[i][prefix]; ok {
+				return ns + " " + local
+			}
+		}
+		return local
+	}
+
+	for {
+		token, tokenErr := d.RawToken()
+		if tokenErr == io.EOF {
+			break
+		}
+		if tokenErr != nil {
+			return nil
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			scope := make(map[string]string)
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					scope[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					scope[""] = attr.Value
+				}
+			}
+			scopes = append(scopes, scope)
+			path = append(path, t.Name.Local)
+			text.Reset()
+
+			if len(path) == 1 && (t.Name.Local != "Envelope" || resolve(rawName(t.Name)) != envelopeNamespace+" Envelope" && resolve(rawName(t.Name)) != soap12EnvelopeNamespace+" Envelope") {
+				return nil
+			}
+			if t.Name.Local == "SupportedEnvelope" && len(path) > 1 && path[len(path)-2] == "Upgrade" {
+				upgrade = true
+				for _, attr := range t.Attr {
+					if attr.Name.Space == "" && attr.Name.Local == "qname" {
+						if qname := resolve(attr.Value); strings.HasSuffix(qname, " Envelope") {
+							vm.SupportedEnvelopes = append(vm.SupportedEnvelopes, strings.TrimSuffix(qname, " Envelope"))
+						}
+					}
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(path) == 0 {
+				return nil
+			}
+			value := strings.TrimSpace(text.String())
+			switch name := strings.Join(path, "/"); {
+			case strings.HasSuffix(name, "Fault/faultcode"), strings.HasSuffix(name, "Fault/Code/Value"):
+				mismatch = strings.HasSuffix(resolve(value), " VersionMismatch") || value == "VersionMismatch"
+			case strings.HasSuffix(name, "Fault/faultstring"), strings.HasSuffix(name, "Fault/Reason/Text") && vm.Reason == "":
+				vm.Reason = value
+			}
+			text.Reset()
+			scopes = scopes[:len(scopes)-1]
+			path = path[:len(path)-1]
+		}
+	}
+
+	if !mismatch && !upgrade {
+		return nil
+	}
+	return vm
+}
@@ -0,0 +1,124 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// xsiTypes holds the types registered with RegisterType, keyed by XSD name for
+// decoding and by Go type for encoding.
+var xsiTypes = struct {
+	sync.RWMutex
+	factories map[xml.Name]func() interface{}
+	names     map[reflect.Type]xml.Name
+}{
+	factories: make(map[xml.Name]func() interface{}),
+	names:     make(map[reflect.Type]xml.Name),
+}
+
+// RegisterType maps the XSD type name of namespace to the Go type of the
+// values returned by factory, for DecodeType and EncodeType. Generated code
+// registers the types derived from abstract types from init functions; types
+// derived by a service beyond those of its WSDL are registered the same way.
+func RegisterType(namespace, name string, factory func() interface{}) {
+	xsiTypes.Lock()
+	defer xsiTypes.Unlock()
+
+	qname := xml.Name{Space: namespace, Local: name}
+	xsiTypes.factories[qname] = factory
+	xsiTypes.names[reflect.TypeOf(factory())] = qname
+}
+
+// DecodeType decodes the element start into a value of the type its xsi:type
+// attribute names, as registered with RegisterType. Elements without an
+// xsi:type attribute, or naming a type that is not registered, are decoded
+// into the value returned by fallback.
+//
+// encoding/xml does not expose the namespace prefixes declared by the
+// ancestors of start, so a prefix that start does not declare itself is
+// resolved by looking the type up by its local name alone.
+func DecodeType(d *xml.Decoder, start xml.StartElement, fallback func() interface{}) (interface{}, error) {
+	factory := fallback
+	if qname, ok := xsiType(start); ok {
+		if f := lookupType(qname); f != nil {
+			factory = f
+		}
+	}
+
+	value := factory()
+	if err := d.DecodeElement(value, &start); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// EncodeType encodes value as the element start, marked with the xsi:type
+// attribute of its type if it was registered with RegisterType. A nil value
+// is not encoded.
+func EncodeType(e *xml.Encoder, start xml.StartElement, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	xsiTypes.RLock()
+	qname, ok := xsiTypes.names[reflect.TypeOf(value)]
+	xsiTypes.RUnlock()
+
+	if ok {
+		start.Attr = append(start.Attr,
+			xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace},
+			xml.Attr{Name: xml.Name{Local: "xmlns:xsitype"}, Value: qname.Space},
+			xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: "xsitype:" + qname.Local},
+		)
+	}
+	return e.EncodeElement(value, start)
+}
+
+// xsiType returns the type named by the xsi:type attribute of start. Its
+// namespace is left empty if the prefix is not declared by start.
+func xsiType(start xml.StartElement) (xml.Name, bool) {
+	for _, attr := range start.Attr {
+		if attr.Name.Space != xsiNamespace || attr.Name.Local != "type" {
+			continue
+		}
+
+		prefix, local := "", strings.TrimSpace(attr.Value)
+		if i := strings.Index(local, ":"); i >= 0 {
+			prefix, local = local[:i], local[i+1:]
+		}
+
+		qname := xml.Name{Local: local}
+		for _, decl := range start.Attr {
+			if (prefix == "" && decl.Name.Space == "" && decl.Name.Local == "xmlns") ||
+				(prefix != "" && decl.Name.Space == "xmlns" && decl.Name.Local == prefix) {
+				qname.Space = decl.Value
+			}
+		}
+		return qname, true
+	}
+	return xml.Name{}, false
+}
+
+// lookupType returns the factory registered for qname. Names without a
+// namespace match the only type registered under their local name, if any.
+func lookupType(qname xml.Name) func() interface{} {
+	xsiTypes.RLock()
+	defer xsiTypes.RUnlock()
+
+	if qname.Space != "" {
+		return xsiTypes.factories[qname]
+	}
+
+	var factory func() interface{}
+	for name, f := range xsiTypes.factories {
+		if name.Local == qname.Local {
+			if factory != nil {
+				return nil
+			}
+			factory = f
+		}
+	}
+	return factory
+}
@@ -0,0 +1,91 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+type Animal struct {
+	Name string `xml:"name"`
+}
+
+type Dog struct {
+	*Animal
+	Breed string `xml:"breed"`
+}
+
+type Cat struct {
+	*Animal
+	Lives int `xml:"lives"`
+}
+
+type AnimalValue struct {
+	Value interface{}
+}
+
+func (v *AnimalValue) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	value, err := DecodeType(d, start, func() interface{} { return new(Animal) })
+	if err != nil {
+		return err
+	}
+	v.Value = value
+	return nil
+}
+
+func (v AnimalValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return EncodeType(e, start, v.Value)
+}
+
+func init() {
+	RegisterType("http://example.com/zoo", "Dog", func() interface{} { return new(Dog) })
+	RegisterType("http://example.com/zoo", "Cat", func() interface{} { return new(Cat) })
+}
+
+func TestXSIType_RoundTrip(t *testing.T) {
+	type Zoo struct {
+		XMLName xml.Name       `xml:"Zoo"`
+		Animals []*AnimalValue `xml:"animal"`
+	}
+
+	data := `<Zoo xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<animal xmlns:z="http://example.com/zoo" xsi:type="z:Dog"><name>Rex</name><breed>collie</breed></animal>` +
+		`<animal xsi:type="Cat"><name>Tom</name><lives>9</lives></animal>` +
+		`<animal xsi:type="Parrot"><name>Polly</name></animal>` +
+		`<animal><name>Nemo</name></animal>` +
+		`</Zoo>`
+
+	zoo := new(Zoo)
+	if err := xml.Unmarshal([]byte(data), zoo); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{
+		&Dog{Animal: &Animal{Name: "Rex"}, Breed: "collie"},
+		&Cat{Animal: &Animal{Name: "Tom"}, Lives: 9},
+		// Unknown types decode as the base type.
+		&Animal{Name: "Polly"},
+		&Animal{Name: "Nemo"},
+	}
+	if len(zoo.Animals) != len(expected) {
+		t.Fatalf("got %d animals, wanted %d", len(zoo.Animals), len(expected))
+	}
+	for i, a := range zoo.Animals {
+		if !reflect.DeepEqual(a.Value, expected[i]) {
+			t.Errorf("animal %d: got %#v, wanted %#v", i, a.Value, expected[i])
+		}
+	}
+
+	output, err := xml.Marshal(Zoo{Animals: zoo.Animals[:2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again := new(Zoo)
+	if err := xml.Unmarshal(output, again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Animals, zoo.Animals[:2]) {
+		t.Errorf("round trip of %s lost the derived types", output)
+	}
+}
@@ -0,0 +1,103 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import "encoding/xml"
+
+// expandSubstitutions adds, after each reference to the head of a substitution
+// group among elements, references to the members of the group, which may
+// appear in its place. Like the elements of a choice, they are all optional,
+// and repeated when the head is. The reference to an abstract head, which
+// never appears itself, is dropped.
+func (t *traverser) expandSubstitutions(elements []*XSDElement) []*XSDElement {
+	expanded := elements[:0:0]
+	for _, elm := range elements {
+		if elm.Ref == "" {
+			expanded = append(expanded, elm)
+			continue
+		}
+		head := t.qname(elm.Ref)
+		_, global := t.getGlobalElement(head)
+		members := t.substitutionMembers(head)
+		if global == nil || len(members) == 0 {
+			expanded = append(expanded, elm)
+			continue
+		}
+
+		if !global.Abstract {
+			// The reference belongs to the parsed schema, and may be shared
+			// through a group, so it is made optional on a copy.
+			copied := *elm
+			copied.MinOccurs = "0"
+			expanded = append(expanded, &copied)
+		}
+		for _, member := range members {
+			expanded = append(expanded, &XSDElement{
+				Ref:       t.prefixedName(member.Space, member.Local),
+				MinOccurs: "0",
+				MaxOccurs: elm.MaxOccurs,
+				Nillable:  elm.Nillable,
+			})
+		}
+	}
+	return expanded
+}
+
+// substitutionMembers returns the global elements substituting, directly or
+// not, for the global element head, breadth first and in document order,
+// leaving out abstract ones.
+func (t *traverser) substitutionMembers(head xml.Name) []xml.Name {
+	var members []xml.Name
+	seen := map[xml.Name]bool{head: true}
+	queue := []xml.Name{head}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, schema := range t.all {
+			for _, elm := range schema.Elements {
+				if elm.SubstitutionGroup == "" {
+					continue
+				}
+				group := xml.Name{Space: resolveNamespace(schema, elm.SubstitutionGroup), Local: stripns(elm.SubstitutionGroup)}
+				member := xml.Name{Space: schema.TargetNamespace, Local: elm.Name}
+				if group != name || seen[member] {
+					continue
+				}
+				seen[member] = true
+				queue = append(queue, member)
+				if !elm.Abstract {
+					members = append(members, member)
+				}
+			}
+		}
+	}
+	return members
+}
+
+// withSubstitutionType returns the global element elm of schema, or, if it is
+// a member of a substitution group declaring no type, a copy of it given the
+// type of the element it substitutes for, directly or not, as XML Schema has
+// it. The parsed schema is left untouched.
+func (t *traverser) withSubstitutionType(schema *XSDSchema, elm *XSDElement) *XSDElement {
+	if elm.Type != "" || elm.ComplexType != nil || elm.SimpleType != nil {
+		return elm
+	}
+
+	seen := map[*XSDElement]bool{}
+	headSchema, head := schema, elm
+	for head.SubstitutionGroup != "" && !seen[head] {
+		seen[head] = true
+		headSchema, head = t.getGlobalElement(xml.Name{Space: resolveNamespace(headSchema, head.SubstitutionGroup), Local: stripns(head.SubstitutionGroup)})
+		if head == nil || head.ComplexType != nil || head.SimpleType != nil {
+			return elm
+		}
+		if head.Type != "" {
+			copied := *elm
+			copied.Type = newTraverser(schema, t.all).prefixedName(resolveNamespace(headSchema, head.Type), stripns(head.Type))
+			return &copied
+		}
+	}
+	return elm
+}
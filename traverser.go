@@ -2,6 +2,8 @@ package gowsdl
 
 import (
 	"encoding/xml"
+	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -36,6 +38,9 @@ func (t *traverser) traverseElements(ct []*XSDElement) {
 }
 
 func (t *traverser) traverseElement(elm *XSDElement) {
+	if elm.Ref != "" {
+		t.resolveElementRef(elm)
+	}
 	if elm.ComplexType != nil {
 		t.traverseComplexType(elm.ComplexType)
 	}
@@ -45,18 +50,258 @@ func (t *traverser) traverseElement(elm *XSDElement) {
 }
 
 func (t *traverser) traverseSimpleType(st *XSDSimpleType) {
+	// Lists of an anonymous simple type take the item type from its base.
+	if st.List.ItemType == "" && st.List.SimpleType != nil {
+		t.traverseSimpleType(st.List.SimpleType)
+		st.List.ItemType = st.List.SimpleType.Restriction.Base
+	}
 }
 
 func (t *traverser) traverseComplexType(ct *XSDComplexType) {
+	// Restricted complex content, such as SOAP encoded arrays, is generated
+	// like an extension of its base type.
+	if r := ct.ComplexContent.Restriction; r.Base != "" && ct.ComplexContent.Extension.Base == "" {
+		ct.ComplexContent.Extension.Base = r.Base
+		ct.ComplexContent.Extension.Attributes = r.Attributes
+		ct.ComplexContent.Extension.AttributeGroups = r.AttributeGroups
+		ct.ComplexContent.Extension.Sequence = r.Sequence
+	}
+
+	ct.Sequence = t.expandSubstitutions(t.expandGroups(t.c, ct.Sequence, nil))
+	ct.Choice = t.expandSubstitutions(t.expandGroups(t.c, ct.Choice, nil))
+	ct.All = t.expandSubstitutions(t.expandGroups(t.c, ct.All, nil))
+	if ext := &ct.ComplexContent.Extension; len(ext.Sequence) > 0 {
+		ext.Sequence = elementValues(t.expandSubstitutions(t.expandGroups(t.c, elementPointers(ext.Sequence), nil)))
+	}
+
 	t.traverseElements(ct.Sequence)
 	t.traverseElements(ct.Choice)
-	t.traverseElements(ct.SequenceChoice)
 	t.traverseElements(ct.All)
+	for i := range ct.ComplexContent.Extension.Sequence {
+		t.traverseElement(&ct.ComplexContent.Extension.Sequence[i])
+	}
+
+	ct.Attributes = t.expandAttributeGroups(ct.Attributes, &ct.AttributeGroups)
+	ext := &ct.ComplexContent.Extension
+	ext.Attributes = t.expandAttributeGroups(ext.Attributes, &ext.AttributeGroups)
+	ext = &ct.SimpleContent.Extension
+	ext.Attributes = t.expandAttributeGroups(ext.Attributes, &ext.AttributeGroups)
+
 	t.traverseAttributes(ct.Attributes)
 	t.traverseAttributes(ct.ComplexContent.Extension.Attributes)
 	t.traverseAttributes(ct.SimpleContent.Extension.Attributes)
 }
 
+// expandAttributeGroups appends the attributes of the referenced attribute
+// groups to attrs, and clears the references so that a type traversed twice is
+// not expanded twice.
+func (t *traverser) expandAttributeGroups(attrs []*XSDAttribute, groups *[]*XSDAttributeGroup) []*XSDAttribute {
+	visited := make(map[xml.Name]bool)
+	for _, group := range *groups {
+		attrs = append(attrs, t.attributeGroupAttributes(t.c, group, visited)...)
+	}
+	*groups = nil
+	return attrs
+}
+
+// attributeGroupAttributes returns copies of the attributes of group, used
+// within schema, including those of the attribute groups it references.
+// Attribute types are rewritten to resolve within the traversed schema.
+// References that cannot be resolved, or to a group already expanded, are
+// skipped.
+func (t *traverser) attributeGroupAttributes(schema *XSDSchema, group *XSDAttributeGroup, visited map[xml.Name]bool) []*XSDAttribute {
+	if group.Ref != "" {
+		ref := xml.Name{Space: resolveNamespace(schema, group.Ref), Local: stripns(group.Ref)}
+		if visited[ref] {
+			return nil
+		}
+		visited[ref] = true
+
+		schema, group = t.getGlobalAttributeGroup(ref)
+		if group == nil {
+			return nil
+		}
+	}
+
+	var attrs []*XSDAttribute
+	for _, attr := range group.Attributes {
+		attr := *attr
+		if schema != t.c {
+			newTraverser(schema, t.all).traverseAttribute(&attr)
+			if attr.Type != "" {
+				attr.Type = t.prefixedName(resolveNamespace(schema, attr.Type), stripns(attr.Type))
+			}
+		}
+		attrs = append(attrs, &attr)
+	}
+	for _, nested := range group.AttributeGroups {
+		attrs = append(attrs, t.attributeGroupAttributes(schema, nested, visited)...)
+	}
+	return attrs
+}
+
+func (t *traverser) getGlobalAttributeGroup(ref xml.Name) (*XSDSchema, *XSDAttributeGroup) {
+	for _, schema := range t.all {
+		if schema.TargetNamespace == ref.Space {
+			for _, group := range schema.AttributeGroups {
+				if group.Name == ref.Local {
+					return schema, group
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// expandGroups replaces the references to model groups among elements, used
+// within schema, with copies of the elements of the groups, including those of
+// the groups they reference. The copies are optional when the reference is,
+// and repeated when it repeats. Element types and references are rewritten to
+// resolve within the traversed schema. References that cannot be resolved, or
+// to a group already being expanded, are dropped.
+func (t *traverser) expandGroups(schema *XSDSchema, elements []*XSDElement, expanding map[xml.Name]bool) []*XSDElement {
+	expanded := elements[:0:0]
+	for _, elm := range elements {
+		if elm.groupRef == nil {
+			expanded = append(expanded, elm)
+			continue
+		}
+
+		ref := xml.Name{Space: resolveNamespace(schema, elm.groupRef.Ref), Local: stripns(elm.groupRef.Ref)}
+		groupSchema, group := t.getGlobalGroup(ref)
+		if group == nil || expanding[ref] {
+			continue
+		}
+		if expanding == nil {
+			expanding = make(map[xml.Name]bool)
+		}
+		expanding[ref] = true
+
+		for _, member := range group.elements() {
+			var copies []*XSDElement
+			if member.groupRef != nil {
+				copies = t.expandGroups(groupSchema, []*XSDElement{member}, expanding)
+			} else {
+				member := *member
+				if groupSchema != t.c {
+					if member.Type != "" {
+						member.Type = t.prefixedName(resolveNamespace(groupSchema, member.Type), stripns(member.Type))
+					}
+					if member.Ref != "" {
+						member.Ref = t.prefixedName(resolveNamespace(groupSchema, member.Ref), stripns(member.Ref))
+					}
+				}
+				copies = []*XSDElement{&member}
+			}
+
+			for _, c := range copies {
+				if elm.MinOccurs == "0" {
+					c.MinOccurs = "0"
+				}
+				if isRepeated(elm.MaxOccurs) && !isRepeated(c.MaxOccurs) {
+					c.MaxOccurs = "unbounded"
+				}
+			}
+			expanded = append(expanded, copies...)
+		}
+		delete(expanding, ref)
+	}
+	return expanded
+}
+
+func (t *traverser) getGlobalGroup(ref xml.Name) (*XSDSchema, *XSDGroup) {
+	for _, schema := range t.all {
+		if schema.TargetNamespace == ref.Space {
+			for _, group := range schema.Groups {
+				if group.Name == ref.Local {
+					return schema, group
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// resolveElementRef replaces a reference to a global element with the name
+// and type of that element, which may be declared by another schema, and is
+// qualified with its namespace. Its nillable and default settings are carried
+// over. References that cannot be resolved are left untouched.
+func (t *traverser) resolveElementRef(elm *XSDElement) {
+	ref := t.qname(elm.Ref)
+	schema, global := t.getGlobalElement(ref)
+	if global == nil || global.Ref != "" {
+		return
+	}
+	global = t.withSubstitutionType(schema, global)
+
+	switch {
+	case global.Type != "":
+		elm.Type = t.prefixedName(resolveNamespace(schema, global.Type), stripns(global.Type))
+	case global.SimpleType != nil && global.SimpleType.Restriction.Base != "":
+		base := global.SimpleType.Restriction.Base
+		elm.Type = t.prefixedName(resolveNamespace(schema, base), stripns(base))
+	default:
+		// The element declares a type of its own, generated after its name.
+		elm.Type = t.prefixedName(ref.Space, ref.Local)
+	}
+
+	elm.Name = ref.Local
+	elm.Ref = ""
+	elm.namespace = ref.Space
+	elm.Nillable = elm.Nillable || global.Nillable
+	if elm.Default == "" {
+		elm.Default = global.Default
+	}
+	if elm.Doc == "" {
+		elm.Doc = global.Doc
+	}
+}
+
+func (t *traverser) getGlobalElement(ref xml.Name) (*XSDSchema, *XSDElement) {
+	for _, schema := range t.all {
+		if schema.TargetNamespace == ref.Space {
+			for _, elm := range schema.Elements {
+				if elm.Name == ref.Local {
+					return schema, elm
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// prefixedName returns a QName of local in namespace that resolves within the
+// traversed schema, declaring a new prefix for namespace if there is none.
+func (t *traverser) prefixedName(namespace, local string) string {
+	if namespace == resolveNamespace(t.c, local) {
+		return local
+	}
+
+	var prefixes []string
+	for prefix, ns := range t.c.Xmlns {
+		if ns == namespace && prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) > 0 {
+		sort.Strings(prefixes)
+		return prefixes[0] + ":" + local
+	}
+
+	if t.c.Xmlns == nil {
+		t.c.Xmlns = make(map[string]string)
+	}
+	prefix := "ref"
+	for i := 1; t.c.Xmlns[prefix] != ""; i++ {
+		prefix = fmt.Sprintf("ref%d", i)
+	}
+	t.c.Xmlns[prefix] = namespace
+	return prefix + ":" + local
+}
+
 func (t *traverser) traverseAttributes(attrs []*XSDAttribute) {
 	for _, attr := range attrs {
 		t.traverseAttribute(attr)
@@ -65,14 +310,25 @@ func (t *traverser) traverseAttributes(attrs []*XSDAttribute) {
 
 func (t *traverser) traverseAttribute(attr *XSDAttribute) {
 	if attr.Ref != "" {
+		if ref := t.qname(attr.Ref); ref.Space == soapEncNamespace {
+			// Built-in SOAP encoding attributes, e.g. soapenc:arrayType.
+			attr.Name = ref.Local
+			attr.Type = "string"
+			return
+		}
+
 		refAttr := t.getGlobalAttribute(attr.Ref)
 		if refAttr != nil && refAttr.Ref == "" {
 			t.traverseAttribute(refAttr)
 			attr.Name = refAttr.Name
 			attr.Type = refAttr.Type
+			attr.namespace = t.qname(attr.Ref).Space
 			if attr.Fixed == "" {
 				attr.Fixed = refAttr.Fixed
 			}
+			if attr.Default == "" {
+				attr.Default = refAttr.Default
+			}
 		}
 	} else if attr.Type == "" {
 		if attr.SimpleType != nil {
@@ -98,11 +354,13 @@ func (t *traverser) getGlobalAttribute(name string) *XSDAttribute {
 	return nil
 }
 
-// qname resolves QName into xml.Name.
+// qname resolves QName into xml.Name. Unprefixed names resolve as with
+// resolveNamespace.
 func (t *traverser) qname(name string) (qname xml.Name) {
 	x := strings.SplitN(name, ":", 2)
 	if len(x) == 1 {
 		qname.Local = x[0]
+		qname.Space = resolveNamespace(t.c, name)
 	} else {
 		qname.Local = x[1]
 		qname.Space = x[0]
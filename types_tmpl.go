@@ -6,21 +6,91 @@ package gowsdl
 
 var typesTmpl = `
 {{define "SimpleType"}}
-	{{$type := replaceReservedWords .Name | makePublic}}
+	{{$type := typeName .Name}}
 	{{if .Doc}} {{.Doc | comment}} {{end}}
 	{{if ne .List.ItemType ""}}
-		type {{$type}} []{{toGoType .List.ItemType }}
-	{{else if ne .Union.MemberTypes ""}}
-		type {{$type}} string
-	{{else if .Union.SimpleType}}
+		type {{$type}} []{{toGoType .List.ItemType | removePointerFromType}}
+
+		func (l {{$type}}) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+			s, err := soap.MarshalList(l)
+			if err != nil {
+				return err
+			}
+			return e.EncodeElement(s, start)
+		}
+
+		func (l *{{$type}}) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+			var s string
+			if err := d.DecodeElement(&s, &start); err != nil {
+				return err
+			}
+			return soap.ParseList(s, l)
+		}
+
+		func (l {{$type}}) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+			s, err := soap.MarshalList(l)
+			return xml.Attr{Name: name, Value: s}, err
+		}
+
+		func (l *{{$type}}) UnmarshalXMLAttr(attr xml.Attr) error {
+			return soap.ParseList(attr.Value, l)
+		}
+	{{else if or (ne .Union.MemberTypes "") .Union.SimpleType}}
+		// {{$type}} holds the lexical value of an xsd:union, which is not decoded
+		// into one of its member types, so that a value of any of them is
+		// accepted.
 		type {{$type}} string
+	{{else if intEnum .Restriction}}
+		type {{$type}} int
 	{{else if .Restriction.Base}}
 		type {{$type}} {{toGoType .Restriction.Base}}
     {{else}}
 		type {{$type}} interface{}
 	{{end}}
 
-	{{if .Restriction.Enumeration}}
+	{{if intEnum .Restriction}}
+		{{$values := printf "%sValues" (makePrivate $type)}}
+		const (
+			{{- range $i, $enum := .Restriction.Enumeration}}
+				{{if .Doc}} {{.Doc | comment}} {{end}}
+				{{$type}}{{replaceReservedWords .Value | makePublic}}{{if eq $i 0}} {{$type}} = iota + 1{{end}}
+			{{- end}}
+		)
+
+		var {{$values}} = map[{{$type}}]string{
+			{{- range .Restriction.Enumeration}}
+				{{$type}}{{replaceReservedWords .Value | makePublic}}: "{{goString .Value}}",
+			{{- end}}
+		}
+
+		// String returns the XSD value of v.
+		func (v {{$type}}) String() string {
+			if s, ok := {{$values}}[v]; ok {
+				return s
+			}
+			return fmt.Sprintf("{{$type}}(%d)", int(v))
+		}
+
+		// MarshalText implements encoding.TextMarshaler.
+		func (v {{$type}}) MarshalText() ([]byte, error) {
+			s, ok := {{$values}}[v]
+			if !ok {
+				return nil, fmt.Errorf("invalid {{$type}} %d", int(v))
+			}
+			return []byte(s), nil
+		}
+
+		// UnmarshalText implements encoding.TextUnmarshaler.
+		func (v *{{$type}}) UnmarshalText(text []byte) error {
+			for value, s := range {{$values}} {
+				if s == string(text) {
+					*v = value
+					return nil
+				}
+			}
+			return fmt.Errorf("invalid {{$type}} %q", text)
+		}
+	{{else if .Restriction.Enumeration}}
 	const (
 		{{with .Restriction}}
 			{{range .Enumeration}}
@@ -29,11 +99,118 @@ var typesTmpl = `
 		{{end}}
 	)
 	{{end}}
+
+	{{with facets .Restriction}}
+		{{$pattern := printf "%sPattern" (makePrivate $type)}}
+		{{if .Pattern}}
+			var {{$pattern}} = regexp.MustCompile({{printf "%q" .Pattern}})
+		{{end}}
+
+		// Validate checks the value against the facets of {{$type}}.
+		func (v {{$type}}) Validate() error {
+			{{if .URI}}
+				if err := soap.AnyURI(v).Validate(); err != nil {
+					return err
+				}
+			{{end}}
+			{{if .Length}}
+				if n := utf8.RuneCountInString(string(v)); n != {{.Length}} {
+					return fmt.Errorf("%q has %d characters, violating length {{.Length}}", v, n)
+				}
+			{{end}}
+			{{if .MinLength}}
+				if n := utf8.RuneCountInString(string(v)); n < {{.MinLength}} {
+					return fmt.Errorf("%q has %d characters, violating minLength {{.MinLength}}", v, n)
+				}
+			{{end}}
+			{{if .MaxLength}}
+				if n := utf8.RuneCountInString(string(v)); n > {{.MaxLength}} {
+					return fmt.Errorf("%q has %d characters, violating maxLength {{.MaxLength}}", v, n)
+				}
+			{{end}}
+			{{if .Pattern}}
+				if !{{$pattern}}.MatchString(string(v)) {
+					return fmt.Errorf("%q does not match pattern %s", v, {{$pattern}})
+				}
+			{{end}}
+			{{if .MinInclusive}}
+				if v < {{.MinInclusive}} {
+					return fmt.Errorf("%v is less than minInclusive {{.MinInclusive}}", v)
+				}
+			{{end}}
+			{{if .MaxInclusive}}
+				if v > {{.MaxInclusive}} {
+					return fmt.Errorf("%v is greater than maxInclusive {{.MaxInclusive}}", v)
+				}
+			{{end}}
+			return nil
+		}
+	{{end}}
+{{end}}
+
+{{define "Validate"}}
+	// Validate checks the fields of {{.Name}} against the facets of their types.
+	func (t *{{.Name}}) Validate() error {
+		{{range .Fields}}
+			{{if .Base}}
+				if t.{{.Name}} != nil {
+					if err := t.{{.Name}}.Validate(); err != nil {
+						return err
+					}
+				}
+			{{else if .Slice}}
+				for i, v := range t.{{.Name}} {
+					{{- if not .Value}}
+					if v == nil {
+						continue
+					}
+					{{- end}}
+					if err := v.Validate(); err != nil {
+						return fmt.Errorf("{{.XMLName}}[%d]: %v", i, err)
+					}
+				}
+			{{else if .Value}}
+				if err := t.{{.Name}}.Validate(); err != nil {
+					return fmt.Errorf("{{.XMLName}}: %v", err)
+				}
+			{{else}}
+				if t.{{.Name}} != nil {
+					if err := t.{{.Name}}.Validate(); err != nil {
+						return fmt.Errorf("{{.XMLName}}: %v", err)
+					}
+				}
+			{{end}}
+		{{end}}
+		return nil
+	}
+{{end}}
+
+{{define "Accessors"}}
+	{{$name := .Name}}
+	{{range .Accessors}}
+		// Get{{.Field}} returns the value of {{.Field}}, or the zero value if it is nil.
+		func (t *{{$name}}) Get{{.Field}}() (v {{.Type}}) {
+			if t != nil && t.{{.Field}} != nil {
+				v = *t.{{.Field}}
+			}
+			return v
+		}
+
+		// Set{{.Field}} sets {{.Field}} to a copy of v.
+		func (t *{{$name}}) Set{{.Field}}(v {{.Type}}) {
+			t.{{.Field}} = &v
+		}
+	{{end}}
 {{end}}
 
 {{define "ComplexContent"}}
 	{{$baseType := toGoType .Extension.Base}}
-	{{ if $baseType }}
+	{{if eq $baseType "soap.AnyXML"}}
+		{{/* Embedding soap.AnyXML would promote its MarshalXML method. */}}
+		{{if not .Extension.Sequence}}
+			InnerXML []byte ` + "`" + `xml:",innerxml"{{jsonTag "InnerXML"}}` + "`" + `
+		{{end}}
+	{{else if $baseType}}
 		{{$baseType}}
 	{{end}}
 
@@ -44,21 +221,69 @@ var typesTmpl = `
 {{define "Attributes"}}
 	{{range .}}
 		{{if .Doc}} {{.Doc | comment}} {{end}}
-		{{ if ne .Type "" }}
-			{{ normalize .Name | makeFieldPublic}} {{toGoType .Type}} ` + "`" + `xml:"{{.Name}},attr,omitempty" json:"{{.Name}},omitempty"` + "`" + `
+		{{ $fixedType := fixedType . }}
+		{{ if $fixedType }}
+			{{ normalize .Name | makeFieldPublic}} {{$fixedType}} ` + "`" + `xml:"{{attributeNS .}}{{.Name}},attr"{{jsonTag .Name}}` + "`" + `
+		{{ else if ne .Type "" }}
+			{{ normalize .Name | makeFieldPublic}} {{toGoType .Type}} ` + "`" + `xml:"{{attributeNS .}}{{.Name}},attr,omitempty"{{jsonTag .Name}}` + "`" + `
 		{{ else }}
-			{{ normalize .Name | makeFieldPublic}} string ` + "`" + `xml:"{{.Name}},attr,omitempty" json:"{{.Name}},omitempty"` + "`" + `
+			{{ normalize .Name | makeFieldPublic}} string ` + "`" + `xml:"{{attributeNS .}}{{.Name}},attr,omitempty"{{jsonTag .Name}}` + "`" + `
 		{{ end }}
 	{{end}}
 {{end}}
 
+{{define "AttributeExtras"}}
+	{{$name := .Name}}
+	{{range .Fixed}}
+		// {{.TypeName}} is the {{.Name}} attribute of {{$name}}, fixed to "{{goString .Value}}".
+		type {{.TypeName}} string
+
+		// MarshalXMLAttr implements xml.MarshalerAttr, always encoding the fixed value.
+		func ({{.TypeName}}) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+			return xml.Attr{Name: name, Value: "{{goString .Value}}"}, nil
+		}
+
+		// UnmarshalXMLAttr implements xml.UnmarshalerAttr, rejecting other values than the fixed one.
+		func (v *{{.TypeName}}) UnmarshalXMLAttr(attr xml.Attr) error {
+			if attr.Value != "{{goString .Value}}" {
+				return xml.UnmarshalError("attribute {{.Name}} of {{$name}} is fixed to \"{{goString .Value}}\", got \"" + attr.Value + "\"")
+			}
+			*v = {{.TypeName}}(attr.Value)
+			return nil
+		}
+	{{end}}
+
+	{{if or .Defaults .XMLName}}
+		{{if .Defaults}}
+			// New{{$name}} returns a new {{$name}} whose attributes are set to their
+			// defaults, which decoding into it keeps for the attributes that are absent.
+			{{- if .XMLName}}
+				// Its XMLName is set to the {{.XMLName.Local}} element of the request.
+			{{- end}}
+		{{- else}}
+			// New{{$name}} returns a new {{$name}} whose XMLName is set to the
+			// {{.XMLName.Local}} element of the request, in its namespace.
+		{{- end}}
+		func New{{$name}}() *{{$name}} {
+			return &{{$name}}{
+				{{- with .XMLName}}
+					XMLName: xml.Name{Space: "{{goString .Space}}", Local: "{{goString .Local}}"},
+				{{- end}}
+				{{- range .Defaults}}
+					{{.Field}}: {{.Literal}},
+				{{- end}}
+			}
+		}
+	{{end}}
+{{end}}
+
 {{define "SimpleContent"}}
-	Value {{toGoType .Extension.Base}} ` + "`xml:\",chardata\" json:\"-,\"`" + `
+	Value {{toGoType .Extension.Base}} ` + "`" + `xml:",chardata"{{jsonTag "-,"}}` + "`" + `
 	{{template "Attributes" .Extension.Attributes}}
 {{end}}
 
 {{define "ComplexTypeInline"}}
-	{{replaceReservedWords .Name | makePublic}} {{if eq .MaxOccurs "unbounded"}}[]{{end}}struct {
+	{{replaceReservedWords .Name | makePublic}} {{if isRepeated .MaxOccurs}}[]{{end}}struct {
 	{{with .ComplexType}}
 		{{if ne .ComplexContent.Extension.Base ""}}
 			{{template "ComplexContent" .ComplexContent}}
@@ -66,41 +291,41 @@ var typesTmpl = `
 			{{template "SimpleContent" .SimpleContent}}
 		{{else}}
 			{{template "Elements" .Sequence}}
+			{{template "Any" .Any}}
 			{{template "Elements" .Choice}}
-			{{template "Elements" .SequenceChoice}}
 			{{template "Elements" .All}}
 			{{template "Attributes" .Attributes}}
 		{{end}}
 	{{end}}
-	} ` + "`" + `xml:"{{.Name}},omitempty" json:"{{.Name}},omitempty"` + "`" + `
+	} ` + "`" + `xml:"{{elementNS .}}{{.Name}}{{omitEmpty .}}"{{jsonTag .Name}}` + "`" + `
 {{end}}
 
 {{define "Elements"}}
 	{{range .}}
 		{{if ne .Ref ""}}
-			{{removeNS .Ref | replaceReservedWords  | makePublic}} {{if eq .MaxOccurs "unbounded"}}[]{{end}}{{.Ref | toGoType}} ` + "`" + `xml:"{{.Ref | removeNS}},omitempty" json:"{{.Ref | removeNS}},omitempty"` + "`" + `
+			{{removeNS .Ref | replaceReservedWords  | makePublic}} {{elementType (toGoType .Ref) .}} ` + "`" + `xml:"{{.Ref | removeNS}}{{omitEmpty .}}"{{.Ref | removeNS | jsonTag}}` + "`" + `
 		{{else}}
 		{{if not .Type}}
 			{{if .SimpleType}}
 				{{if .Doc}} {{.Doc | comment}} {{end}}
 				{{if ne .SimpleType.List.ItemType ""}}
-					{{ normalize .Name | makeFieldPublic}} []{{toGoType .SimpleType.List.ItemType}} ` + "`" + `xml:"{{.Name}},omitempty" json:"{{.Name}},omitempty"` + "`" + `
+					{{ normalize .Name | makeFieldPublic}} []{{toGoType .SimpleType.List.ItemType}} ` + "`" + `xml:"{{elementNS .}}{{.Name}}{{omitEmpty .}}"{{jsonTag .Name}}` + "`" + `
 				{{else}}
-					{{ normalize .Name | makeFieldPublic}} {{toGoType .SimpleType.Restriction.Base}} ` + "`" + `xml:"{{.Name}},omitempty" json:"{{.Name}},omitempty"` + "`" + `
+					{{ normalize .Name | makeFieldPublic}} {{elementType (toGoType .SimpleType.Restriction.Base) .}} ` + "`" + `xml:"{{elementNS .}}{{.Name}}{{omitEmpty .}}"{{jsonTag .Name}}` + "`" + `
 				{{end}}
 			{{else}}
 				{{template "ComplexTypeInline" .}}
 			{{end}}
 		{{else}}
 			{{if .Doc}}{{.Doc | comment}} {{end}}
-			{{replaceAttrReservedWords .Name | makeFieldPublic}} {{if eq .MaxOccurs "unbounded"}}[]{{end}}{{.Type | toGoType}} ` + "`" + `xml:"{{.Name}},omitempty" json:"{{.Name}},omitempty"` + "`" + ` {{end}}
+			{{replaceAttrReservedWords .Name | makeFieldPublic}} {{elementType (fieldType .Type) .}} ` + "`" + `xml:"{{elementNS .}}{{.Name}}{{omitEmpty .}}"{{jsonTag .Name}}` + "`" + ` {{end}}
 		{{end}}
 	{{end}}
 {{end}}
 
 {{define "Any"}}
-	{{range .}}
-		Items     []string ` + "`" + `xml:",any" json:"items,omitempty"` + "`" + `
+	{{if .}}
+		Items []soap.AnyXML ` + "`" + `xml:",any"{{jsonTag "items"}}` + "`" + `
 	{{end}}
 {{end}}
 
@@ -116,8 +341,8 @@ var typesTmpl = `
 		{{if not .Type}}
 			{{/* ComplexTypeLocal */}}
 			{{with .ComplexType}}
-				type {{$name | replaceReservedWords | makePublic}} struct {
-					XMLName xml.Name ` + "`xml:\"{{$targetNamespace}} {{$name}}\"`" + `
+				type {{typeName $name}} struct {
+					XMLName xml.Name ` + "`" + `xml:"{{$targetNamespace}} {{$name}}"{{jsonTag "-"}}` + "`" + `
 					{{if ne .ComplexContent.Extension.Base ""}}
 						{{template "ComplexContent" .ComplexContent}}
 					{{else if ne .SimpleContent.Extension.Base ""}}
@@ -126,29 +351,42 @@ var typesTmpl = `
 						{{template "Elements" .Sequence}}
 						{{template "Any" .Any}}
 						{{template "Elements" .Choice}}
-						{{template "Elements" .SequenceChoice}}
 						{{template "Elements" .All}}
 						{{template "Attributes" .Attributes}}
 					{{end}}
 				}
+
+				{{with validation (typeName $name) .}}
+					{{template "Validate" .}}
+				{{end}}
+
+				{{with accessors (typeName $name) .}}
+					{{template "Accessors" .}}
+				{{end}}
+
+				{{with attributeExtras (typeName $name) . (requestElement $name)}}
+					{{template "AttributeExtras" .}}
+				{{end}}
 			{{end}}
 		{{else}}
-			{{if ne ($name | replaceReservedWords | makePublic) (toGoType .Type | removePointerFromType)}}
-				type {{$name | replaceReservedWords | makePublic}} {{toGoType .Type | removePointerFromType}}
+			{{if ne (typeName $name) (toGoType .Type | removePointerFromType)}}
+				type {{typeName $name}} {{toGoType .Type | removePointerFromType}}
 			{{end}}
 		{{end}}
 	{{end}}
 
 	{{range .ComplexTypes}}
 		{{/* ComplexTypeGlobal */}}
-		{{$name := replaceReservedWords .Name | makePublic}}
-		{{if eq (toGoType .SimpleContent.Extension.Base) "string"}}
+		{{$name := typeName .Name}}
+		{{if and (eq (toGoType .SimpleContent.Extension.Base) "string") (not .SimpleContent.Extension.Attributes)}}
 			type {{$name}} string
 		{{else}}
 			type {{$name}} struct {
 				{{$typ := findNameByType .Name}}
-				{{if ne $name $typ}}
-					XMLName xml.Name ` + "`xml:\"{{$targetNamespace}} {{$typ}}\"`" + `
+				{{if ne (replaceReservedWords .Name | makePublic) $typ}}
+					XMLName xml.Name ` + "`" + `xml:"{{$targetNamespace}} {{$typ}}"{{jsonTag "-"}}` + "`" + `
+				{{else if requestType .Name}}
+					XMLName xml.Name {{if jsonTag "-"}}` + "`" + `json:"-"` + "`" + `{{end}}
 				{{end}}
 				
 				{{if ne .ComplexContent.Extension.Base ""}}
@@ -159,11 +397,51 @@ var typesTmpl = `
 					{{template "Elements" .Sequence}}
 					{{template "Any" .Any}}
 					{{template "Elements" .Choice}}
-					{{template "Elements" .SequenceChoice}}
 					{{template "Elements" .All}}
 					{{template "Attributes" .Attributes}}
 				{{end}}
 			}
+
+			{{with validation $name .}}
+				{{template "Validate" .}}
+			{{end}}
+
+			{{with accessors $name .}}
+				{{template "Accessors" .}}
+			{{end}}
+
+			{{with attributeExtras $name . (requestType .Name)}}
+				{{template "AttributeExtras" .}}
+			{{end}}
+
+			{{with derivedTypes .Name}}
+				// {{$name}}Value holds a value of {{$name}} or of a type derived from it, such
+				// as {{index . 0}}, picked by the xsi:type attribute of its element. Further
+				// derived types are registered with soap.RegisterType.
+				type {{$name}}Value struct {
+					Value interface{}
+				}
+
+				// UnmarshalXML implements xml.Unmarshaler.
+				func (v *{{$name}}Value) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+					value, err := soap.DecodeType(d, start, func() interface{} { return new({{$name}}) })
+					if err != nil {
+						return err
+					}
+					v.Value = value
+					return nil
+				}
+
+				// MarshalXML implements xml.Marshaler.
+				func (v {{$name}}Value) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+					return soap.EncodeType(e, start, v.Value)
+				}
+			{{end}}
+			{{if xsiType .Name}}
+				func init() {
+					soap.RegisterType("{{$targetNamespace}}", "{{.Name}}", func() interface{} { return new({{$name}}) })
+				}
+			{{end}}
 		{{end}}	
 	{{end}}
 {{end}}
@@ -0,0 +1,230 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gowsdl
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// facets holds the restriction facets of a simple type that are checked by
+// its generated Validate method. Facets that do not apply to the Go type the
+// simple type is generated as are left empty.
+type facets struct {
+	Length       string
+	MinLength    string
+	MaxLength    string
+	Pattern      string
+	MinInclusive string
+	MaxInclusive string
+	// URI is set for restrictions of anyURI, whose values must parse as URI
+	// references.
+	URI bool
+}
+
+// validatedField is a field of a complex type whose type has a Validate method.
+type validatedField struct {
+	Name    string
+	XMLName string
+	Slice   bool
+	Base    bool
+	// Value is set for fields that are not pointers, as anyURI fields.
+	Value bool
+}
+
+// validatedType is a complex type generated with a Validate method.
+type validatedType struct {
+	Name   string
+	Fields []validatedField
+}
+
+var integerGoTypes = map[string]bool{
+	"int8": true, "int16": true, "int32": true, "int64": true,
+	"byte": true, "uint16": true, "uint32": true, "uint64": true,
+}
+
+// restrictionFacets returns the facets of restriction that can be validated,
+// or nil if there are none.
+func restrictionFacets(restriction XSDRestriction) *facets {
+	goType := toGoType(restriction.Base)
+	f := new(facets)
+
+	f.URI = goType == "soap.AnyURI"
+	if goType == "string" || goType == "soap.AnyURI" || goType == "NCName" {
+		f.Length = nonNegativeInt(restriction.Length.Value)
+		f.MinLength = nonNegativeInt(restriction.MinLength.Value)
+		f.MaxLength = nonNegativeInt(restriction.MaxLength.Value)
+
+		if pattern := restriction.Pattern.Value; pattern != "" {
+			// XSD patterns always match the whole value.
+			pattern = "^(?:" + pattern + ")$"
+			if _, err := regexp.Compile(pattern); err != nil {
+				log.Printf("[WARN] pattern %q is not supported and won't be validated: %v", restriction.Pattern.Value, err)
+			} else {
+				f.Pattern = pattern
+			}
+		}
+	}
+
+	if integerGoTypes[goType] || goType == "float32" || goType == "float64" {
+		f.MinInclusive = numericLiteral(restriction.MinInclusive.Value, goType)
+		f.MaxInclusive = numericLiteral(restriction.MaxInclusive.Value, goType)
+	}
+
+	if *f == (facets{}) {
+		return nil
+	}
+	return f
+}
+
+// intEnum reports whether restriction is generated as an int backed enum.
+func (g *GoWSDL) intEnum(restriction XSDRestriction) bool {
+	return g.enumKind == EnumKindInt && len(restriction.Enumeration) > 0 && toGoType(restriction.Base) == "string"
+}
+
+func nonNegativeInt(value string) string {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.ParseUint(value, 10, 31); err == nil {
+		return strconv.FormatUint(n, 10)
+	}
+	return ""
+}
+
+// numericLiteral returns value if it is a valid constant of goType.
+func numericLiteral(value, goType string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	var err error
+	switch {
+	case integerGoTypes[goType] && strings.HasPrefix(goType, "int"):
+		_, err = strconv.ParseInt(value, 10, 64)
+	case integerGoTypes[goType]:
+		_, err = strconv.ParseUint(value, 10, 64)
+	default:
+		_, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// validatedTypes returns the types that are generated with a Validate method,
+// keyed by namespace and XSD name: simple types with facets, and complex types
+// with a field of a validated type.
+func (g *GoWSDL) validatedTypes(schemas []*XSDSchema) map[string]map[string]bool {
+	validated := make(map[string]map[string]bool)
+	mark := func(namespace, name string) {
+		if validated[namespace] == nil {
+			validated[namespace] = make(map[string]bool)
+		}
+		validated[namespace][name] = true
+	}
+
+	for _, schema := range schemas {
+		for _, st := range schema.SimpleType {
+			if !g.intEnum(st.Restriction) && restrictionFacets(st.Restriction) != nil {
+				mark(schema.TargetNamespace, st.Name)
+			}
+		}
+	}
+
+	// Complex types may contain one another, so repeat until no more types are
+	// found.
+	for changed := true; changed; {
+		changed = false
+		for _, schema := range schemas {
+			ns := schema.TargetNamespace
+			for _, ct := range schema.ComplexTypes {
+				if !validated[ns][ct.Name] && len(g.validatedFields(schema, ct, validated)) > 0 {
+					mark(ns, ct.Name)
+					changed = true
+				}
+			}
+			for _, el := range schema.Elements {
+				if el.Type != "" || el.ComplexType == nil || validated[ns][el.Name] {
+					continue
+				}
+				if len(g.validatedFields(schema, el.ComplexType, validated)) > 0 {
+					mark(ns, el.Name)
+					changed = true
+				}
+			}
+		}
+	}
+
+	return validated
+}
+
+// validatedFields returns the fields of the struct generated for ct, declared
+// within schema, that have a Validate method.
+func (g *GoWSDL) validatedFields(schema *XSDSchema, ct *XSDComplexType, validated map[string]map[string]bool) []validatedField {
+	isValidated := func(qname string) bool {
+		return qname != "" && validated[resolveNamespace(schema, qname)][stripns(qname)]
+	}
+
+	// anyURI values are validated by their soap.AnyURI type.
+	isURI := func(qname string) bool {
+		return qname != "" && resolveNamespace(schema, qname) == xmlschema11 && toGoType(qname) == "soap.AnyURI"
+	}
+
+	var fields []validatedField
+	addElements := func(elements []*XSDElement) {
+		for _, el := range elements {
+			if el.Ref == "" && !isNillable(el) && (isValidated(el.Type) || isURI(el.Type)) {
+				fields = append(fields, validatedField{
+					Name:    makePublic(replaceAttrReservedWords(el.Name)),
+					XMLName: el.Name,
+					Slice:   isRepeated(el.MaxOccurs),
+					Value:   isURI(el.Type) && !strings.HasPrefix(elementType(toGoType(el.Type), el), "*"),
+				})
+			}
+		}
+	}
+	addAttributes := func(attributes []*XSDAttribute) {
+		for _, attr := range attributes {
+			if isValidated(attr.Type) || isURI(attr.Type) {
+				fields = append(fields, validatedField{
+					Name:    makePublic(normalize(attr.Name)),
+					XMLName: attr.Name,
+					Value:   isURI(attr.Type),
+				})
+			}
+		}
+	}
+
+	switch {
+	case ct.ComplexContent.Extension.Base != "":
+		ext := ct.ComplexContent.Extension
+		if isValidated(ext.Base) {
+			name := removePointerFromType(toGoType(ext.Base))
+			if renamed, ok := g.renames[resolveNamespace(schema, ext.Base)][stripns(ext.Base)]; ok {
+				name = renamed
+			}
+			fields = append(fields, validatedField{
+				Name:    name,
+				XMLName: stripns(ext.Base),
+				Base:    true,
+			})
+		}
+		for i := range ext.Sequence {
+			addElements([]*XSDElement{&ext.Sequence[i]})
+		}
+		addAttributes(ext.Attributes)
+	case ct.SimpleContent.Extension.Base != "":
+	default:
+		addElements(ct.Sequence)
+		addElements(ct.Choice)
+		addElements(ct.All)
+		addAttributes(ct.Attributes)
+	}
+
+	return fields
+}
@@ -6,25 +6,30 @@ package gowsdl
 
 import (
 	"encoding/xml"
+	"strconv"
+	"strings"
 )
 
 const xmlschema11 = "http://www.w3.org/2001/XMLSchema"
 
 // XSDSchema represents an entire Schema structure.
 type XSDSchema struct {
-	XMLName            xml.Name          `xml:"schema"`
-	Xmlns              map[string]string `xml:"-"`
-	Tns                string            `xml:"xmlns tns,attr"`
-	Xs                 string            `xml:"xmlns xs,attr"`
-	Version            string            `xml:"version,attr"`
-	TargetNamespace    string            `xml:"targetNamespace,attr"`
-	ElementFormDefault string            `xml:"elementFormDefault,attr"`
-	Includes           []*XSDInclude     `xml:"include"`
-	Imports            []*XSDImport      `xml:"import"`
-	Elements           []*XSDElement     `xml:"element"`
-	Attributes         []*XSDAttribute   `xml:"attribute"`
-	ComplexTypes       []*XSDComplexType `xml:"complexType"` //global
-	SimpleType         []*XSDSimpleType  `xml:"simpleType"`
+	XMLName              xml.Name             `xml:"schema"`
+	Xmlns                map[string]string    `xml:"-"`
+	Tns                  string               `xml:"xmlns tns,attr"`
+	Xs                   string               `xml:"xmlns xs,attr"`
+	Version              string               `xml:"version,attr"`
+	TargetNamespace      string               `xml:"targetNamespace,attr"`
+	ElementFormDefault   string               `xml:"elementFormDefault,attr"`
+	AttributeFormDefault string               `xml:"attributeFormDefault,attr"`
+	Includes             []*XSDInclude        `xml:"include"`
+	Imports              []*XSDImport         `xml:"import"`
+	Elements             []*XSDElement        `xml:"element"`
+	Attributes           []*XSDAttribute      `xml:"attribute"`
+	AttributeGroups      []*XSDAttributeGroup `xml:"attributeGroup"`
+	Groups               []*XSDGroup          `xml:"group"`
+	ComplexTypes         []*XSDComplexType    `xml:"complexType"` //global
+	SimpleType           []*XSDSimpleType     `xml:"simpleType"`
 }
 
 // UnmarshalXML implements interface xml.Unmarshaler for XSDSchema.
@@ -36,6 +41,11 @@ func (s *XSDSchema) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			s.Xmlns[attr.Name.Local] = attr.Value
 			continue
 		}
+		if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			// The default namespace, which unqualified QNames resolve to.
+			s.Xmlns[""] = attr.Value
+			continue
+		}
 
 		switch attr.Name.Local {
 		case "version":
@@ -44,6 +54,8 @@ func (s *XSDSchema) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			s.TargetNamespace = attr.Value
 		case "elementFormDefault":
 			s.ElementFormDefault = attr.Value
+		case "attributeFormDefault":
+			s.AttributeFormDefault = attr.Value
 		}
 	}
 
@@ -86,6 +98,18 @@ Loop:
 					return err
 				}
 				s.Attributes = append(s.Attributes, x)
+			case "attributeGroup":
+				x := new(XSDAttributeGroup)
+				if err := d.DecodeElement(x, &t); err != nil {
+					return err
+				}
+				s.AttributeGroups = append(s.AttributeGroups, x)
+			case "group":
+				x := new(XSDGroup)
+				if err := d.DecodeElement(x, &t); err != nil {
+					return err
+				}
+				s.Groups = append(s.Groups, x)
 			case "complexType":
 				x := new(XSDComplexType)
 				if err := d.DecodeElement(x, &t); err != nil {
@@ -107,6 +131,7 @@ Loop:
 		}
 	}
 
+	s.qualifyLocalDeclarations()
 	return nil
 }
 
@@ -124,17 +149,31 @@ type XSDImport struct {
 
 // XSDElement represents a Schema element.
 type XSDElement struct {
-	XMLName     xml.Name        `xml:"element"`
-	Name        string          `xml:"name,attr"`
-	Doc         string          `xml:"annotation>documentation"`
-	Nillable    bool            `xml:"nillable,attr"`
-	Type        string          `xml:"type,attr"`
-	Ref         string          `xml:"ref,attr"`
-	MinOccurs   string          `xml:"minOccurs,attr"`
-	MaxOccurs   string          `xml:"maxOccurs,attr"`
-	ComplexType *XSDComplexType `xml:"complexType"` //local
-	SimpleType  *XSDSimpleType  `xml:"simpleType"`
-	Groups      []*XSDGroup     `xml:"group"`
+	XMLName           xml.Name        `xml:"element"`
+	Name              string          `xml:"name,attr"`
+	Doc               string          `xml:"annotation>documentation"`
+	Nillable          bool            `xml:"nillable,attr"`
+	Type              string          `xml:"type,attr"`
+	Ref               string          `xml:"ref,attr"`
+	Default           string          `xml:"default,attr"`
+	MinOccurs         string          `xml:"minOccurs,attr"`
+	MaxOccurs         string          `xml:"maxOccurs,attr"`
+	ComplexType       *XSDComplexType `xml:"complexType"` //local
+	SimpleType        *XSDSimpleType  `xml:"simpleType"`
+	Groups            []*XSDGroup     `xml:"group"`
+	Abstract          bool            `xml:"abstract,attr"`
+	SubstitutionGroup string          `xml:"substitutionGroup,attr"`
+	Form              string          `xml:"form,attr"`
+
+	// groupRef is set for the placeholders of model group references, which
+	// the traverser replaces with the elements of the group.
+	groupRef *XSDGroup
+	// choice is set for the elements of choices, only one of which appears
+	// whatever their minOccurs.
+	choice bool
+	// namespace is the namespace of qualified elements, and is empty for
+	// unqualified ones.
+	namespace string
 }
 
 // XSDElement represents a Schema element.
@@ -147,36 +186,75 @@ type XSDAny struct {
 	ProcessContents string   `xml:"processContents,attr"`
 }
 
-// XSDComplexType represents a Schema complex type.
+// XSDComplexType represents a Schema complex type. The elements of the
+// choices nested in its sequence are part of Sequence, in document order, so
+// that the generated fields marshal in the order of the schema, and
+// SequenceChoice is left empty.
 type XSDComplexType struct {
-	XMLName        xml.Name          `xml:"complexType"`
-	Abstract       bool              `xml:"abstract,attr"`
-	Name           string            `xml:"name,attr"`
-	Mixed          bool              `xml:"mixed,attr"`
-	Sequence       []*XSDElement     `xml:"sequence>element"`
-	Choice         []*XSDElement     `xml:"choice>element"`
-	SequenceChoice []*XSDElement     `xml:"sequence>choice>element"`
-	All            []*XSDElement     `xml:"all>element"`
-	ComplexContent XSDComplexContent `xml:"complexContent"`
-	SimpleContent  XSDSimpleContent  `xml:"simpleContent"`
-	Attributes     []*XSDAttribute   `xml:"attribute"`
-	Any            []*XSDAny         `xml:"sequence>any"`
+	XMLName         xml.Name             `xml:"complexType"`
+	Abstract        bool                 `xml:"abstract,attr"`
+	Name            string               `xml:"name,attr"`
+	Mixed           bool                 `xml:"mixed,attr"`
+	Sequence        []*XSDElement        `xml:"sequence>element"`
+	Choice          []*XSDElement        `xml:"choice>element"`
+	SequenceChoice  []*XSDElement        `xml:"sequence>choice>element"`
+	All             []*XSDElement        `xml:"all>element"`
+	ComplexContent  XSDComplexContent    `xml:"complexContent"`
+	SimpleContent   XSDSimpleContent     `xml:"simpleContent"`
+	Attributes      []*XSDAttribute      `xml:"attribute"`
+	AttributeGroups []*XSDAttributeGroup `xml:"attributeGroup"`
+	Any             []*XSDAny            `xml:"sequence>any"`
 }
 
 // XSDGroup element is used to define a group of elements to be used in complex type definitions.
 type XSDGroup struct {
-	Name     string       `xml:"name,attr"`
-	Ref      string       `xml:"ref,attr"`
-	Sequence []XSDElement `xml:"sequence>element"`
-	Choice   []XSDElement `xml:"choice>element"`
-	All      []XSDElement `xml:"all>element"`
+	Name      string        `xml:"name,attr"`
+	Ref       string        `xml:"ref,attr"`
+	MinOccurs string        `xml:"minOccurs,attr"`
+	MaxOccurs string        `xml:"maxOccurs,attr"`
+	Sequence  []*XSDElement `xml:"sequence>element"`
+	Choice    []*XSDElement `xml:"choice>element"`
+	All       []*XSDElement `xml:"all>element"`
+}
+
+// UnmarshalXML implements interface xml.Unmarshaler for XSDGroup, decoding its
+// model group like the one of a complex type.
+func (g *XSDGroup) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type Group XSDGroup
+	var content struct {
+		Group
+		Sequence *xsdModelGroup `xml:"sequence"`
+		Choice   *xsdModelGroup `xml:"choice"`
+		All      *xsdModelGroup `xml:"all"`
+	}
+	if err := d.DecodeElement(&content, &start); err != nil {
+		return err
+	}
+
+	*g = XSDGroup(content.Group)
+	g.Sequence = content.Sequence.elements(false)
+	g.Choice = choiceElements(content.Choice.elements(false))
+	g.All = content.All.elements(false)
+	return nil
+}
+
+// elements returns the elements of the model group of g.
+func (g *XSDGroup) elements() []*XSDElement {
+	elements := append(append([]*XSDElement{}, g.Sequence...), g.Choice...)
+	return append(elements, g.All...)
+}
+
+// groupRefElement returns the placeholder of a reference to a model group.
+func groupRefElement(ref *XSDGroup) *XSDElement {
+	return &XSDElement{MinOccurs: ref.MinOccurs, MaxOccurs: ref.MaxOccurs, groupRef: ref}
 }
 
 // XSDComplexContent element defines extensions or restrictions on a complex
 // type that contains mixed content or elements only.
 type XSDComplexContent struct {
-	XMLName   xml.Name     `xml:"complexContent"`
-	Extension XSDExtension `xml:"extension"`
+	XMLName     xml.Name              `xml:"complexContent"`
+	Extension   XSDExtension          `xml:"extension"`
+	Restriction XSDComplexRestriction `xml:"restriction"`
 }
 
 // XSDSimpleContent element contains extensions or restrictions on a text-only
@@ -188,10 +266,238 @@ type XSDSimpleContent struct {
 
 // XSDExtension element extends an existing simpleType or complexType element.
 type XSDExtension struct {
-	XMLName    xml.Name        `xml:"extension"`
-	Base       string          `xml:"base,attr"`
-	Attributes []*XSDAttribute `xml:"attribute"`
-	Sequence   []XSDElement    `xml:"sequence>element"`
+	XMLName         xml.Name             `xml:"extension"`
+	Base            string               `xml:"base,attr"`
+	Attributes      []*XSDAttribute      `xml:"attribute"`
+	AttributeGroups []*XSDAttributeGroup `xml:"attributeGroup"`
+	Sequence        []XSDElement         `xml:"sequence>element"`
+}
+
+// XSDComplexRestriction element restricts the content model of a complex type.
+type XSDComplexRestriction struct {
+	Base            string               `xml:"base,attr"`
+	Attributes      []*XSDAttribute      `xml:"attribute"`
+	AttributeGroups []*XSDAttributeGroup `xml:"attributeGroup"`
+	Sequence        []XSDElement         `xml:"sequence>element"`
+}
+
+// UnmarshalXML implements interface xml.Unmarshaler for XSDComplexType. Its
+// model groups are decoded with their occurrence bounds, as the elements of a
+// repeated sequence or choice repeat with it.
+func (ct *XSDComplexType) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type ComplexType XSDComplexType
+	var content struct {
+		ComplexType
+		Sequence *xsdModelGroup `xml:"sequence"`
+		Choice   *xsdModelGroup `xml:"choice"`
+		All      *xsdModelGroup `xml:"all"`
+		Group    *XSDGroup      `xml:"group"`
+	}
+	if err := d.DecodeElement(&content, &start); err != nil {
+		return err
+	}
+
+	*ct = XSDComplexType(content.ComplexType)
+	ct.Sequence = content.Sequence.elements(false)
+	if content.Group != nil {
+		ct.Sequence = append(ct.Sequence, groupRefElement(content.Group))
+	}
+	ct.Choice = choiceElements(content.Choice.elements(false))
+	ct.All = content.All.elements(false)
+	if content.Sequence != nil {
+		ct.Any = content.Sequence.Any
+	}
+	return nil
+}
+
+// UnmarshalXML implements interface xml.Unmarshaler for XSDExtension, decoding
+// its sequence with its occurrence bounds.
+func (ext *XSDExtension) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type Extension XSDExtension
+	var content struct {
+		Extension
+		Sequence *xsdModelGroup `xml:"sequence"`
+		Group    *XSDGroup      `xml:"group"`
+	}
+	if err := d.DecodeElement(&content, &start); err != nil {
+		return err
+	}
+
+	*ext = XSDExtension(content.Extension)
+	sequence := content.Sequence.elements(false)
+	if content.Group != nil {
+		sequence = append(sequence, groupRefElement(content.Group))
+	}
+	ext.Sequence = elementValues(sequence)
+	return nil
+}
+
+// UnmarshalXML implements interface xml.Unmarshaler for XSDComplexRestriction,
+// decoding its sequence with its occurrence bounds.
+func (r *XSDComplexRestriction) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type Restriction XSDComplexRestriction
+	var content struct {
+		Restriction
+		Sequence *xsdModelGroup `xml:"sequence"`
+	}
+	if err := d.DecodeElement(&content, &start); err != nil {
+		return err
+	}
+
+	*r = XSDComplexRestriction(content.Restriction)
+	r.Sequence = elementValues(content.Sequence.elements(false))
+	return nil
+}
+
+// xsdModelGroup is a sequence, choice or all model group, decoded along with
+// its occurrence bounds, which apply to each of its elements.
+type xsdModelGroup struct {
+	MinOccurs string
+	MaxOccurs string
+	// Elements holds the elements of the group in document order, including
+	// those of its nested sequences and choices and the placeholders of group
+	// references.
+	Elements []*XSDElement
+	Any      []*XSDAny
+}
+
+// UnmarshalXML implements interface xml.Unmarshaler for xsdModelGroup.
+func (g *xsdModelGroup) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Space != "" {
+			continue
+		}
+		switch attr.Name.Local {
+		case "minOccurs":
+			g.MinOccurs = attr.Value
+		case "maxOccurs":
+			g.MaxOccurs = attr.Value
+		}
+	}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "element":
+				x := new(XSDElement)
+				if err := d.DecodeElement(x, &t); err != nil {
+					return err
+				}
+				g.Elements = append(g.Elements, x)
+			case "group":
+				x := new(XSDGroup)
+				if err := d.DecodeElement(x, &t); err != nil {
+					return err
+				}
+				g.Elements = append(g.Elements, groupRefElement(x))
+			case "sequence":
+				x := new(xsdModelGroup)
+				if err := d.DecodeElement(x, &t); err != nil {
+					return err
+				}
+				g.Elements = append(g.Elements, x.elements(false)...)
+				g.Any = append(g.Any, x.Any...)
+			case "choice":
+				x := new(xsdModelGroup)
+				if err := d.DecodeElement(x, &t); err != nil {
+					return err
+				}
+				g.Elements = append(g.Elements, choiceElements(x.elements(false))...)
+				g.Any = append(g.Any, x.Any...)
+			case "any":
+				x := new(XSDAny)
+				if err := d.DecodeElement(x, &t); err != nil {
+					return err
+				}
+				g.Any = append(g.Any, x)
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// elements returns the elements of g. When g repeats, or is nested in a
+// repeated group, its elements are marked as unbounded, so that they are
+// generated as slices whatever their own maxOccurs. When g is optional, so
+// are its elements.
+func (g *xsdModelGroup) elements(repeated bool) []*XSDElement {
+	if g == nil {
+		return nil
+	}
+	if g.MinOccurs == "0" {
+		for _, el := range g.Elements {
+			el.MinOccurs = "0"
+		}
+	}
+	if repeated || isRepeated(g.MaxOccurs) {
+		for _, el := range g.Elements {
+			if !isRepeated(el.MaxOccurs) {
+				el.MaxOccurs = "unbounded"
+			}
+		}
+	}
+	return g.Elements
+}
+
+// choiceElements marks elements as the elements of a choice.
+func choiceElements(elements []*XSDElement) []*XSDElement {
+	for _, el := range elements {
+		el.choice = true
+	}
+	return elements
+}
+
+// isRequired reports whether an element has a minOccurs of one or more, which
+// is the default, and is not one of the alternatives of a choice.
+func isRequired(el *XSDElement) bool {
+	if el.choice {
+		return false
+	}
+	minOccurs := strings.TrimSpace(el.MinOccurs)
+	if minOccurs == "" {
+		return true
+	}
+	n, err := strconv.Atoi(minOccurs)
+	return err == nil && n >= 1
+}
+
+func elementValues(elements []*XSDElement) []XSDElement {
+	if elements == nil {
+		return nil
+	}
+	values := make([]XSDElement, len(elements))
+	for i, el := range elements {
+		values[i] = *el
+	}
+	return values
+}
+
+func elementPointers(elements []XSDElement) []*XSDElement {
+	pointers := make([]*XSDElement, len(elements))
+	for i := range elements {
+		pointers[i] = &elements[i]
+	}
+	return pointers
+}
+
+// isRepeated reports whether maxOccurs allows more than one occurrence.
+func isRepeated(maxOccurs string) bool {
+	if maxOccurs == "unbounded" {
+		return true
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(maxOccurs))
+	return err == nil && n > 1
 }
 
 // XSDAttribute represent an element attribute. Simple elements cannot have
@@ -204,7 +510,22 @@ type XSDAttribute struct {
 	Type       string         `xml:"type,attr"`
 	Use        string         `xml:"use,attr"`
 	Fixed      string         `xml:"fixed,attr"`
+	Default    string         `xml:"default,attr"`
+	Form       string         `xml:"form,attr"`
 	SimpleType *XSDSimpleType `xml:"simpleType"`
+
+	// namespace is the namespace of qualified attributes, and is empty for
+	// unqualified ones.
+	namespace string
+}
+
+// XSDAttributeGroup element defines a group of attributes, which complex
+// types and other attribute groups include by reference.
+type XSDAttributeGroup struct {
+	Name            string               `xml:"name,attr"`
+	Ref             string               `xml:"ref,attr"`
+	Attributes      []*XSDAttribute      `xml:"attribute"`
+	AttributeGroups []*XSDAttributeGroup `xml:"attributeGroup"`
 }
 
 // XSDSimpleType element defines a simple type and specifies the constraints